@@ -12,6 +12,8 @@ import (
 // NewAccount registers a new account with the acme service
 // Note this function is essentially deprecated and only present for backwards compatibility.
 // New programs should implement NewAccountOptions instead.
+//
+// Deprecated: use NewAccountOptions with NewAcctOptOnlyReturnExisting, NewAcctOptAgreeTOS and NewAcctOptWithContacts.
 func (c Client) NewAccount(privateKey crypto.Signer, onlyReturnExisting, termsOfServiceAgreed bool, contact ...string) (Account, error) {
 	var opts []NewAccountOptionFunc
 	if onlyReturnExisting {
@@ -32,18 +34,34 @@ func (c Client) NewAccountOptions(privateKey crypto.Signer, options ...NewAccoun
 	newAccountReq := NewAccountRequest{}
 	account := Account{}
 
+	if privateKey == nil {
+		return account, errors.New("acme: no account key")
+	}
+	if err := c.checkKey(privateKey.Public()); err != nil {
+		return account, err
+	}
+
 	for _, opt := range options {
 		if err := opt(privateKey, &account, &newAccountReq, c); err != nil {
 			return account, err
 		}
 	}
 
-	resp, err := c.post(c.dir.NewAccount, "", privateKey, newAccountReq, &account, http.StatusOK, http.StatusCreated)
+	newAccountReq.Contact = c.quirks.contacts(newAccountReq.Contact)
+
+	var accountResp wireAccount
+	resp, err := c.post(c.Directory().NewAccount, "", privateKey, newAccountReq, &accountResp, http.StatusOK, http.StatusCreated)
 	if err != nil {
 		return account, err
 	}
+	if err := accountResp.apply(&account); err != nil {
+		return account, err
+	}
 
 	account.URL = resp.Header.Get("Location")
+	if account.URL == "" {
+		return account, errors.New("acme: no account url provided in Location header")
+	}
 	account.PrivateKey = privateKey
 
 	if account.Thumbprint == "" {
@@ -57,26 +75,63 @@ func (c Client) NewAccountOptions(privateKey crypto.Signer, options ...NewAccoun
 }
 
 // UpdateAccount updates an existing account with the acme service.
+// Equivalent to UpdateAccountOptions with UpdateAcctOptContacts, or with no options if no contacts are provided, in
+// which case the existing contacts of the account are kept. Use UpdateAcctOptContacts to remove all contacts.
 func (c Client) UpdateAccount(account Account, contact ...string) (Account, error) {
+	if len(contact) == 0 {
+		return c.UpdateAccountOptions(account)
+	}
+	return c.UpdateAccountOptions(account, UpdateAcctOptContacts(contact...))
+}
+
+// MarshalJSON implements json.Marshaler, always including the contacts when they are to be updated so an empty list
+// of contacts removes all existing contacts rather than being omitted.
+func (r UpdateAccountRequest) MarshalJSON() ([]byte, error) {
+	type request UpdateAccountRequest
+	if !r.UpdateContact {
+		return json.Marshal(request(r))
+	}
+	contact := r.Contact
+	if contact == nil {
+		contact = []string{}
+	}
+	return json.Marshal(struct {
+		request
+		Contact []string `json:"contact"`
+	}{request(r), contact})
+}
+
+// UpdateAccountOptions updates an existing account with the acme service with the provided options.
+// If no options change the account, the up-to-date account is fetched from the acme service.
+func (c Client) UpdateAccountOptions(account Account, options ...UpdateAccountOptionFunc) (Account, error) {
+	var updateReq UpdateAccountRequest
+	for _, opt := range options {
+		if err := opt(&updateReq); err != nil {
+			return account, err
+		}
+	}
+
 	var updateAccountReq interface{}
+	contact := c.quirks.contacts(updateReq.Contact)
 
-	if !reflect.DeepEqual(account.Contact, contact) {
+	if updateReq.UpdateContact && !reflect.DeepEqual(account.Contact, contact) {
 		// Only provide a non-nil updateAccountReq when there is an update to be made.
-		updateAccountReq = struct {
-			Contact []string `json:"contact,omitempty"`
-		}{
-			Contact: contact,
-		}
+		updateReq.Contact = contact
+		updateAccountReq = updateReq
 	} else {
 		// Otherwise use "" to trigger a POST-as-GET to fetch up-to-date account
 		// information from the acme service.
 		updateAccountReq = ""
 	}
 
-	_, err := c.post(account.URL, account.URL, account.PrivateKey, updateAccountReq, &account, http.StatusOK)
+	var accountResp wireAccount
+	_, err := c.post(account.URL, account.URL, account.PrivateKey, updateAccountReq, &accountResp, http.StatusOK)
 	if err != nil {
 		return account, err
 	}
+	if err := accountResp.apply(&account); err != nil {
+		return account, err
+	}
 
 	if account.Thumbprint == "" {
 		account.Thumbprint, err = JWKThumbprint(account.PrivateKey.Public())
@@ -90,10 +145,17 @@ func (c Client) UpdateAccount(account Account, contact ...string) (Account, erro
 
 // AccountKeyChange rolls over an account to a new key.
 func (c Client) AccountKeyChange(account Account, newPrivateKey crypto.Signer) (Account, error) {
+	if c.quirks.NoKeyChange {
+		return account, errNoKeyChange
+	}
+
 	oldJwkKeyPub, err := jwkEncode(account.PrivateKey.Public())
 	if err != nil {
 		return account, fmt.Errorf("acme: error encoding new private key: %v", err)
 	}
+	if err := c.checkKey(newPrivateKey.Public()); err != nil {
+		return account, err
+	}
 
 	keyChangeReq := struct {
 		Account string          `json:"account"`
@@ -103,12 +165,12 @@ func (c Client) AccountKeyChange(account Account, newPrivateKey crypto.Signer) (
 		OldKey:  []byte(oldJwkKeyPub),
 	}
 
-	innerJws, err := jwsEncodeJSON(keyChangeReq, newPrivateKey, "", "", c.dir.KeyChange)
+	innerJws, err := jwsEncodeJSON(c.random(), keyChangeReq, newPrivateKey, "", "", c.Directory().KeyChange)
 	if err != nil {
 		return account, fmt.Errorf("acme: error encoding inner jws: %v", err)
 	}
 
-	if _, err := c.post(c.dir.KeyChange, account.URL, account.PrivateKey, json.RawMessage(innerJws), nil, http.StatusOK); err != nil {
+	if _, err := c.post(c.Directory().KeyChange, account.URL, account.PrivateKey, json.RawMessage(innerJws), nil, http.StatusOK); err != nil {
 		return account, err
 	}
 
@@ -125,7 +187,11 @@ func (c Client) DeactivateAccount(account Account) (Account, error) {
 		Status: "deactivated",
 	}
 
-	_, err := c.post(account.URL, account.URL, account.PrivateKey, deactivateReq, &account, http.StatusOK)
+	var accountResp wireAccount
+	if _, err := c.post(account.URL, account.URL, account.PrivateKey, deactivateReq, &accountResp, http.StatusOK); err != nil {
+		return account, err
+	}
+	err := accountResp.apply(&account)
 
 	return account, err
 }
@@ -1,12 +1,17 @@
 package acme
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"reflect"
 	"strings"
 	"testing"
@@ -120,6 +125,112 @@ func TestClient_UpdateAccount2(t *testing.T) {
 	}
 }
 
+func TestClient_UpdateAccountOptions(t *testing.T) {
+	account := makeAccount(t)
+	contact := []string{"mailto:test@test.com"}
+	updatedAccount, err := testClient.UpdateAccountOptions(account, UpdateAcctOptContacts(contact...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(updatedAccount.Contact, contact) {
+		t.Fatalf("contact mismatch, expected: %v, got: %v", contact, updatedAccount.Contact)
+	}
+
+	// no options fetches the account without changing it
+	fetchedAccount, err := testClient.UpdateAccountOptions(updatedAccount)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(fetchedAccount.Contact, contact) {
+		t.Fatalf("contact mismatch, expected: %v, got: %v", contact, fetchedAccount.Contact)
+	}
+}
+
+func TestClient_UpdateAccountOptions_clearContacts(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	var payloads []string
+	transport := ca.HTTPClient().Transport
+	c, err := NewClient(DevCADirectoryURL, WithHTTPClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			var jws struct {
+				Payload string `json:"payload"`
+			}
+			if err := json.Unmarshal(body, &jws); err == nil {
+				payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+				payloads = append(payloads, string(payload))
+			}
+		}
+		return transport.RoundTrip(req)
+	})}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	key, err := c.GenerateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	account, err := c.NewAccount(key, false, true, "mailto:test@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+
+	payloads = nil
+	account, err = c.UpdateAccountOptions(account, UpdateAcctOptContacts())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(account.Contact) != 0 {
+		t.Fatalf("expected contacts to be cleared, got: %v", account.Contact)
+	}
+	if expected := []string{`{"contact":[]}`}; !reflect.DeepEqual(payloads, expected) {
+		t.Fatalf("expected request body %v, got: %v", expected, payloads)
+	}
+
+	if b, err := json.Marshal(UpdateAccountRequest{Contact: []string{"mailto:test@example.com"}}); err != nil || string(b) != `{"contact":["mailto:test@example.com"]}` {
+		t.Fatalf("unexpected request without contact update: %s %v", b, err)
+	}
+}
+
+func TestClient_UpdateAccount_keepContacts(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	contact := []string{"mailto:test@example.com"}
+	account, err := c.NewAccount(makePrivateKey(t), false, true, contact...)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+
+	updated, err := c.UpdateAccount(account)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(updated.Contact, contact) {
+		t.Fatalf("expected contacts to be kept, got: %v", updated.Contact)
+	}
+	fetched, err := c.UpdateAccountOptions(Account{PrivateKey: account.PrivateKey, URL: account.URL})
+	if err != nil {
+		t.Fatalf("unexpected error fetching account: %v", err)
+	}
+	if !reflect.DeepEqual(fetched.Contact, contact) {
+		t.Fatalf("expected contacts to be kept on the server, got: %v", fetched.Contact)
+	}
+}
+
 type errSigner struct{}
 
 func (es errSigner) Public() crypto.PublicKey {
@@ -132,6 +243,11 @@ func (es errSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
 }
 
 func TestClient_AccountKeyChange(t *testing.T) {
+	if testClientMeta.Software == clientStepCA {
+		t.Skip("step-ca doesnt support account key change")
+		return
+	}
+
 	tests := []struct {
 		name         string
 		account      func() Account
@@ -214,6 +330,9 @@ func TestClient_DeactivateAccount(t *testing.T) {
 	if account.Status != "deactivated" {
 		t.Fatalf("expected account deactivated, got: %s", account.Status)
 	}
+	if n := len(account.StatusHistory); n == 0 || account.StatusHistory[n-1].Status != "deactivated" {
+		t.Fatalf("expected deactivated status change, got: %+v", account.StatusHistory)
+	}
 }
 
 func TestClient_FetchOrderList(t *testing.T) {
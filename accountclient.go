@@ -0,0 +1,163 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/x509"
+)
+
+// AccountClient is a Client bound to a single account, returned by Client.WithAccount.
+// Its methods mirror those of Client with the account parameter omitted.
+// Methods which modify the account return a new AccountClient bound to the updated account.
+type AccountClient struct {
+	client  Client
+	account Account
+}
+
+// WithAccount returns an AccountClient which performs all requests using the given account.
+func (c Client) WithAccount(account Account) AccountClient {
+	return AccountClient{
+		client:  c,
+		account: account,
+	}
+}
+
+// Client returns the underlying client.
+func (ac AccountClient) Client() Client {
+	return ac.client
+}
+
+// Account returns the bound account.
+func (ac AccountClient) Account() Account {
+	return ac.account
+}
+
+// Fetch performs a POST-as-GET request using the bound account, see Client.Fetch
+func (ac AccountClient) Fetch(requestURL string, result interface{}, expectedStatus ...int) error {
+	return ac.client.Fetch(ac.account, requestURL, result, expectedStatus...)
+}
+
+// UpdateAccount updates the bound account, see Client.UpdateAccount
+func (ac AccountClient) UpdateAccount(contact ...string) (AccountClient, error) {
+	account, err := ac.client.UpdateAccount(ac.account, contact...)
+	if err != nil {
+		return ac, err
+	}
+	return ac.client.WithAccount(account), nil
+}
+
+// UpdateAccountOptions updates the bound account with the provided options, see Client.UpdateAccountOptions
+func (ac AccountClient) UpdateAccountOptions(options ...UpdateAccountOptionFunc) (AccountClient, error) {
+	account, err := ac.client.UpdateAccountOptions(ac.account, options...)
+	if err != nil {
+		return ac, err
+	}
+	return ac.client.WithAccount(account), nil
+}
+
+// AccountKeyChange rolls over the bound account to a new key, see Client.AccountKeyChange
+func (ac AccountClient) AccountKeyChange(newPrivateKey crypto.Signer) (AccountClient, error) {
+	account, err := ac.client.AccountKeyChange(ac.account, newPrivateKey)
+	if err != nil {
+		return ac, err
+	}
+	return ac.client.WithAccount(account), nil
+}
+
+// DeactivateAccount deactivates the bound account, see Client.DeactivateAccount
+func (ac AccountClient) DeactivateAccount() (AccountClient, error) {
+	account, err := ac.client.DeactivateAccount(ac.account)
+	if err != nil {
+		return ac, err
+	}
+	return ac.client.WithAccount(account), nil
+}
+
+// FetchOrderList fetches the order list of the bound account, see Client.FetchOrderList
+func (ac AccountClient) FetchOrderList() (OrderList, error) {
+	return ac.client.FetchOrderList(ac.account)
+}
+
+// NewOrder initiates a new order, see Client.NewOrder
+func (ac AccountClient) NewOrder(identifiers []Identifier) (Order, error) {
+	return ac.client.NewOrder(ac.account, identifiers)
+}
+
+// NewOrderOptions initiates a new order with the provided options, see Client.NewOrderOptions
+func (ac AccountClient) NewOrderOptions(identifiers []Identifier, options ...NewOrderOptionFunc) (Order, error) {
+	return ac.client.NewOrderOptions(ac.account, identifiers, options...)
+}
+
+// NewOrderDomains initiates a new order for the given domains, see Client.NewOrderDomains
+func (ac AccountClient) NewOrderDomains(domains ...string) (Order, error) {
+	return ac.client.NewOrderDomains(ac.account, domains...)
+}
+
+// FetchOrder fetches an existing order, see Client.FetchOrder
+func (ac AccountClient) FetchOrder(orderURL string) (Order, error) {
+	return ac.client.FetchOrder(ac.account, orderURL)
+}
+
+// FinalizeOrder finalizes an order, see Client.FinalizeOrder
+func (ac AccountClient) FinalizeOrder(order Order, csr *x509.CertificateRequest) (Order, error) {
+	return ac.client.FinalizeOrder(ac.account, order, csr)
+}
+
+// FetchAuthorization fetches an authorization, see Client.FetchAuthorization
+func (ac AccountClient) FetchAuthorization(authURL string) (Authorization, error) {
+	return ac.client.FetchAuthorization(ac.account, authURL)
+}
+
+// NewAuthorization creates a new authorization for an identifier, see Client.NewAuthorization
+func (ac AccountClient) NewAuthorization(identifier Identifier) (Authorization, error) {
+	return ac.client.NewAuthorization(ac.account, identifier)
+}
+
+// DeactivateAuthorization deactivates an authorization, see Client.DeactivateAuthorization
+func (ac AccountClient) DeactivateAuthorization(authURL string) (Authorization, error) {
+	return ac.client.DeactivateAuthorization(ac.account, authURL)
+}
+
+// UpdateChallenge responds to a challenge, see Client.UpdateChallenge
+func (ac AccountClient) UpdateChallenge(challenge Challenge) (Challenge, error) {
+	return ac.client.UpdateChallenge(ac.account, challenge)
+}
+
+// FetchChallenge fetches a challenge, see Client.FetchChallenge
+func (ac AccountClient) FetchChallenge(challengeURL string) (Challenge, error) {
+	return ac.client.FetchChallenge(ac.account, challengeURL)
+}
+
+// FetchCertificates downloads a certificate chain, see Client.FetchCertificates
+func (ac AccountClient) FetchCertificates(certificateURL string) ([]*x509.Certificate, error) {
+	return ac.client.FetchCertificates(ac.account, certificateURL)
+}
+
+// FetchAllCertificates downloads a certificate chain and any alternates, see Client.FetchAllCertificates
+func (ac AccountClient) FetchAllCertificates(certificateURL string) (map[string][]*x509.Certificate, error) {
+	return ac.client.FetchAllCertificates(ac.account, certificateURL)
+}
+
+// RevokeCertificate revokes a certificate, see Client.RevokeCertificate
+func (ac AccountClient) RevokeCertificate(cert *x509.Certificate, key crypto.Signer, reason int) error {
+	return ac.client.RevokeCertificate(ac.account, cert, key, reason)
+}
+
+// RevokeCertificateOptions revokes a certificate with the provided options, see Client.RevokeCertificateOptions
+func (ac AccountClient) RevokeCertificateOptions(cert *x509.Certificate, options ...RevokeCertificateOptionFunc) error {
+	return ac.client.RevokeCertificateOptions(ac.account, cert, options...)
+}
+
+// Supports reports whether the acme server supports a feature, see Client.Supports
+func (ac AccountClient) Supports(feature string) (bool, error) {
+	return ac.client.Supports(ac.account, feature)
+}
+
+// DNSChanges returns the dns records required to fulfil an order, see Client.DNSChanges
+func (ac AccountClient) DNSChanges(order Order) ([]DNSChange, error) {
+	return ac.client.DNSChanges(ac.account, order)
+}
+
+// CompleteDNSChanges validates the challenges of dns changes, see Client.CompleteDNSChanges
+func (ac AccountClient) CompleteDNSChanges(changes []DNSChange) error {
+	return ac.client.CompleteDNSChanges(ac.account, changes)
+}
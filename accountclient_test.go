@@ -0,0 +1,50 @@
+package acme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClient_WithAccount(t *testing.T) {
+	account := makeAccount(t)
+	ac := testClient.WithAccount(account)
+
+	if !reflect.DeepEqual(ac.Account(), account) {
+		t.Fatalf("account mismatch, expected: %+v, got: %+v", account, ac.Account())
+	}
+	if !reflect.DeepEqual(ac.Client().Directory(), testClient.Directory()) {
+		t.Fatal("client mismatch")
+	}
+
+	order, err := ac.NewOrderDomains(randString() + ".com")
+	if err != nil {
+		t.Fatalf("unexpected error making order: %v", err)
+	}
+
+	fetchedOrder, err := ac.FetchOrder(order.URL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching order: %v", err)
+	}
+	if fetchedOrder.URL != order.URL {
+		t.Fatalf("order url mismatch, expected: %s, got: %s", order.URL, fetchedOrder.URL)
+	}
+
+	if testClientMeta.Software != clientStepCA {
+		newKey := makePrivateKey(t)
+		ac, err = ac.AccountKeyChange(newKey)
+		if err != nil {
+			t.Fatalf("unexpected error changing account key: %v", err)
+		}
+		if ac.Account().PrivateKey != newKey {
+			t.Fatal("bound account key not updated")
+		}
+	}
+
+	ac, err = ac.DeactivateAccount()
+	if err != nil {
+		t.Fatalf("unexpected error deactivating account: %v", err)
+	}
+	if ac.Account().Status != "deactivated" {
+		t.Fatalf("expected deactivated status, got: %s", ac.Account().Status)
+	}
+}
@@ -0,0 +1,190 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In flight calls to GetOrCreateAccount by name, shared between copies of a Client.
+type accountFlights struct {
+	lock  sync.Mutex
+	calls map[string]*accountCall
+}
+
+type accountCall struct {
+	done    chan struct{}
+	account Account
+	err     error
+}
+
+// Helper functions to get the store keys of the private key and record of a named account.
+func accountKeyKey(name string) string    { return "accounts/" + name + "/key" }
+func accountRecordKey(name string) string { return "accounts/" + name + "/account" }
+
+// GetOrCreateAccount returns the named account kept in store, creating it with the provided options if it doesn't
+// exist yet. This allows a fleet of processes sharing a store and configuration to bootstrap at the same time without
+// each registering a duplicate account and tripping the newAccount rate limits:
+//
+// Concurrent calls for the same name on a Client, or copies of it, share a single request.
+//
+// The account key is created with AtomicStore.Create if the store supports it, so all processes agree on a single key.
+// Registering an account with a key which is already registered returns the existing account rather than a new one.
+//
+// Once registered, the account url is stored and later calls fetch the account rather than registering it again.
+//
+// If the server responds with a rateLimited error with a Retry-After header, registration is retried after that time
+// unless the context is done first.
+func (c Client) GetOrCreateAccount(ctx context.Context, store Store, name string, options ...NewAccountOptionFunc) (Account, error) {
+	if store == nil {
+		return Account{}, errors.New("acme: no account store")
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return Account{}, fmt.Errorf("acme: invalid account name %q", name)
+	}
+
+	if c.accounts == nil {
+		return c.getOrCreateAccount(ctx, store, name, options)
+	}
+
+	c.accounts.lock.Lock()
+	if call, ok := c.accounts.calls[name]; ok {
+		c.accounts.lock.Unlock()
+		select {
+		case <-call.done:
+			return call.account, call.err
+		case <-ctx.Done():
+			return Account{}, ctx.Err()
+		}
+	}
+	call := &accountCall{done: make(chan struct{})}
+	if c.accounts.calls == nil {
+		c.accounts.calls = map[string]*accountCall{}
+	}
+	c.accounts.calls[name] = call
+	c.accounts.lock.Unlock()
+
+	call.account, call.err = c.getOrCreateAccount(ctx, store, name, options)
+
+	c.accounts.lock.Lock()
+	delete(c.accounts.calls, name)
+	c.accounts.lock.Unlock()
+	close(call.done)
+
+	return call.account, call.err
+}
+
+// Helper function to load or create the key of a named account, then fetch or register the account.
+func (c Client) getOrCreateAccount(ctx context.Context, store Store, name string, options []NewAccountOptionFunc) (Account, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		key, err := loadAccountKey(store, name)
+		if err == ErrStoreNotFound {
+			key, err = c.createAccountKey(store, name)
+			if err == ErrStoreExists {
+				// another process created the key first, use theirs
+				continue
+			}
+		}
+		if err != nil {
+			return Account{}, err
+		}
+
+		return c.fetchOrRegisterAccount(ctx, store, name, key, options)
+	}
+
+	return Account{}, fmt.Errorf("acme: unable to agree on a key for account %q", name)
+}
+
+// Helper function to fetch a stored account, or register it if it isn't stored or no longer exists.
+func (c Client) fetchOrRegisterAccount(ctx context.Context, store Store, name string, key crypto.Signer, options []NewAccountOptionFunc) (Account, error) {
+	b, err := store.Get(accountRecordKey(name))
+	if err != nil && err != ErrStoreNotFound {
+		return Account{}, fmt.Errorf("acme: error loading account %q: %v", name, err)
+	}
+	if err == nil {
+		account, err := DecodeAccount(b)
+		if err != nil {
+			return Account{}, err
+		}
+		account, err = c.UpdateAccountOptions(account)
+		if err == nil {
+			return account, nil
+		}
+		if prob, ok := err.(Problem); !ok || !strings.HasSuffix(prob.Type, ":accountDoesNotExist") {
+			return account, err
+		}
+	}
+
+	for {
+		account, err := c.NewAccountOptions(key, options...)
+		if err == nil {
+			b, err := EncodeAccount(account)
+			if err != nil {
+				return account, err
+			}
+			if err := store.Put(accountRecordKey(name), b); err != nil {
+				return account, fmt.Errorf("acme: error storing account %q: %v", name, err)
+			}
+			return account, nil
+		}
+
+		prob, ok := err.(Problem)
+		if !ok || !strings.HasSuffix(prob.Type, ":rateLimited") || prob.RetryAfter.IsZero() {
+			return account, err
+		}
+		select {
+		case <-time.After(time.Until(prob.RetryAfter)):
+		case <-ctx.Done():
+			return account, fmt.Errorf("acme: %v waiting to retry rate limited account registration: %v", ctx.Err(), err)
+		}
+	}
+}
+
+// Helper function to load the private key of a named account from a store.
+func loadAccountKey(store Store, name string) (crypto.Signer, error) {
+	b, err := store.Get(accountKeyKey(name))
+	if err != nil {
+		if err == ErrStoreNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("acme: error loading key of account %q: %v", name, err)
+	}
+
+	key, err := decodePrivateKey(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("acme: error decoding key of account %q: %v", name, err)
+	}
+
+	return key, nil
+}
+
+// Helper function to create the private key of a named account, storing it only if no key exists when the store
+// supports it. Returns ErrStoreExists if another process created a key first.
+func (c Client) createAccountKey(store Store, name string) (crypto.Signer, error) {
+	key, err := c.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	b, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error encoding key of account %q: %v", name, err)
+	}
+
+	if as, ok := store.(AtomicStore); ok {
+		err = as.Create(accountKeyKey(name), []byte(b))
+	} else {
+		err = store.Put(accountKeyKey(name), []byte(b))
+	}
+	if err == ErrStoreExists {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("acme: error storing key of account %q: %v", name, err)
+	}
+
+	return key, nil
+}
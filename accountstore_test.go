@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_GetOrCreateAccount(t *testing.T) {
+	var srv *httptest.Server
+	var newAccounts, fetches int32
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce","newAccount":"` + srv.URL + `/new-acct"}`))
+		case "/nonce":
+		case "/new-acct":
+			if atomic.AddInt32(&newAccounts, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rateLimited","status":429}`))
+				return
+			}
+			w.Header().Set("Location", srv.URL+"/acct/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"status":"valid"}`))
+		case "/acct/1":
+			atomic.AddInt32(&fetches, 1)
+			_, _ = w.Write([]byte(`{"status":"valid"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// two clients sharing a store, as two processes would
+	var clients []Client
+	for i := 0; i < 2; i++ {
+		c, err := NewClient(srv.URL + "/dir")
+		if err != nil {
+			t.Fatalf("unexpected error creating client: %v", err)
+		}
+		clients = append(clients, c)
+	}
+	store := &MemoryStore{}
+
+	var wg sync.WaitGroup
+	accounts := make([]Account, 10)
+	errs := make([]error, len(accounts))
+	for i := range accounts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			accounts[i], errs[i] = clients[i%len(clients)].GetOrCreateAccount(context.Background(), store, "example")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error in call %d: %v", i, err)
+		}
+		if accounts[i].URL != srv.URL+"/acct/1" || accounts[i].Thumbprint != accounts[0].Thumbprint {
+			t.Fatalf("expected all calls to share one account, got: %+v and %+v", accounts[0], accounts[i])
+		}
+	}
+	// one rate limited attempt, then at most once per client
+	if n := atomic.LoadInt32(&newAccounts); n > 3 {
+		t.Fatalf("expected at most 3 new account requests, got: %d", n)
+	}
+
+	registered := atomic.LoadInt32(&newAccounts)
+	account, err := clients[0].GetOrCreateAccount(context.Background(), store, "example")
+	if err != nil {
+		t.Fatalf("unexpected error fetching stored account: %v", err)
+	}
+	if account.Thumbprint != accounts[0].Thumbprint {
+		t.Fatalf("expected stored account, got: %+v", account)
+	}
+	if n := atomic.LoadInt32(&newAccounts); n != registered {
+		t.Fatalf("expected stored account to be fetched without registering, got %d new account requests", n-registered)
+	}
+	if atomic.LoadInt32(&fetches) == 0 {
+		t.Fatal("expected stored account to be fetched")
+	}
+
+	for _, name := range []string{"", "a/b"} {
+		if _, err := clients[0].GetOrCreateAccount(context.Background(), store, name); err == nil {
+			t.Errorf("expected error for account name %q, got none", name)
+		}
+	}
+	if _, err := clients[0].GetOrCreateAccount(context.Background(), nil, "example"); err == nil {
+		t.Error("expected error with no store, got none")
+	}
+}
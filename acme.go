@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,9 +25,46 @@ const (
 	// ZeroSSLProduction holds the ZeroSSL directory url
 	ZeroSSLProduction = "https://acme.zerossl.com/v2/DV90"
 
+	// BuypassProduction holds the Buypass production directory url
+	BuypassProduction = "https://api.buypass.com/acme/directory"
+
+	// BuypassStaging holds the Buypass staging directory url
+	BuypassStaging = "https://api.test4.buypass.no/acme/directory"
+
+	// GoogleProduction holds the Google Trust Services production directory url
+	GoogleProduction = "https://dv.acme-v02.api.pki.goog/directory"
+
+	// GoogleStaging holds the Google Trust Services staging directory url
+	GoogleStaging = "https://dv.acme-v02.test-api.pki.goog/directory"
+
 	userAgentString = "eggsampler-acme/v3 Go-http-client/1.1"
 )
 
+// Mapping of well known production directory urls to their staging counterparts.
+var stagingDirectories = map[string]string{
+	LetsEncryptProduction: LetsEncryptStaging,
+	BuypassProduction:     BuypassStaging,
+	GoogleProduction:      GoogleStaging,
+}
+
+// StagingDirectory returns the staging directory url for a well known production directory url.
+// Returns false if the directory has no known staging counterpart, eg ZeroSSL which has no staging environment.
+func StagingDirectory(productionURL string) (string, bool) {
+	stagingURL, ok := stagingDirectories[productionURL]
+	return stagingURL, ok
+}
+
+// ProductionDirectory returns the production directory url for a well known staging directory url.
+// Returns false if the directory is not a known staging directory.
+func ProductionDirectory(stagingURL string) (string, bool) {
+	for prod, staging := range stagingDirectories {
+		if staging == stagingURL {
+			return prod, true
+		}
+	}
+	return "", false
+}
+
 // NewClient creates a new acme client given a valid directory url.
 func NewClient(directoryURL string, options ...OptionFunc) (Client, error) {
 	// Set a default http timeout of 60 seconds, this can be overridden
@@ -39,26 +77,28 @@ func NewClient(directoryURL string, options ...OptionFunc) (Client, error) {
 		httpClient: httpClient,
 		nonces:     &nonceStack{},
 		retryCount: 5,
+		dir:        newDirectoryCache(Directory{URL: directoryURL}),
+		accounts:   &accountFlights{},
 	}
 
-	acmeClient.dir.URL = directoryURL
-
 	for _, opt := range options {
 		if err := opt(&acmeClient); err != nil {
 			return acmeClient, fmt.Errorf("acme: error setting option: %v", err)
 		}
 	}
 
-	if _, err := acmeClient.get(directoryURL, &acmeClient.dir, http.StatusOK); err != nil {
+	dir := Directory{URL: directoryURL}
+	if _, err := acmeClient.get(directoryURL, &dir, http.StatusOK); err != nil {
 		return acmeClient, err
 	}
+	acmeClient.dir.set(dir)
 
 	return acmeClient, nil
 }
 
 // The directory object returned by the client connecting to a directory url.
 func (c Client) Directory() Directory {
-	return c.dir
+	return c.dir.get()
 }
 
 // Helper function to get the poll interval and poll timeout, defaulting if 0
@@ -74,6 +114,58 @@ func (c Client) getPollingDurations() (time.Duration, time.Duration) {
 	return pollInterval, pollTimeout
 }
 
+// The maximum time to wait for a Retry-After header before polling a resource again, unless set by WithRetryAfterClamp.
+const defaultRetryAfterMax = time.Minute
+
+// Helper function to get how long to wait before polling a resource again, given the time from a Retry-After header.
+// By default the poll interval is used unless Retry-After is later, clamped by WithRetryAfterClamp if set, and never
+// waits past end, the time polling times out.
+func (c Client) pollDelay(pollInterval time.Duration, retryAfter, end time.Time) time.Duration {
+	delay := pollInterval
+	if !retryAfter.IsZero() {
+		if d := time.Until(retryAfter); d > delay || c.retryAfterMin > 0 {
+			delay = d
+		}
+	}
+	if c.retryAfterMin > 0 && delay < c.retryAfterMin {
+		delay = c.retryAfterMin
+	}
+	retryAfterMax := c.retryAfterMax
+	if retryAfterMax == 0 {
+		retryAfterMax = defaultRetryAfterMax
+	}
+	if delay > retryAfterMax {
+		delay = retryAfterMax
+	}
+	if remaining := time.Until(end); delay > remaining {
+		delay = remaining
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// Returned when polling stops early as the done channel of a client is closed.
+var errPollCancelled = errors.New("acme: polling cancelled")
+
+// Helper function to wait before polling a resource again, returning errPollCancelled early if the done channel of
+// the client is closed, eg when an Issuer context is cancelled.
+func (c Client) pollWait(delay time.Duration) error {
+	if c.done == nil {
+		time.Sleep(delay)
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-c.done:
+		return errPollCancelled
+	}
+}
+
 // Helper function to have a central point for performing http requests.
 // Stores any returned nonces in the stack.
 func (c Client) do(req *http.Request, addNonce bool) (*http.Response, error) {
@@ -88,15 +180,36 @@ func (c Client) do(req *http.Request, addNonce bool) (*http.Response, error) {
 		req.Header.Set("Accept-Language", c.acceptLanguage)
 	}
 
+	endpoint := c.endpoint(req.URL.String())
+	if err := c.limiter.wait(req.Context(), c.done, endpoint); err != nil {
+		return nil, err
+	}
+
+	var rt *requestTrace
+	if c.requestHook != nil {
+		req, rt = newRequestTrace(req, endpoint, c.metadata)
+	}
+
 	resp, err := c.httpClient.Do(req)
+	if rt != nil {
+		c.requestHook(rt.finish(resp, err))
+	}
 	if err != nil {
 		return resp, err
 	}
+	if err := c.checkStapling(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
 
 	if addNonce {
 		c.nonces.push(resp.Header.Get("Replay-Nonce"))
 	}
 
+	if c.onResponse != nil {
+		c.onResponse(resp)
+	}
+
 	return resp, nil
 }
 
@@ -133,7 +246,7 @@ func (c Client) get(url string, out interface{}, expectedStatus ...int) (*http.R
 	}
 
 	if len(body) > 0 && out != nil {
-		if err := json.Unmarshal(body, out); err != nil {
+		if err := c.jsonCodec().Unmarshal(body, out); err != nil {
 			return resp, fmt.Errorf("acme: error parsing response body: %v", err)
 		}
 	}
@@ -141,28 +254,68 @@ func (c Client) get(url string, out interface{}, expectedStatus ...int) (*http.R
 	return resp, nil
 }
 
+// Helper function to get a nonce for a request, either one returned by a previous response or a new one.
+// New nonces are fetched from the newNonce endpoint. Only if the directory has no newNonce endpoint, as some minimal
+// acme servers only provide nonces with every response, a HEAD request is made on the directory and each other
+// endpoint in turn.
 func (c Client) nonce() (string, error) {
 	nonce := c.nonces.pop()
 	if nonce != "" {
 		return nonce, nil
 	}
 
-	if c.dir.NewNonce == "" {
+	sources := nonceSources(c.Directory())
+	if len(sources) == 0 {
 		return "", errors.New("acme: no new nonce url")
 	}
 
-	req, err := http.NewRequest("HEAD", c.dir.NewNonce, nil)
+	var errs []string
+	for _, source := range sources {
+		nonce, err := c.headNonce(source)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if nonce != "" {
+			return nonce, nil
+		}
+		errs = append(errs, "no Replay-Nonce header from "+source)
+	}
+
+	return "", fmt.Errorf("acme: error fetching new nonce: %s", strings.Join(errs, "; "))
+}
+
+// Helper function to list the urls which may provide a nonce, in order of preference. This is only the newNonce
+// endpoint when the directory has one, so errors from it aren't hidden by other endpoints.
+func nonceSources(dir Directory) []string {
+	if dir.NewNonce != "" {
+		return []string{dir.NewNonce}
+	}
+	var sources []string
+	seen := map[string]bool{}
+	for _, u := range []string{dir.URL, dir.NewAccount, dir.NewOrder, dir.NewAuthz, dir.RevokeCert, dir.KeyChange} {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			sources = append(sources, u)
+		}
+	}
+	return sources
+}
+
+// Helper function to fetch a nonce with a HEAD request.
+func (c Client) headNonce(nonceURL string) (string, error) {
+	req, err := http.NewRequest(http.MethodHead, nonceURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("acme: error creating new nonce request: %v", err)
+		return "", fmt.Errorf("error creating new nonce request: %v", err)
 	}
 
 	resp, err := c.do(req, false)
 	if err != nil {
-		return "", fmt.Errorf("acme: error fetching new nonce: %v", err)
+		return "", fmt.Errorf("error fetching new nonce from %s: %v", nonceURL, err)
 	}
+	resp.Body.Close()
 
-	nonce = resp.Header.Get("Replay-Nonce")
-	return nonce, nil
+	return resp.Header.Get("Replay-Nonce"), nil
 }
 
 // Helper function to perform an http post request and read the body.
@@ -173,7 +326,15 @@ func (c Client) postRaw(retryCount int, requestURL, kid string, privateKey crypt
 		return nil, nil, err
 	}
 
-	data, err := jwsEncodeJSON(payload, privateKey, keyID(kid), nonce, requestURL)
+	if payload != noPayload {
+		b, err := c.jsonCodec().Marshal(payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("acme: error encoding json payload: %v", err)
+		}
+		payload = json.RawMessage(b)
+	}
+
+	data, err := jwsEncodeJSON(c.random(), payload, privateKey, keyID(kid), nonce, requestURL)
 	if err != nil {
 		return nil, nil, fmt.Errorf("acme: error encoding json payload: %v", err)
 	}
@@ -204,6 +365,17 @@ func (c Client) postRaw(retryCount int, requestURL, kid string, privateKey crypt
 			// only retry if error is badNonce
 			return c.postRaw(retryCount+1, requestURL, kid, privateKey, payload, expectedStatus)
 		}
+		if strings.HasSuffix(prob.Type, ":userActionRequired") && kid != "" && c.termsAgreement != nil {
+			// the account must agree to new terms of service, retry if the application agrees to them
+			termsURL := fetchLink(resp, "terms-of-service")
+			if termsURL == "" || !c.termsAgreement(kid, termsURL) {
+				return resp, nil, err
+			}
+			if err := c.agreeTermsOfService(retryCount+1, kid, privateKey); err != nil {
+				return resp, nil, err
+			}
+			return c.postRaw(retryCount+1, requestURL, kid, privateKey, payload, expectedStatus)
+		}
 		return resp, nil, err
 	}
 
@@ -215,6 +387,20 @@ func (c Client) postRaw(retryCount int, requestURL, kid string, privateKey crypt
 	return resp, body, nil
 }
 
+// Helper function to agree to the current terms of service on an account.
+// See https://tools.ietf.org/html/rfc8555#section-7.3.3
+func (c Client) agreeTermsOfService(retryCount int, accountURL string, privateKey crypto.Signer) error {
+	agreeReq := struct {
+		TermsOfServiceAgreed bool `json:"termsOfServiceAgreed"`
+	}{
+		TermsOfServiceAgreed: true,
+	}
+	if _, _, err := c.postRaw(retryCount, accountURL, accountURL, privateKey, agreeReq, []int{http.StatusOK}); err != nil {
+		return fmt.Errorf("acme: error agreeing to terms of service: %v", err)
+	}
+	return nil
+}
+
 // Helper function for performing a http post to an acme resource.
 func (c Client) post(requestURL, keyID string, privateKey crypto.Signer, payload interface{}, out interface{}, expectedStatus ...int) (*http.Response, error) {
 	resp, body, err := c.postRaw(0, requestURL, keyID, privateKey, payload, expectedStatus)
@@ -229,7 +415,7 @@ func (c Client) post(requestURL, keyID string, privateKey crypto.Signer, payload
 	}
 
 	if len(body) > 0 && out != nil {
-		if err := json.Unmarshal(body, out); err != nil {
+		if err := c.jsonCodec().Unmarshal(body, out); err != nil {
 			return resp, fmt.Errorf("acme: error parsing response: %v - %s", err, string(body))
 		}
 	}
@@ -262,6 +448,29 @@ func fetchLink(resp *http.Response, wantedLink string) string {
 	return ""
 }
 
+// Parses a Retry-After http header from a http response, in either delay-seconds or HTTP-date format.
+// Returns the zero time if the header is not present or invalid.
+// See https://tools.ietf.org/html/rfc7231#section-7.1.3
+func fetchRetryAfter(resp *http.Response, now time.Time) time.Time {
+	if resp == nil {
+		return time.Time{}
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return time.Time{}
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(secs) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
 // FetchRaw is a helper function to assist with POST-AS-GET requests
 func (c Client) Fetch(account Account, requestURL string, result interface{}, expectedStatus ...int) error {
 	if len(expectedStatus) == 0 {
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -13,6 +15,35 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestStagingDirectory(t *testing.T) {
+	tests := []struct {
+		production string
+		staging    string
+	}{
+		{production: LetsEncryptProduction, staging: LetsEncryptStaging},
+		{production: BuypassProduction, staging: BuypassStaging},
+		{production: GoogleProduction, staging: GoogleStaging},
+	}
+
+	for _, ct := range tests {
+		staging, ok := StagingDirectory(ct.production)
+		if !ok || staging != ct.staging {
+			t.Errorf("staging directory for %s expected %s, got: %s %t", ct.production, ct.staging, staging, ok)
+		}
+		production, ok := ProductionDirectory(ct.staging)
+		if !ok || production != ct.production {
+			t.Errorf("production directory for %s expected %s, got: %s %t", ct.staging, ct.production, production, ok)
+		}
+	}
+
+	if _, ok := StagingDirectory(ZeroSSLProduction); ok {
+		t.Error("expected no staging directory for zerossl")
+	}
+	if _, ok := ProductionDirectory(LetsEncryptProduction); ok {
+		t.Error("expected production directory to not be a staging directory")
+	}
+}
+
 func TestFetchLink(t *testing.T) {
 	linkTests := []struct {
 		Name        string
@@ -96,8 +127,8 @@ func TestFetchLinks(t *testing.T) {
 }
 
 func TestClient_Directory(t *testing.T) {
-	if !reflect.DeepEqual(testClient.dir, testClient.Directory()) {
-		t.Fatalf("directory mismatch, expected: %+v, got: %+v", testClient.dir, testClient.Directory())
+	if !reflect.DeepEqual(testClient.dir.directory, testClient.Directory()) {
+		t.Fatalf("directory mismatch, expected: %+v, got: %+v", testClient.dir.directory, testClient.Directory())
 	}
 }
 
@@ -119,3 +150,100 @@ func TestClient_Fetch(t *testing.T) {
 		t.Errorf("error post-as-get newnonce url: %v", err)
 	}
 }
+
+func TestFetchRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   string
+		expected time.Time
+	}{
+		{name: "none"},
+		{name: "seconds", header: "120", expected: now.Add(2 * time.Minute)},
+		{name: "http date", header: "Thu, 02 Jan 2020 04:00:00 GMT", expected: time.Date(2020, 1, 2, 4, 0, 0, 0, time.UTC)},
+		{name: "negative", header: "-5"},
+		{name: "invalid", header: "soon"},
+	}
+
+	for _, ct := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if ct.header != "" {
+			resp.Header.Set("Retry-After", ct.header)
+		}
+		if got := fetchRetryAfter(resp, now); !got.Equal(ct.expected) {
+			t.Errorf("%s: expected %v, got %v", ct.name, ct.expected, got)
+		}
+	}
+
+	if got := fetchRetryAfter(nil, now); !got.IsZero() {
+		t.Errorf("expected zero time for nil response, got %v", got)
+	}
+}
+
+func TestClient_pollDelay(t *testing.T) {
+	interval := time.Second
+	later := time.Now().Add(time.Hour)
+	sooner := time.Now().Add(100 * time.Millisecond)
+	end := time.Now().Add(2 * time.Hour)
+
+	tests := []struct {
+		name       string
+		min, max   time.Duration
+		retryAfter time.Time
+		end        time.Time
+		atLeast    time.Duration
+		atMost     time.Duration
+	}{
+		{name: "no retry after", atLeast: interval, atMost: interval},
+		{name: "later retry after", retryAfter: time.Now().Add(30 * time.Second), atLeast: 29 * time.Second, atMost: 30 * time.Second},
+		{name: "default max", retryAfter: later, atLeast: defaultRetryAfterMax, atMost: defaultRetryAfterMax},
+		{name: "large max", max: 2 * time.Hour, retryAfter: later, atLeast: 59 * time.Minute, atMost: time.Hour},
+		{name: "sooner retry after", retryAfter: sooner, atLeast: interval, atMost: interval},
+		{name: "clamp max", max: 10 * time.Second, retryAfter: later, atLeast: 10 * time.Second, atMost: 10 * time.Second},
+		{name: "clamp min", min: 50 * time.Millisecond, retryAfter: sooner, atLeast: 50 * time.Millisecond, atMost: 100 * time.Millisecond},
+		{name: "clamp min no retry after", min: 5 * time.Second, atLeast: 5 * time.Second, atMost: 5 * time.Second},
+		{name: "clamp end", retryAfter: later, end: time.Now().Add(5 * time.Second), atLeast: 4 * time.Second, atMost: 5 * time.Second},
+		{name: "clamp end max", max: 2 * time.Hour, retryAfter: later, end: time.Now().Add(5 * time.Second), atLeast: 4 * time.Second, atMost: 5 * time.Second},
+		{name: "past end", retryAfter: later, end: time.Now().Add(-time.Second), atLeast: 0, atMost: 0},
+	}
+
+	for _, ct := range tests {
+		if ct.end.IsZero() {
+			ct.end = end
+		}
+		c := Client{retryAfterMin: ct.min, retryAfterMax: ct.max}
+		d := c.pollDelay(interval, ct.retryAfter, ct.end)
+		if d < ct.atLeast || d > ct.atMost {
+			t.Errorf("%s: expected delay between %v and %v, got %v", ct.name, ct.atLeast, ct.atMost, d)
+		}
+	}
+}
+
+func TestClient_concurrent(t *testing.T) {
+	account := makeAccount(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			order, err := testClient.NewOrderDomains(account, randString()+".com")
+			if err != nil {
+				t.Errorf("unexpected error creating order: %v", err)
+				return
+			}
+			if _, err := testClient.FetchOrder(account, order.URL); err != nil {
+				t.Errorf("unexpected error fetching order: %v", err)
+				return
+			}
+			for _, authURL := range order.Authorizations {
+				if _, err := testClient.FetchAuthorization(account, authURL); err != nil {
+					t.Errorf("unexpected error fetching authorization: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
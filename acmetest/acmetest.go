@@ -0,0 +1,138 @@
+// Package acmetest provides helpers for fabricating acme resources for use in unit tests.
+//
+// The fabricated resources have realistic statuses, expiry times and urls underneath BaseURL, but do not exist on
+// any acme server.
+package acmetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+// BaseURL is the base url of all fabricated resource urls.
+const BaseURL = "https://acme.example.com"
+
+// Validity is the duration until fabricated orders and authorizations expire.
+const Validity = 7 * 24 * time.Hour
+
+var lastID uint64
+
+// Helper function to provide a unique identifier for each fabricated resource.
+func nextID() uint64 {
+	return atomic.AddUint64(&lastID, 1)
+}
+
+// Helper function to create a random challenge token.
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("acmetest: error creating token: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewAccount fabricates a valid account with a newly generated P-256 private key.
+func NewAccount() acme.Account {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("acmetest: error generating account key: %v", err))
+	}
+
+	thumbprint, err := acme.JWKThumbprint(privKey.Public())
+	if err != nil {
+		panic(fmt.Sprintf("acmetest: error computing account thumbprint: %v", err))
+	}
+
+	id := nextID()
+	return acme.Account{
+		Status:     "valid",
+		Orders:     fmt.Sprintf("%s/acme/orders/%d", BaseURL, id),
+		URL:        fmt.Sprintf("%s/acme/acct/%d", BaseURL, id),
+		PrivateKey: privKey,
+		Thumbprint: thumbprint,
+	}
+}
+
+// NewOrder fabricates a pending order for the account with an authorization url per identifier.
+// If no identifiers are provided, a single dns identifier for "example.com" is used.
+func NewOrder(account acme.Account, identifiers ...acme.Identifier) acme.Order {
+	order, _ := NewOrderAuthorizations(account, identifiers...)
+	return order
+}
+
+// NewOrderAuthorizations fabricates a pending order for the account as per NewOrder, along with the pending
+// authorizations the order's authorization urls refer to, in the same order.
+func NewOrderAuthorizations(account acme.Account, identifiers ...acme.Identifier) (acme.Order, []acme.Authorization) {
+	if len(identifiers) == 0 {
+		identifiers = []acme.Identifier{{Type: "dns", Value: "example.com"}}
+	}
+
+	id := nextID()
+	order := acme.Order{
+		Status:      "pending",
+		Expires:     time.Now().Add(Validity).UTC().Truncate(time.Second),
+		Identifiers: identifiers,
+		Finalize:    fmt.Sprintf("%s/acme/finalize/%d", BaseURL, id),
+		URL:         fmt.Sprintf("%s/acme/order/%d", BaseURL, id),
+	}
+	var auths []acme.Authorization
+	for _, identifier := range identifiers {
+		auth := NewAuthorization(account, identifier)
+		order.Authorizations = append(order.Authorizations, auth.URL)
+		auths = append(auths, auth)
+	}
+
+	return order, auths
+}
+
+// NewAuthorization fabricates a pending authorization for an identifier with pending http-01, dns-01 and
+// tls-alpn-01 challenges, as returned by Client.FetchAuthorization.
+// Wildcard identifiers only include a dns-01 challenge.
+func NewAuthorization(account acme.Account, identifier acme.Identifier) acme.Authorization {
+	auth := acme.Authorization{
+		Identifier: identifier,
+		Status:     "pending",
+		Expires:    time.Now().Add(Validity).UTC().Truncate(time.Second),
+		URL:        fmt.Sprintf("%s/acme/authz/%d", BaseURL, nextID()),
+	}
+
+	challengeTypes := []string{acme.ChallengeTypeHTTP01, acme.ChallengeTypeDNS01, acme.ChallengeTypeTLSALPN01}
+	if strings.HasPrefix(identifier.Value, "*.") {
+		auth.Identifier.Value = strings.TrimPrefix(identifier.Value, "*.")
+		auth.Wildcard = true
+		challengeTypes = []string{acme.ChallengeTypeDNS01}
+	}
+
+	auth.ChallengeMap = map[string]acme.Challenge{}
+	auth.ChallengeTypes = []string{}
+	for _, t := range challengeTypes {
+		chal := NewChallenge(account, t)
+		chal.AuthorizationURL = auth.URL
+		auth.Challenges = append(auth.Challenges, chal)
+		auth.ChallengeMap[t] = chal
+		auth.ChallengeTypes = append(auth.ChallengeTypes, t)
+	}
+
+	return auth
+}
+
+// NewChallenge fabricates a pending challenge of the given type with a random token and key authorization for the
+// account.
+func NewChallenge(account acme.Account, challengeType string) acme.Challenge {
+	token := newToken()
+	return acme.Challenge{
+		Type:             challengeType,
+		URL:              fmt.Sprintf("%s/acme/chall/%d", BaseURL, nextID()),
+		Status:           "pending",
+		Token:            token,
+		KeyAuthorization: token + "." + account.Thumbprint,
+	}
+}
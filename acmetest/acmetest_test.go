@@ -0,0 +1,88 @@
+package acmetest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+func TestNewAccount(t *testing.T) {
+	a1 := NewAccount()
+	a2 := NewAccount()
+
+	if a1.URL == a2.URL {
+		t.Fatalf("expected unique account urls, got: %s", a1.URL)
+	}
+	if !strings.HasPrefix(a1.URL, BaseURL) {
+		t.Fatalf("unexpected account url: %s", a1.URL)
+	}
+	if a1.PrivateKey == nil || a1.Thumbprint == "" {
+		t.Fatalf("missing key or thumbprint: %+v", a1)
+	}
+}
+
+func TestNewOrder(t *testing.T) {
+	account := NewAccount()
+
+	order := NewOrder(account)
+	if len(order.Identifiers) != 1 || len(order.Authorizations) != 1 {
+		t.Fatalf("expected 1 identifier and authorization, got: %+v", order)
+	}
+
+	ids := []acme.Identifier{{Type: "dns", Value: "a.com"}, {Type: "dns", Value: "b.com"}}
+	order = NewOrder(account, ids...)
+	if len(order.Authorizations) != len(ids) {
+		t.Fatalf("expected %d authorizations, got: %d", len(ids), len(order.Authorizations))
+	}
+	if order.Status != "pending" || order.Expires.Before(time.Now()) {
+		t.Fatalf("unexpected order status or expiry: %+v", order)
+	}
+}
+
+func TestNewOrderAuthorizations(t *testing.T) {
+	account := NewAccount()
+
+	ids := []acme.Identifier{{Type: "dns", Value: "a.com"}, {Type: "dns", Value: "*.b.com"}}
+	order, auths := NewOrderAuthorizations(account, ids...)
+	if len(auths) != len(ids) || len(order.Authorizations) != len(ids) {
+		t.Fatalf("expected %d authorizations, got: %d and %d", len(ids), len(auths), len(order.Authorizations))
+	}
+	for i, auth := range auths {
+		if order.Authorizations[i] != auth.URL {
+			t.Fatalf("expected authorization url %s, got: %s", auth.URL, order.Authorizations[i])
+		}
+		chal := auth.Challenges[0]
+		if chal.KeyAuthorization != chal.Token+"."+account.Thumbprint {
+			t.Fatalf("unexpected key authorization: %s", chal.KeyAuthorization)
+		}
+	}
+	if !auths[1].Wildcard {
+		t.Fatalf("expected wildcard authorization, got: %+v", auths[1])
+	}
+}
+
+func TestNewAuthorization(t *testing.T) {
+	account := NewAccount()
+
+	auth := NewAuthorization(account, acme.Identifier{Type: "dns", Value: "example.com"})
+	if len(auth.Challenges) != 3 || len(auth.ChallengeMap) != 3 || len(auth.ChallengeTypes) != 3 {
+		t.Fatalf("expected 3 challenges, got: %+v", auth)
+	}
+	chal := auth.ChallengeMap[acme.ChallengeTypeHTTP01]
+	if chal.KeyAuthorization != chal.Token+"."+account.Thumbprint {
+		t.Fatalf("unexpected key authorization: %s", chal.KeyAuthorization)
+	}
+	if chal.AuthorizationURL != auth.URL {
+		t.Fatalf("expected authorization url %s, got: %s", auth.URL, chal.AuthorizationURL)
+	}
+
+	wildcard := NewAuthorization(account, acme.Identifier{Type: "dns", Value: "*.example.com"})
+	if !wildcard.Wildcard || wildcard.Identifier.Value != "example.com" {
+		t.Fatalf("unexpected wildcard authorization: %+v", wildcard)
+	}
+	if _, ok := wildcard.ChallengeMap[acme.ChallengeTypeDNS01]; !ok || len(wildcard.Challenges) != 1 {
+		t.Fatalf("expected only dns-01 challenge, got: %v", wildcard.ChallengeTypes)
+	}
+}
@@ -0,0 +1,106 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RenewalInfo object returned when fetching the renewal information of a certificate.
+// See https://datatracker.ietf.org/doc/draft-ietf-acme-ari/
+type RenewalInfo struct {
+	SuggestedWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"suggestedWindow"`
+
+	// A url with more information about the suggested window, eg an incident report for a mass revocation.
+	ExplanationURL string `json:"explanationURL,omitempty"`
+
+	// RetryAfter is the time provided by the Retry-After http header, after which renewal info should be fetched again.
+	// Not fetched from server.
+	RetryAfter time.Time `json:"-"`
+}
+
+// EncodeBase64URL encodes data as unpadded base64url, the encoding used throughout acme, eg in ARI unique identifiers.
+func EncodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeBase64URL decodes base64url encoded data, with or without padding.
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// ARICertID returns the ARI unique identifier of a certificate, as used to fetch its renewal info and in the replaces
+// field of a new order, see NewOrderOptReplaces.
+// The identifier is the base64url encoded authority key identifier and serial number of the certificate, joined by a
+// period. It is the same for any client, so can be used to look up or deduplicate certificates.
+func ARICertID(cert *x509.Certificate) (string, error) {
+	if cert == nil {
+		return "", errors.New("acme: no certificate")
+	}
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", errors.New("acme: certificate has no authority key identifier")
+	}
+	if cert.SerialNumber == nil || cert.SerialNumber.Sign() <= 0 {
+		return "", errors.New("acme: certificate has no valid serial number")
+	}
+
+	return EncodeBase64URL(cert.AuthorityKeyId) + "." + EncodeBase64URL(serialBytes(cert.SerialNumber)), nil
+}
+
+// ParseARICertID returns the authority key identifier and serial number of an ARI unique identifier.
+func ParseARICertID(certID string) ([]byte, *big.Int, error) {
+	parts := strings.Split(certID, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, nil, fmt.Errorf("acme: invalid ari certificate identifier: %q", certID)
+	}
+
+	keyID, err := DecodeBase64URL(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("acme: invalid ari authority key identifier %q: %v", parts[0], err)
+	}
+	serial, err := DecodeBase64URL(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("acme: invalid ari serial number %q: %v", parts[1], err)
+	}
+
+	return keyID, new(big.Int).SetBytes(serial), nil
+}
+
+// FetchRenewalInfo fetches the renewal info of a certificate given its ARI unique identifier, see ARICertID.
+func (c Client) FetchRenewalInfo(certID string) (RenewalInfo, error) {
+	renewalInfo := RenewalInfo{}
+
+	renewalInfoURL := c.Directory().RenewalInfo
+	if renewalInfoURL == "" {
+		return renewalInfo, errors.New("acme: renewal info unsupported by server")
+	}
+	if _, _, err := ParseARICertID(certID); err != nil {
+		return renewalInfo, err
+	}
+
+	resp, err := c.get(strings.TrimSuffix(renewalInfoURL, "/")+"/"+certID, &renewalInfo, http.StatusOK)
+	if err != nil {
+		return renewalInfo, err
+	}
+	renewalInfo.RetryAfter = fetchRetryAfter(resp, time.Now())
+
+	return renewalInfo, nil
+}
+
+// Helper function to get the DER encoded contents of a serial number, ie big endian with a leading zero byte if the
+// high bit is set so it is not interpreted as negative.
+func serialBytes(serial *big.Int) []byte {
+	b := serial.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
@@ -0,0 +1,97 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestARICertID(t *testing.T) {
+	// example from https://datatracker.ietf.org/doc/draft-ietf-acme-ari/ section 4.1
+	cert := &x509.Certificate{
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3,
+			0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4},
+		SerialNumber: big.NewInt(0x87654321),
+	}
+
+	certID, err := ARICertID(cert)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"; certID != expected {
+		t.Fatalf("expected cert id %s, got: %s", expected, certID)
+	}
+
+	keyID, serial, err := ParseARICertID(certID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(keyID, cert.AuthorityKeyId) || serial.Cmp(cert.SerialNumber) != 0 {
+		t.Fatalf("unexpected parsed cert id: %x %s", keyID, serial)
+	}
+
+	if _, err := ARICertID(&x509.Certificate{SerialNumber: big.NewInt(1)}); err == nil {
+		t.Fatal("expected error for certificate without authority key id, got none")
+	}
+	for _, invalid := range []string{"", "abc", "abc.", ".abc", "a.b.c", "!!.abc"} {
+		if _, _, err := ParseARICertID(invalid); err == nil {
+			t.Errorf("expected error parsing %q, got none", invalid)
+		}
+	}
+}
+
+func TestDecodeBase64URL(t *testing.T) {
+	for _, s := range []string{"AIdlQyE", "AIdlQyE="} {
+		b, err := DecodeBase64URL(s)
+		if err != nil {
+			t.Fatalf("unexpected error decoding %q: %v", s, err)
+		}
+		if EncodeBase64URL(b) != "AIdlQyE" {
+			t.Fatalf("unexpected round trip of %q: %s", s, EncodeBase64URL(b))
+		}
+	}
+}
+
+func TestClient_FetchRenewalInfo(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"renewalInfo":"` + srv.URL + `/renewal-info"}`))
+		case "/renewal-info/aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE":
+			w.Header().Set("Retry-After", "21600")
+			_, _ = w.Write([]byte(`{"suggestedWindow":{"start":"2025-01-02T04:00:00Z","end":"2025-01-03T04:00:00Z"},` +
+				`"explanationURL":"https://acme.example.com/docs/ari"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	ri, err := c.FetchRenewalInfo("aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ri.SuggestedWindow.Start.Equal(time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC)) || ri.ExplanationURL == "" {
+		t.Fatalf("unexpected renewal info: %+v", ri)
+	}
+	if ri.RetryAfter.IsZero() {
+		t.Fatal("expected retry after to be set")
+	}
+
+	if _, err := c.FetchRenewalInfo("invalid"); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if _, err := (Client{}).FetchRenewalInfo("aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"); err == nil {
+		t.Fatal("expected error without renewal info endpoint, got none")
+	}
+}
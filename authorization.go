@@ -1,33 +1,79 @@
 package acme
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+)
 
 // FetchAuthorization fetches an authorization from an authorization url provided in an order.
 func (c Client) FetchAuthorization(account Account, authURL string) (Authorization, error) {
 	authResp := Authorization{}
-	_, err := c.post(authURL, account.URL, account.PrivateKey, "", &authResp, http.StatusOK)
+	var wireAuth wireAuthorization
+	_, err := c.post(authURL, account.URL, account.PrivateKey, "", &wireAuth, http.StatusOK)
 	if err != nil {
 		return authResp, err
 	}
+	if err := wireAuth.apply(&authResp); err != nil {
+		return authResp, err
+	}
 
-	for i := 0; i < len(authResp.Challenges); i++ {
-		if authResp.Challenges[i].KeyAuthorization == "" {
-			authResp.Challenges[i].KeyAuthorization = authResp.Challenges[i].Token + "." + account.Thumbprint
-		}
+	authResp.URL = authURL
+	populateChallenges(&authResp, account)
+
+	return authResp, nil
+}
+
+// NewAuthorization creates a new authorization for an identifier ahead of creating an order, known as
+// pre-authorization. Not all acme servers support pre-authorization, in which case the directory has no newAuthz url.
+// See https://tools.ietf.org/html/rfc8555#section-7.4.1
+func (c Client) NewAuthorization(account Account, identifier Identifier) (Authorization, error) {
+	if c.Directory().NewAuthz == "" {
+		return Authorization{}, errors.New("acme: server does not support pre-authorization, no newAuthz url")
+	}
+	if err := c.checkIdentifiers([]Identifier{identifier}); err != nil {
+		return Authorization{}, err
 	}
 
-	authResp.ChallengeMap = map[string]Challenge{}
-	authResp.ChallengeTypes = []string{}
-	for _, c := range authResp.Challenges {
-		authResp.ChallengeMap[c.Type] = c
-		authResp.ChallengeTypes = append(authResp.ChallengeTypes, c.Type)
+	newAuthzReq := struct {
+		Identifier Identifier `json:"identifier"`
+	}{
+		Identifier: identifier,
+	}
+	authResp := Authorization{}
+	var wireAuth wireAuthorization
+	resp, err := c.post(c.Directory().NewAuthz, account.URL, account.PrivateKey, newAuthzReq, &wireAuth, http.StatusCreated)
+	if err != nil {
+		return authResp, err
+	}
+	if err := wireAuth.apply(&authResp); err != nil {
+		return authResp, err
 	}
 
-	authResp.URL = authURL
+	authResp.URL = resp.Header.Get("Location")
+	if authResp.URL == "" {
+		return authResp, errors.New("acme: no authorization url provided in Location header")
+	}
+	populateChallenges(&authResp, account)
 
 	return authResp, nil
 }
 
+// Helper function to fill in challenge key authorizations and the convenience challenge fields of an authorization.
+func populateChallenges(auth *Authorization, account Account) {
+	for i := 0; i < len(auth.Challenges); i++ {
+		if auth.Challenges[i].KeyAuthorization == "" {
+			auth.Challenges[i].KeyAuthorization = auth.Challenges[i].Token + "." + account.Thumbprint
+		}
+	}
+
+	auth.ChallengeMap = map[string]Challenge{}
+	auth.ChallengeTypes = []string{}
+	for _, c := range auth.Challenges {
+		auth.ChallengeMap[c.Type] = c
+		auth.ChallengeTypes = append(auth.ChallengeTypes, c.Type)
+	}
+}
+
 // DeactivateAuthorization deactivate a provided authorization url from an order.
 func (c Client) DeactivateAuthorization(account Account, authURL string) (Authorization, error) {
 	deactivateReq := struct {
@@ -35,9 +81,15 @@ func (c Client) DeactivateAuthorization(account Account, authURL string) (Author
 	}{
 		Status: "deactivated",
 	}
-	deactivateResp := Authorization{}
+	deactivateResp := Authorization{
+		URL: authURL,
+	}
 
-	_, err := c.post(authURL, account.URL, account.PrivateKey, deactivateReq, &deactivateResp, http.StatusOK)
+	var wireAuth wireAuthorization
+	if _, err := c.post(authURL, account.URL, account.PrivateKey, deactivateReq, &wireAuth, http.StatusOK); err != nil {
+		return deactivateResp, err
+	}
+	err := wireAuth.apply(&deactivateResp)
 
 	return deactivateResp, err
 }
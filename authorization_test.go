@@ -27,4 +27,29 @@ func TestClient_DeactivateAuthorization(t *testing.T) {
 	if auth.Status != "deactivated" {
 		t.Fatalf("expected deactivated status, got: %s", auth.Status)
 	}
+	if auth.URL != order.Authorizations[0] {
+		t.Fatalf("expected authorization url %s, got: %s", order.Authorizations[0], auth.URL)
+	}
+}
+
+func TestClient_NewAuthorization(t *testing.T) {
+	account := makeAccount(t)
+	identifier := Identifier{Type: "dns", Value: randString() + ".com"}
+
+	auth, err := testClient.NewAuthorization(account, identifier)
+	if testClient.Directory().NewAuthz == "" {
+		if err == nil {
+			t.Fatal("expected error without newAuthz url, got none")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error creating authorization: %v", err)
+	}
+	if auth.URL == "" {
+		t.Fatal("no authorization url")
+	}
+	if len(auth.ChallengeMap) == 0 {
+		t.Fatal("no challenges on auth")
+	}
 }
@@ -0,0 +1,150 @@
+package acme
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrderAuthorization describes an authorization of an order, and whether it was reused from a previous order.
+type OrderAuthorization struct {
+	URL        string
+	Identifier Identifier
+	Status     string
+	Expires    time.Time
+	Wildcard   bool
+
+	// Whether the authorization was already valid when the order was created, so no challenge needs to be solved.
+	Reused bool
+}
+
+// FetchOrderAuthorizations fetches each authorization of an order, describing which were reused, ie already valid,
+// and which were freshly created and need a challenge to be solved, along with their expiries.
+// This should be called before solving any challenges, as afterwards every authorization is valid.
+func (c Client) FetchOrderAuthorizations(account Account, order Order) ([]OrderAuthorization, error) {
+	var auths []OrderAuthorization
+	for _, authURL := range order.Authorizations {
+		auth, err := c.FetchAuthorization(account, authURL)
+		if err != nil {
+			return auths, fmt.Errorf("acme: error fetching authorization %s: %v", authURL, err)
+		}
+		auths = append(auths, OrderAuthorization{
+			URL:        authURL,
+			Identifier: auth.Identifier,
+			Status:     auth.Status,
+			Expires:    auth.Expires,
+			Wildcard:   auth.Wildcard,
+			Reused:     auth.Status == "valid",
+		})
+	}
+	return auths, nil
+}
+
+// AuthorizationPlanner tracks the valid authorizations of an account, as observed on orders, so that bulk issuance
+// can group identifiers into orders which reuse them before they expire.
+// The zero value is usable. An AuthorizationPlanner is safe for concurrent use and must not be copied after first use.
+type AuthorizationPlanner struct {
+	// Minimum amount of time an authorization must have before it expires to be considered reusable, allowing time
+	// for the order to be created and finalized. Default 1 hour if not set or if set to 0.
+	Margin time.Duration
+
+	lock  sync.Mutex
+	valid map[string]time.Time
+}
+
+// Observe records the valid authorizations of an order, eg as returned by FetchOrderAuthorizations, or once its
+// challenges have been solved.
+func (ap *AuthorizationPlanner) Observe(auths []OrderAuthorization) {
+	ap.lock.Lock()
+	defer ap.lock.Unlock()
+
+	if ap.valid == nil {
+		ap.valid = map[string]time.Time{}
+	}
+	for _, auth := range auths {
+		key := identifierKey(auth.Identifier, auth.Wildcard)
+		if auth.Status != "valid" {
+			delete(ap.valid, key)
+			continue
+		}
+		ap.valid[key] = auth.Expires
+	}
+}
+
+// Reusable returns the expiry of a valid authorization for an identifier, and whether it is reusable at the given
+// time. Wildcard identifiers are given with a "*." prefix, as in an order.
+func (ap *AuthorizationPlanner) Reusable(id Identifier, at time.Time) (time.Time, bool) {
+	ap.lock.Lock()
+	defer ap.lock.Unlock()
+
+	wildcard := strings.HasPrefix(id.Value, "*.")
+	if wildcard {
+		id.Value = strings.TrimPrefix(id.Value, "*.")
+	}
+	expires, ok := ap.valid[identifierKey(id, wildcard)]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	margin := ap.Margin
+	if margin == 0 {
+		margin = time.Hour
+	}
+	// authorizations without an expiry are assumed reusable
+	return expires, expires.IsZero() || expires.After(at.Add(margin))
+}
+
+// Plan groups identifiers into orders of at most maxPerOrder identifiers, or a single order if maxPerOrder is less
+// than 1. Identifiers with reusable authorizations at the given time are grouped together, soonest expiry first, so
+// they are used before they expire and orders which need challenges solved are kept separate.
+func (ap *AuthorizationPlanner) Plan(identifiers []Identifier, maxPerOrder int, at time.Time) [][]Identifier {
+	type planned struct {
+		id      Identifier
+		expires time.Time
+	}
+	var reusable []planned
+	var fresh []Identifier
+	for _, id := range identifiers {
+		if expires, ok := ap.Reusable(id, at); ok {
+			reusable = append(reusable, planned{id, expires})
+		} else {
+			fresh = append(fresh, id)
+		}
+	}
+	sort.SliceStable(reusable, func(i, j int) bool {
+		// zero expiries last
+		if reusable[i].expires.IsZero() || reusable[j].expires.IsZero() {
+			return !reusable[i].expires.IsZero()
+		}
+		return reusable[i].expires.Before(reusable[j].expires)
+	})
+
+	ordered := make([]Identifier, 0, len(identifiers))
+	for _, r := range reusable {
+		ordered = append(ordered, r.id)
+	}
+
+	var orders [][]Identifier
+	for _, group := range [][]Identifier{ordered, fresh} {
+		for len(group) > 0 {
+			n := len(group)
+			if maxPerOrder > 0 && n > maxPerOrder {
+				n = maxPerOrder
+			}
+			orders = append(orders, group[:n])
+			group = group[n:]
+		}
+	}
+	return orders
+}
+
+// Helper function to get a case insensitive key for an identifier, as authorized by an authorization.
+func identifierKey(id Identifier, wildcard bool) string {
+	key := id.Type + ":" + strings.ToLower(id.Value)
+	if wildcard {
+		key += ":wildcard"
+	}
+	return key
+}
@@ -0,0 +1,102 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_FetchOrderAuthorizations(t *testing.T) {
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce"}`))
+		case "/nonce":
+		case "/authz/1":
+			_, _ = w.Write([]byte(`{"identifier":{"type":"dns","value":"a.example.com"},"status":"valid","expires":"` +
+				expires.Format(time.RFC3339) + `","challenges":[]}`))
+		case "/authz/2":
+			_, _ = w.Write([]byte(`{"identifier":{"type":"dns","value":"example.com"},"status":"pending","wildcard":true,` +
+				`"challenges":[{"type":"dns-01","url":"` + srv.URL + `/chal/2","status":"pending","token":"token"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account := Account{URL: srv.URL + "/acct", PrivateKey: makePrivateKey(t)}
+
+	auths, err := c.FetchOrderAuthorizations(account, Order{Authorizations: []string{srv.URL + "/authz/1", srv.URL + "/authz/2"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []OrderAuthorization{
+		{URL: srv.URL + "/authz/1", Identifier: Identifier{Type: "dns", Value: "a.example.com"}, Status: "valid", Expires: expires, Reused: true},
+		{URL: srv.URL + "/authz/2", Identifier: Identifier{Type: "dns", Value: "example.com"}, Status: "pending", Wildcard: true},
+	}
+	if !reflect.DeepEqual(auths, expected) {
+		t.Fatalf("expected: %+v, got: %+v", expected, auths)
+	}
+
+	if _, err := c.FetchOrderAuthorizations(account, Order{Authorizations: []string{srv.URL + "/authz/missing"}}); err == nil {
+		t.Fatal("expected error fetching missing authorization, got none")
+	}
+}
+
+func TestAuthorizationPlanner(t *testing.T) {
+	now := time.Now()
+	dns := func(value string) Identifier { return Identifier{Type: "dns", Value: value} }
+
+	ap := &AuthorizationPlanner{}
+	ap.Observe([]OrderAuthorization{
+		{Identifier: dns("late.example.com"), Status: "valid", Expires: now.Add(48 * time.Hour)},
+		{Identifier: dns("SOON.example.com"), Status: "valid", Expires: now.Add(2 * time.Hour)},
+		{Identifier: dns("expiring.example.com"), Status: "valid", Expires: now.Add(time.Minute)},
+		{Identifier: dns("example.com"), Status: "valid", Wildcard: true, Expires: now.Add(48 * time.Hour)},
+		{Identifier: dns("pending.example.com"), Status: "pending", Expires: now.Add(48 * time.Hour)},
+	})
+
+	if _, ok := ap.Reusable(dns("soon.example.com"), now); !ok {
+		t.Fatal("expected authorization to be reusable regardless of case")
+	}
+	if _, ok := ap.Reusable(dns("expiring.example.com"), now); ok {
+		t.Fatal("expected authorization expiring within the margin not to be reusable")
+	}
+	if _, ok := ap.Reusable(dns("*.example.com"), now); !ok {
+		t.Fatal("expected wildcard authorization to be reusable")
+	}
+	if _, ok := ap.Reusable(dns("example.com"), now); ok {
+		t.Fatal("expected wildcard authorization not to authorize the base domain")
+	}
+
+	ids := []Identifier{dns("new.example.com"), dns("late.example.com"), dns("expiring.example.com"),
+		dns("soon.example.com"), dns("pending.example.com"), dns("*.example.com")}
+	orders := ap.Plan(ids, 2, now)
+	expected := [][]Identifier{
+		{dns("soon.example.com"), dns("late.example.com")},
+		{dns("*.example.com")},
+		{dns("new.example.com"), dns("expiring.example.com")},
+		{dns("pending.example.com")},
+	}
+	if !reflect.DeepEqual(orders, expected) {
+		t.Fatalf("expected orders: %+v, got: %+v", expected, orders)
+	}
+
+	// invalidated authorizations are forgotten
+	ap.Observe([]OrderAuthorization{{Identifier: dns("late.example.com"), Status: "deactivated"}})
+	if _, ok := ap.Reusable(dns("late.example.com"), now); ok {
+		t.Fatal("expected deactivated authorization not to be reusable")
+	}
+	if orders := (&AuthorizationPlanner{}).Plan(ids, 0, now); len(orders) != 1 || len(orders[0]) != len(ids) {
+		t.Fatalf("expected a single order without a maximum, got: %+v", orders)
+	}
+}
@@ -5,11 +5,8 @@ package acme
 import (
 	"context"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -59,9 +56,31 @@ type AutoCert struct {
 	// When using a staging environment, include a root certificate for verification purposes
 	RootCert string
 
+	// If set, existing certificates are verified using the preferred roots and intermediates of the CA, and only
+	// used if they chain to one of its roots, and the issued chain which verifies against it is used. Takes precedence
+	// over RootCert, which is used instead until the bundle is available. The bundle is never fetched during a
+	// handshake, instead it is refreshed in the background.
+	Bundle *BundleSource
+
 	// Called before updating challenges
 	PreUpdateChallengeHook func(Account, Challenge)
 
+	// If set, checks the http-01 challenge token can be fetched before asking the acme server to validate it
+	SelfCheck *SelfCheck
+
+	// If set, existing certificates are checked for revocation and a new certificate is issued if revoked.
+	// Certificates are still used if their revocation status is unknown. Revocation is never checked during a
+	// handshake, instead the last status found is used and a check is started in the background when it is stale, so a
+	// revoked certificate is replaced on a handshake after the check completes.
+	RevocationChecker *RevocationChecker
+
+	// If set, certificates are issued by an embedded development CA rather than DirectoryURL, for running locally with
+	// https without an acme server or network access. Single label host names such as localhost are allowed, but the CA
+	// only issues certificates for localhost, names under .test or .local, and loopback ip addresses.
+	// The root of the CA, see DevCA, must be trusted for its certificates to be trusted. If CacheDir is set the CA is
+	// stored there, so its root remains the same across restarts.
+	DevMode bool
+
 	// Mapping of token -> keyauth
 	// Protected by a mutex, but not rwmutex because tokens are deleted once read
 	tokensLock sync.RWMutex
@@ -75,11 +94,16 @@ type AutoCert struct {
 	// write lock around issuing new certificate
 	certLock sync.RWMutex
 
+	devCALock sync.Mutex
+	devCA     *DevCA
+
 	client Client
 }
 
 // HTTPHandler Wraps a handler and provides serving of http-01 challenge tokens from /.well-known/acme-challenge/
 // If handler is nil, will redirect all traffic otherwise to https
+// The returned handler must be served on port 80 of every address the acme server may connect to, eg ":80" to accept
+// both IPv4 and IPv6 connections on a dual-stack host.
 func (m *AutoCert) HTTPHandler(handler http.Handler) http.Handler {
 	if handler == nil {
 		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -118,7 +142,7 @@ func (m *AutoCert) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate,
 	if name == "" {
 		return nil, errors.New("autocert: missing server name")
 	}
-	if !strings.Contains(strings.Trim(name, "."), ".") {
+	if !m.DevMode && !strings.Contains(strings.Trim(name, "."), ".") {
 		return nil, errors.New("autocert: server name component count invalid")
 	}
 	if strings.ContainsAny(name, `/\`) {
@@ -130,20 +154,58 @@ func (m *AutoCert) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate,
 		return nil, err
 	}
 
-	// check if there's an existing cert
+	// check if there's an existing cert which isn't known to be revoked
 	m.certLock.RLock()
-	existingCert := m.getExistingCert(name)
+	existingCert, issuer := m.loadCert(name)
 	m.certLock.RUnlock()
-	if existingCert != nil {
+	if existingCert != nil && !m.isRevoked(existingCert.Leaf, issuer) {
 		return existingCert, nil
 	}
 
 	// if not, attempt to issue a new cert
 	m.certLock.Lock()
 	defer m.certLock.Unlock()
+
+	// another handshake may have issued a new cert while waiting for the lock
+	if cert, _ := m.loadCert(name); cert != nil && (existingCert == nil || !cert.Leaf.Equal(existingCert.Leaf)) {
+		return cert, nil
+	}
+
 	return m.issueCert(name)
 }
 
+// DevCA returns the embedded development CA used when DevMode is set, creating it if necessary, eg to install its
+// root in a browser or trust store.
+func (m *AutoCert) DevCA() (*DevCA, error) {
+	m.devCALock.Lock()
+	defer m.devCALock.Unlock()
+
+	if m.devCA != nil {
+		return m.devCA, nil
+	}
+
+	if data := m.getCache("devca"); len(data) > 0 {
+		ca, err := LoadDevCA(data)
+		if err != nil {
+			return nil, fmt.Errorf("autocert: error loading dev ca: %v", err)
+		}
+		m.devCA = ca
+		return ca, nil
+	}
+
+	ca, err := NewDevCA()
+	if err != nil {
+		return nil, fmt.Errorf("autocert: error creating dev ca: %v", err)
+	}
+	data, err := ca.PEM()
+	if err != nil {
+		return nil, fmt.Errorf("autocert: error encoding dev ca: %v", err)
+	}
+	<-m.putCache(data, "devca").Done()
+	m.devCA = ca
+	return ca, nil
+}
+
 func (m *AutoCert) getDirectoryURL() string {
 	if m.DirectoryURL != "" {
 		return m.DirectoryURL
@@ -213,17 +275,23 @@ func (m *AutoCert) checkHost(name string) error {
 }
 
 func (m *AutoCert) getExistingCert(name string) *tls.Certificate {
+	cert, _ := m.loadCert(name)
+	return cert
+}
+
+// Helper function to load and verify a stored cert, returning the cert and its issuer from the verified chain, if any.
+func (m *AutoCert) loadCert(name string) (*tls.Certificate, *x509.Certificate) {
 	// check for a stored cert
 	certData := m.getCache("cert", name)
 	if len(certData) == 0 {
 		// no cert
-		return nil
+		return nil, nil
 	}
 
 	privBlock, pubData := pem.Decode(certData)
 	if len(pubData) == 0 {
 		// no public key data (cert/issuer), ignore
-		return nil
+		return nil, nil
 	}
 
 	// decode pub chain
@@ -240,13 +308,13 @@ func (m *AutoCert) getExistingCert(name string) *tls.Certificate {
 	}
 	if len(pubData) > 0 {
 		// leftover data in file - possibly corrupt, ignore
-		return nil
+		return nil, nil
 	}
 
 	certs, err := x509.ParseCertificates(pub)
 	if err != nil {
 		// bad certificates, ignore
-		return nil
+		return nil, nil
 	}
 
 	leaf := certs[0]
@@ -262,35 +330,84 @@ func (m *AutoCert) getExistingCert(name string) *tls.Certificate {
 
 	// add a root certificate if present
 	var roots *x509.CertPool
-	if m.RootCert != "" {
+	if m.DevMode {
+		ca, err := m.DevCA()
+		if err != nil {
+			return nil, nil
+		}
+		roots = x509.NewCertPool()
+		roots.AddCert(ca.Root())
+	} else if m.RootCert != "" {
 		roots = x509.NewCertPool()
 		rootBlock, _ := pem.Decode([]byte(m.RootCert))
 		rootCert, err := x509.ParseCertificate(rootBlock.Bytes)
 		if err != nil {
-			return nil
+			return nil, nil
 		}
 		roots.AddCert(rootCert)
 	}
 
-	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Intermediates: intermediates, Roots: roots}); err != nil {
+	opts := x509.VerifyOptions{DNSName: name, Intermediates: intermediates, Roots: roots}
+	if m.Bundle != nil {
+		// never fetch the bundle during a handshake, and if there is no bundle yet fall back to the root cert, or the
+		// system roots if not set
+		if bundle, err := m.Bundle.cached(); err == nil {
+			opts = bundleVerifyOptions(bundle, opts)
+		}
+	}
+
+	chains, err := leaf.Verify(opts)
+	if err != nil {
 		// invalid certificates , ignore
-		return nil
+		return nil, nil
+	}
+
+	var issuer *x509.Certificate
+	if len(chains[0]) > 1 {
+		issuer = chains[0][1]
 	}
 
 	privKey, err := x509.ParseECPrivateKey(privBlock.Bytes)
 	if err != nil {
 		// invalid private key, ignore
-		return nil
+		return nil, nil
 	}
 
 	return &tls.Certificate{
 		Certificate: pubDER,
 		PrivateKey:  privKey,
 		Leaf:        leaf,
+	}, issuer
+}
+
+// Helper function to check whether a cert is known to have been revoked out of band, so a new cert is issued. Certs
+// whose revocation status is unknown are still used, and the status is checked in the background rather than during
+// the handshake.
+func (m *AutoCert) isRevoked(leaf, issuer *x509.Certificate) bool {
+	if m.RevocationChecker == nil || issuer == nil {
+		return false
 	}
+	status, ok := m.RevocationChecker.cached(leaf, issuer)
+	return ok && status.Revoked
 }
 
 func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
+	// create a new client if one doesn't exist
+	if m.client.Directory().URL == "" {
+		var err error
+		if m.DevMode {
+			var ca *DevCA
+			if ca, err = m.DevCA(); err == nil {
+				m.client, err = ca.NewClient(m.Options...)
+			}
+		} else {
+			m.client, err = NewClient(m.getDirectoryURL(), m.Options...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// attempt to load an existing account key
 	var privKey *ecdsa.PrivateKey
 	if keyData := m.getCache("account"); len(keyData) > 0 {
@@ -302,7 +419,7 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 	// otherwise generate a new one
 	if privKey == nil {
 		var err error
-		privKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		privKey, err = m.client.generateKey()
 		if err != nil {
 			return nil, fmt.Errorf("autocert: error generating new account key: %v", err)
 		}
@@ -313,15 +430,6 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 		m.putCache(pemEncoded, "account")
 	}
 
-	// create a new client if one doesn't exist
-	if m.client.Directory().URL == "" {
-		var err error
-		m.client, err = NewClient(m.getDirectoryURL(), m.Options...)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	// create/fetch acme account
 	account, err := m.client.NewAccount(privKey, false, true)
 	if err != nil {
@@ -361,6 +469,12 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 			m.PreUpdateChallengeHook(account, chal)
 		}
 
+		if m.SelfCheck != nil {
+			if err := m.SelfCheck.CheckHTTP01(auth.Identifier.Value, chal); err != nil {
+				return nil, fmt.Errorf("autocert: self check failed for %s: %v", auth.Identifier.Value, err)
+			}
+		}
+
 		chal, err = m.client.UpdateChallenge(account, chal)
 		if err != nil {
 			return nil, fmt.Errorf("autocert: error updating authorization %s challenge (Url: %s) : %v", auth.Identifier.Value, authURL, err)
@@ -372,7 +486,7 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 	}
 
 	// generate private key for cert
-	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certKey, err := m.client.generateKey()
 	if err != nil {
 		return nil, fmt.Errorf("autocert: error generating certificate key for %s: %v", domainName, err)
 	}
@@ -385,22 +499,11 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 		Bytes: certKeyEnc,
 	})
 
-	// create the new csr template
-	tpl := &x509.CertificateRequest{
-		SignatureAlgorithm: x509.ECDSAWithSHA256,
-		PublicKeyAlgorithm: x509.ECDSA,
-		PublicKey:          certKey.Public(),
-		Subject:            pkix.Name{CommonName: domainName},
-		DNSNames:           []string{domainName},
-	}
-	csrDer, err := x509.CreateCertificateRequest(rand.Reader, tpl, certKey)
+	// create the new csr
+	csr, err := newCSR(m.client.random(), certKey, []Identifier{{Type: IdentifierTypeDNS, Value: domainName}})
 	if err != nil {
 		return nil, fmt.Errorf("autocert: error creating certificate request for %s: %v", domainName, err)
 	}
-	csr, err := x509.ParseCertificateRequest(csrDer)
-	if err != nil {
-		return nil, fmt.Errorf("autocert: error parsing certificate request for %s: %v", domainName, err)
-	}
 
 	// finalize the order with the acme server given a csr
 	order, err = m.client.FinalizeOrder(account, order, csr)
@@ -408,8 +511,23 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 		return nil, fmt.Errorf("autocert: error finalizing order for %s: %v", domainName, err)
 	}
 
-	// fetch the certificate chain from the finalized order provided by the acme server
-	certs, err := m.client.FetchCertificates(account, order.Certificate)
+	// fetch the certificate chain from the finalized order provided by the acme server, preferring the chain which
+	// verifies against the bundle if set
+	var certs []*x509.Certificate
+	if m.Bundle == nil {
+		certs, err = m.client.FetchCertificates(account, order.Certificate)
+	} else {
+		var chains [][]*x509.Certificate
+		chains, err = m.client.fetchChains(account, order.Certificate)
+		if err == nil {
+			certs = chains[0]
+			if bundle, err := m.Bundle.cached(); err == nil {
+				if chain, err := selectChain(bundle, chains); err == nil {
+					certs = chain
+				}
+			}
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("autocert: error fetching order certificates for %s: %v", domainName, err)
 	}
@@ -426,5 +544,10 @@ func (m *AutoCert) issueCert(domainName string) (*tls.Certificate, error) {
 	}
 	m.putCache(certPem, "cert", domainName)
 
-	return m.getExistingCert(domainName), nil
+	cert := m.getExistingCert(domainName)
+	if cert == nil {
+		// returning an error rather than no certificate, which would issue another certificate on every handshake
+		return nil, fmt.Errorf("autocert: issued certificate for %s failed verification", domainName)
+	}
+	return cert, nil
 }
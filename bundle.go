@@ -0,0 +1,391 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BundleSource provides the root and intermediate certificates a CA prefers to be used when building and verifying
+// certificate chains, as some CAs publish preferred bundles out of band from the acme api.
+// The bundle is either fetched from a url and refreshed periodically, or embedded, or both in which case the embedded
+// bundle is used until the first successful fetch.
+//
+// A fetched bundle is only used if each of its certificates has a pinned fingerprint, or is signed by a certificate
+// in the bundle which does. If no fingerprints are pinned, the certificates of the embedded bundle are trusted
+// instead, so each certificate of a fetched bundle must be or chain to an embedded certificate. A bundle which fails verification is
+// discarded and the previous bundle kept.
+//
+// A BundleSource is safe for concurrent use and must not be copied after first use.
+type BundleSource struct {
+	// Url of a pem encoded bundle of certificates, optional if PEM is set.
+	URL string
+
+	// Embedded pem encoded bundle of certificates, optional if URL is set.
+	PEM []byte
+
+	// Pinned sha-256 fingerprints of trusted certificates, as returned by CertificateFingerprint. Colons and case
+	// are ignored.
+	Fingerprints []string
+
+	// Time after which a fetched bundle is fetched again.
+	// Default 24 hours if duration is not set or if set to 0.
+	RefreshInterval time.Duration
+
+	// Http client used to fetch the bundle.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	lock       sync.Mutex
+	certs      []*x509.Certificate
+	fetched    time.Time
+	lastError  error
+	refreshing bool
+
+	// Held while fetching the bundle, so fetches are serialized without holding lock.
+	fetchLock sync.Mutex
+}
+
+// Maximum time a background refresh of a bundle may take.
+const bundleRefreshTimeout = 30 * time.Second
+
+// CertificateFingerprint returns the hex encoded sha-256 fingerprint of a certificate, suitable for pinning in
+// BundleSource.Fingerprints.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Certificates returns the certificates of the bundle. If the url is set and the bundle has not been fetched within
+// the refresh interval, it is fetched first if there is no bundle yet, otherwise the current bundle is returned and
+// refreshed in the background.
+// If fetching fails, the previous or embedded bundle is returned, and an error only if there is no bundle to return.
+func (bs *BundleSource) Certificates(ctx context.Context) ([]*x509.Certificate, error) {
+	certs, stale, err := bs.current()
+	if stale && len(certs) == 0 {
+		bs.refreshIfStale(ctx)
+		certs, _, err = bs.current()
+	} else if stale {
+		bs.refreshBackground()
+	}
+	return certs, err
+}
+
+// Refresh fetches the bundle from the url immediately, eg on a schedule, replacing the current bundle if the fetched
+// bundle is verified.
+func (bs *BundleSource) Refresh(ctx context.Context) error {
+	bs.fetchLock.Lock()
+	defer bs.fetchLock.Unlock()
+	return bs.refresh(ctx)
+}
+
+// LastError returns the error of the last attempt to fetch the bundle, if any.
+func (bs *BundleSource) LastError() error {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	return bs.lastError
+}
+
+// VerifyOptions returns a copy of opts with the roots of the bundle as opts.Roots, and its intermediates added to
+// opts.Intermediates, which is created if nil, so chains are built using the preferred certificates of the CA and
+// must end at one of its roots. See VerifyCertificates.
+func (bs *BundleSource) VerifyOptions(ctx context.Context, opts x509.VerifyOptions) (x509.VerifyOptions, error) {
+	certs, err := bs.Certificates(ctx)
+	if err != nil {
+		return opts, err
+	}
+	return bundleVerifyOptions(certs, opts), nil
+}
+
+// Verify verifies a certificate chain, as returned by FetchCertificates, against the bundle, see VerifyCertificates.
+// The certificates following the leaf are used as intermediates in addition to those of the bundle.
+func (bs *BundleSource) Verify(ctx context.Context, certs []*x509.Certificate, hostnames ...string) ([][]*x509.Certificate, error) {
+	var opts x509.VerifyOptions
+	if len(certs) > 1 {
+		opts.Intermediates = x509.NewCertPool()
+		for _, c := range certs[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+	}
+
+	opts, err := bs.VerifyOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return VerifyCertificates(certs, opts, hostnames...)
+}
+
+// SelectChain returns the first of the chains, eg the default and alternate chains returned by
+// FetchAllCertificates, which verifies against the bundle, so the chain preferred by the CA is used. See Verify.
+func (bs *BundleSource) SelectChain(ctx context.Context, chains ...[]*x509.Certificate) ([]*x509.Certificate, error) {
+	certs, err := bs.Certificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return selectChain(certs, chains)
+}
+
+// Helper function to select the first chain which verifies against the certificates of a bundle.
+func selectChain(bundle []*x509.Certificate, chains [][]*x509.Certificate) ([]*x509.Certificate, error) {
+	var errs []string
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			continue
+		}
+		opts := x509.VerifyOptions{Intermediates: x509.NewCertPool()}
+		for _, c := range chain[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		_, err := VerifyCertificates(chain, bundleVerifyOptions(bundle, opts))
+		if err == nil {
+			return chain, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("acme: no certificate chains to select from")
+	}
+	return nil, fmt.Errorf("acme: no certificate chain verifies against the bundle: %s", strings.Join(errs, "; "))
+}
+
+// Helper function to get the current certificates of the bundle, and whether it is due to be fetched.
+func (bs *BundleSource) current() ([]*x509.Certificate, bool, error) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	if bs.certs == nil && len(bs.PEM) > 0 {
+		certs, err := parseBundle(bs.PEM)
+		if err != nil {
+			return nil, false, err
+		}
+		bs.certs = certs
+	}
+	stale := bs.URL != "" && time.Since(bs.fetched) >= bs.refreshInterval()
+
+	if len(bs.certs) == 0 {
+		switch {
+		case bs.lastError != nil:
+			return nil, stale, bs.lastError
+		case bs.URL != "":
+			return nil, stale, errors.New("acme: bundle has not been fetched")
+		default:
+			return nil, stale, errors.New("acme: bundle has no url or pem")
+		}
+	}
+
+	return bs.certs, stale, nil
+}
+
+// Helper function to get the current certificates of the bundle without fetching it, refreshing it in the background
+// if due, for use where blocking is unacceptable, eg during a tls handshake.
+func (bs *BundleSource) cached() ([]*x509.Certificate, error) {
+	certs, stale, err := bs.current()
+	if stale {
+		bs.refreshBackground()
+	}
+	return certs, err
+}
+
+// Helper function to get the refresh interval of the bundle, default 24 hours.
+func (bs *BundleSource) refreshInterval() time.Duration {
+	if bs.RefreshInterval == 0 {
+		return 24 * time.Hour
+	}
+	return bs.RefreshInterval
+}
+
+// Helper function to fetch the bundle unless it was fetched within the refresh interval, eg by a concurrent caller.
+func (bs *BundleSource) refreshIfStale(ctx context.Context) {
+	bs.fetchLock.Lock()
+	defer bs.fetchLock.Unlock()
+
+	bs.lock.Lock()
+	stale := time.Since(bs.fetched) >= bs.refreshInterval()
+	bs.lock.Unlock()
+	if stale {
+		_ = bs.refresh(ctx)
+	}
+}
+
+// Helper function to refresh the bundle in a goroutine with a bounded context, unless a refresh is in progress.
+func (bs *BundleSource) refreshBackground() {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	if bs.refreshing {
+		return
+	}
+	bs.refreshing = true
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), bundleRefreshTimeout)
+		defer cancel()
+		bs.refreshIfStale(ctx)
+
+		bs.lock.Lock()
+		bs.refreshing = false
+		bs.lock.Unlock()
+	}()
+}
+
+// Helper function to fetch the bundle and record the outcome, replacing the current bundle if the fetched bundle is
+// verified. The fetch lock must be held, and the lock is only taken once the bundle is fetched.
+func (bs *BundleSource) refresh(ctx context.Context) error {
+	certs, err := bs.fetch(ctx)
+
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	if err == nil {
+		bs.certs = certs
+	}
+	bs.lastError = err
+	// avoid fetching on every call while the url is unavailable
+	bs.fetched = time.Now()
+	return err
+}
+
+// Helper function to fetch and verify the bundle.
+func (bs *BundleSource) fetch(ctx context.Context) ([]*x509.Certificate, error) {
+	if bs.URL == "" {
+		return nil, errors.New("acme: bundle has no url")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, bs.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error creating bundle request: %v", err)
+	}
+	client := bs.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("acme: error fetching bundle %s: %v", bs.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("acme: error fetching bundle %s: unexpected status code %d", bs.URL, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error reading bundle %s: %v", bs.URL, err)
+	}
+
+	certs, err := parseBundle(body)
+	if err != nil {
+		return nil, err
+	}
+
+	pins := map[string]bool{}
+	for _, fp := range bs.Fingerprints {
+		pins[strings.ToLower(strings.Replace(fp, ":", "", -1))] = true
+	}
+	var anchors []*x509.Certificate
+	if len(pins) == 0 && len(bs.PEM) > 0 {
+		anchors, err = parseBundle(bs.PEM)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(pins) == 0 && len(anchors) == 0 {
+		return nil, errors.New("acme: bundle has no fingerprints or embedded pem to verify against")
+	}
+	if err := verifyBundle(certs, pins, anchors); err != nil {
+		return nil, fmt.Errorf("acme: error verifying bundle %s: %v", bs.URL, err)
+	}
+
+	return certs, nil
+}
+
+// Helper function to set the roots of verify options to those of a bundle, and add its intermediates.
+func bundleVerifyOptions(certs []*x509.Certificate, opts x509.VerifyOptions) x509.VerifyOptions {
+	opts.Roots = x509.NewCertPool()
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, cert := range certs {
+		if isSelfSigned(cert) {
+			opts.Roots.AddCert(cert)
+		} else {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	return opts
+}
+
+// Helper function to parse the certificates of a pem encoded bundle.
+func parseBundle(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("acme: error parsing bundle certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("acme: bundle contains no certificates")
+	}
+	return certs, nil
+}
+
+// Helper function to check each certificate of a bundle is pinned or an anchor, or signed by a trusted certificate in
+// the bundle or the anchors.
+func verifyBundle(certs []*x509.Certificate, pins map[string]bool, anchors []*x509.Certificate) error {
+	all := append(append([]*x509.Certificate{}, anchors...), certs...)
+	trusted := make([]bool, len(all))
+	for i, cert := range all {
+		trusted[i] = i < len(anchors) || pins[CertificateFingerprint(cert)]
+	}
+
+	// trust spreads down from pinned certificates, one level per pass
+	for changed := true; changed; {
+		changed = false
+		for i, cert := range all {
+			if trusted[i] {
+				continue
+			}
+			for j, parent := range all {
+				if trusted[j] && bytes.Equal(cert.RawIssuer, parent.RawSubject) && cert.CheckSignatureFrom(parent) == nil {
+					trusted[i] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var untrusted []string
+	for i, cert := range certs {
+		if !trusted[len(anchors)+i] {
+			untrusted = append(untrusted, fmt.Sprintf("%q (%s)", cert.Subject.CommonName, CertificateFingerprint(cert)))
+		}
+	}
+	if len(untrusted) > 0 {
+		return fmt.Errorf("certificates not pinned or signed by a pinned certificate: %s", strings.Join(untrusted, ", "))
+	}
+	return nil
+}
+
+// Helper function to determine whether a certificate is a self signed root.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
@@ -0,0 +1,234 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func makeIssued(t *testing.T, parent *x509.Certificate, parentKey crypto.Signer, name string, isCA bool) (*x509.Certificate, crypto.Signer) {
+	key := makePrivateKey(t)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		tpl.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return cert, key
+}
+
+func encodeBundle(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, cert := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return b
+}
+
+func TestBundleSource(t *testing.T) {
+	root, rootKey := makeSelfSigned(t, "root.example.com")
+	intermediate, intermediateKey := makeIssued(t, root, rootKey, "intermediate.example.com", true)
+	leaf, _ := makeIssued(t, intermediate, intermediateKey, "leaf.example.com", false)
+	other, _ := makeSelfSigned(t, "other.example.com")
+
+	var served atomic.Value
+	served.Store(encodeBundle(root, intermediate))
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = w.Write(served.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	// embedded bundle provides the intermediate missing from the chain
+	embedded := &BundleSource{PEM: encodeBundle(root, intermediate)}
+	if _, err := embedded.Verify(context.Background(), []*x509.Certificate{leaf}, "leaf.example.com"); err != nil {
+		t.Fatalf("unexpected error verifying with embedded bundle: %v", err)
+	}
+	if _, err := (&BundleSource{PEM: encodeBundle(other)}).Verify(context.Background(), []*x509.Certificate{leaf, intermediate}); err == nil {
+		t.Fatal("expected error verifying chain to another root, got none")
+	}
+
+	// fetched bundle verified against a pinned root fingerprint
+	fp := strings.ToUpper(CertificateFingerprint(root))
+	bs := &BundleSource{URL: srv.URL, Fingerprints: []string{fp[:2] + ":" + fp[2:]}}
+	for i := 0; i < 2; i++ {
+		certs, err := bs.Certificates(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(certs) != 2 {
+			t.Fatalf("expected 2 bundle certificates, got: %d", len(certs))
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("expected bundle to be fetched once within refresh interval, got: %d", n)
+	}
+
+	// a bundle with an unpinned certificate is rejected and the previous bundle kept
+	served.Store(encodeBundle(root, intermediate, other))
+	if err := bs.Refresh(context.Background()); err == nil || !strings.Contains(err.Error(), "other.example.com") {
+		t.Fatalf("expected verification error, got: %v", err)
+	}
+	if bs.LastError() == nil {
+		t.Fatal("expected last error to be recorded")
+	}
+	if _, err := bs.Verify(context.Background(), []*x509.Certificate{leaf}, "leaf.example.com"); err != nil {
+		t.Fatalf("expected previous bundle to be kept, got: %v", err)
+	}
+
+	// embedded certificates are trusted when no fingerprints are set
+	served.Store(encodeBundle(intermediate))
+	if err := (&BundleSource{URL: srv.URL, PEM: encodeBundle(root)}).Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error verifying against embedded root: %v", err)
+	}
+	if err := (&BundleSource{URL: srv.URL, PEM: encodeBundle(other)}).Refresh(context.Background()); err == nil {
+		t.Fatal("expected intermediate of another root to be rejected, got none")
+	}
+	served.Store(encodeBundle(root, intermediate))
+	if err := (&BundleSource{URL: srv.URL}).Refresh(context.Background()); err == nil {
+		t.Fatal("expected error without pins, got none")
+	}
+	if _, err := (&BundleSource{}).Certificates(context.Background()); err == nil {
+		t.Fatal("expected error with no bundle, got none")
+	}
+}
+
+func TestBundleSource_SelectChain(t *testing.T) {
+	root, rootKey := makeSelfSigned(t, "root.example.com")
+	intermediate, intermediateKey := makeIssued(t, root, rootKey, "intermediate.example.com", true)
+	leaf, _ := makeIssued(t, intermediate, intermediateKey, "leaf.example.com", false)
+	other, otherKey := makeSelfSigned(t, "other.example.com")
+	otherIntermediate, _ := makeIssued(t, other, otherKey, "intermediate.example.com", true)
+
+	bs := &BundleSource{PEM: encodeBundle(root)}
+	chain, err := bs.SelectChain(context.Background(), []*x509.Certificate{leaf, otherIntermediate}, []*x509.Certificate{leaf, intermediate})
+	if err != nil {
+		t.Fatalf("unexpected error selecting chain: %v", err)
+	}
+	if !chain[1].Equal(intermediate) {
+		t.Fatal("expected chain verifying against the bundle to be selected")
+	}
+	if _, err := bs.SelectChain(context.Background(), []*x509.Certificate{leaf, otherIntermediate}); err == nil {
+		t.Fatal("expected error with no chain verifying against the bundle, got none")
+	}
+}
+
+func TestBundleSource_background(t *testing.T) {
+	root, _ := makeSelfSigned(t, "root.example.com")
+	fetched := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(encodeBundle(root))
+		fetched <- struct{}{}
+	}))
+	defer srv.Close()
+
+	// an embedded bundle is returned without waiting for the url to be fetched
+	bs := &BundleSource{URL: srv.URL, PEM: encodeBundle(root)}
+	if certs, err := bs.cached(); err != nil || len(certs) != 1 {
+		t.Fatalf("expected embedded bundle, got: %d certificates, %v", len(certs), err)
+	}
+	select {
+	case <-fetched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected bundle to be refreshed in the background")
+	}
+
+	// no bundle is available until the background refresh finishes
+	bs = &BundleSource{URL: srv.URL, Fingerprints: []string{CertificateFingerprint(root)}}
+	if _, err := bs.cached(); err == nil {
+		t.Fatal("expected error before bundle is fetched, got none")
+	}
+	<-fetched
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if certs, err := bs.cached(); err == nil && len(certs) == 1 {
+			return
+		}
+	}
+	t.Fatal("expected bundle to be available after background refresh")
+}
+
+func TestAutoCert_Bundle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// the bundle can't be fetched, so certificates are verified against the dev root instead
+	m := &AutoCert{DevMode: true, Bundle: &BundleSource{URL: srv.URL}}
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	again, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error getting existing certificate: %v", err)
+	}
+	if !again.Leaf.Equal(cert.Leaf) {
+		t.Fatal("expected existing certificate to be reused while the bundle is unavailable")
+	}
+}
+
+func TestIssuer_Bundle(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	ids := []Identifier{{Type: "dns", Value: "bundle.example.test"}}
+	other, _ := makeSelfSigned(t, "other.example.test")
+
+	for _, bundle := range [][]byte{ca.RootPEM(), encodeBundle(other)} {
+		csr, err := newCSR(rand.Reader, makePrivateKey(t), ids)
+		if err != nil {
+			t.Fatalf("unexpected error creating csr: %v", err)
+		}
+		is := Issuer{
+			Client:  c,
+			Account: account,
+			Solvers: map[string]Solver{ChallengeTypeHTTP01: noopSolver{}},
+			Bundle:  &BundleSource{PEM: bundle},
+		}
+		result, err := is.Issue(context.Background(), ids, csr)
+		if len(result.Certificates) == 0 {
+			t.Fatalf("expected certificates, got none: %v", err)
+		}
+		if trusted := bytes.Equal(bundle, ca.RootPEM()); trusted != (err == nil) {
+			t.Fatalf("expected chain selection error only for an untrusted bundle, got: %v", err)
+		}
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 func (c Client) decodeCertificateChain(body []byte, resp *http.Response, account Account) ([]*x509.Certificate, error) {
@@ -83,24 +86,101 @@ func (c Client) FetchAllCertificates(account Account, certificateURL string) (ma
 
 }
 
+// Helper function to fetch the default and alternate chains of a certificate, default chain first followed by the
+// alternate chains ordered by url.
+func (c Client) fetchChains(account Account, certificateURL string) ([][]*x509.Certificate, error) {
+	all, err := c.FetchAllCertificates(account, certificateURL)
+	if err != nil {
+		return nil, err
+	}
+	var alternates []string
+	for u := range all {
+		if u != certificateURL {
+			alternates = append(alternates, u)
+		}
+	}
+	sort.Strings(alternates)
+	chains := [][]*x509.Certificate{all[certificateURL]}
+	for _, u := range alternates {
+		chains = append(chains, all[u])
+	}
+	return chains, nil
+}
+
 // RevokeCertificate revokes a given certificate given the certificate key or account key, and a reason.
+// Equivalent to RevokeCertificateOptions with RevokeOptKey and RevokeOptReason.
 func (c Client) RevokeCertificate(account Account, cert *x509.Certificate, key crypto.Signer, reason int) error {
-	revokeReq := struct {
-		Certificate string `json:"certificate"`
-		Reason      int    `json:"reason"`
-	}{
+	return c.RevokeCertificateOptions(account, cert, RevokeOptKey(key), RevokeOptReason(reason))
+}
+
+// RevokeCertificateOptions revokes a given certificate with the provided options.
+// By default the request is signed with the account key and no reason is given.
+func (c Client) RevokeCertificateOptions(account Account, cert *x509.Certificate, options ...RevokeCertificateOptionFunc) error {
+	revokeReq := RevokeCertificateRequest{
 		Certificate: base64.RawURLEncoding.EncodeToString(cert.Raw),
-		Reason:      reason,
+		Key:         account.PrivateKey,
+	}
+
+	for _, opt := range options {
+		if err := opt(&revokeReq); err != nil {
+			return err
+		}
 	}
 
 	kid := ""
-	if key == account.PrivateKey {
+	if revokeReq.Key == account.PrivateKey {
 		kid = account.URL
 	}
 
-	if _, err := c.post(c.dir.RevokeCert, kid, key, revokeReq, nil, http.StatusOK); err != nil {
+	if _, err := c.post(c.Directory().RevokeCert, kid, revokeReq.Key, revokeReq, nil, http.StatusOK); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// VerifyCertificates verifies a certificate chain, as returned by FetchCertificates, using the provided verify options.
+// This can be used after issuance to check a certificate will validate for its intended use before it is deployed.
+// If opts.Intermediates is nil, the certificates following the leaf are used as intermediates.
+// If any hostnames are provided, the chain is verified for each hostname in turn, otherwise opts.DNSName is used.
+// Returns the verified chains for the first hostname, or an error describing each verification failure.
+func VerifyCertificates(certs []*x509.Certificate, opts x509.VerifyOptions, hostnames ...string) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("acme: no certificates to verify")
+	}
+
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+		for _, c := range certs[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+	}
+
+	if len(hostnames) == 0 {
+		hostnames = []string{opts.DNSName}
+	}
+
+	var chains [][]*x509.Certificate
+	var failures []string
+	for _, host := range hostnames {
+		opts.DNSName = host
+		c, err := certs[0].Verify(opts)
+		if err != nil {
+			if host == "" {
+				failures = append(failures, err.Error())
+			} else {
+				failures = append(failures, fmt.Sprintf("%s: %v", host, err))
+			}
+			continue
+		}
+		if chains == nil {
+			chains = c
+		}
+	}
+
+	if len(failures) > 0 {
+		return chains, fmt.Errorf("acme: certificate verification failed: %s", strings.Join(failures, ", "))
+	}
+
+	return chains, nil
+}
@@ -2,6 +2,7 @@ package acme
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/pem"
 	"net/http"
 	"strings"
@@ -146,3 +147,84 @@ func TestClient_RevokeCertificate2(t *testing.T) {
 		t.Fatalf("expected no error, got: %v", err)
 	}
 }
+
+func TestClient_RevokeCertificateOptions(t *testing.T) {
+	account, order, _ := makeOrderFinalised(t, nil)
+	if order.Certificate == "" {
+		t.Fatalf("no certificate: %+v", order)
+	}
+	certs, err := testClient.FetchCertificates(account, order.Certificate)
+	if err != nil {
+		t.Fatalf("expeceted no error, got: %v", err)
+	}
+	if err := testClient.RevokeCertificateOptions(account, certs[0], RevokeOptKey(nil)); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if err := testClient.RevokeCertificateOptions(account, certs[0], RevokeOptReason(ReasonSuperseded)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	cert, _ := makeSelfSigned(t, "example.com", "www.example.com")
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	tests := []struct {
+		name         string
+		certs        []*x509.Certificate
+		opts         x509.VerifyOptions
+		hostnames    []string
+		expectsError bool
+		errorStr     string
+	}{
+		{
+			name:         "no certificates",
+			expectsError: true,
+			errorStr:     "no certificates",
+		},
+		{
+			name:         "unknown root",
+			certs:        []*x509.Certificate{cert},
+			expectsError: true,
+			errorStr:     "verification failed",
+		},
+		{
+			name:      "ok",
+			certs:     []*x509.Certificate{cert},
+			opts:      x509.VerifyOptions{Roots: roots},
+			hostnames: []string{"example.com", "www.example.com"},
+		},
+		{
+			name:         "bad hostname",
+			certs:        []*x509.Certificate{cert},
+			opts:         x509.VerifyOptions{Roots: roots},
+			hostnames:    []string{"example.com", "other.com"},
+			expectsError: true,
+			errorStr:     "other.com",
+		},
+		{
+			name:         "bad usage",
+			certs:        []*x509.Certificate{cert},
+			opts:         x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}},
+			expectsError: true,
+			errorStr:     "verification failed",
+		},
+	}
+
+	for i, ct := range tests {
+		chains, err := VerifyCertificates(ct.certs, ct.opts, ct.hostnames...)
+		if ct.expectsError && err == nil {
+			t.Errorf("VerifyCertificates test %d %q expected error, got none", i, ct.name)
+		}
+		if !ct.expectsError && err != nil {
+			t.Errorf("VerifyCertificates test %d %q expected no error, got: %v", i, ct.name, err)
+		}
+		if err != nil && ct.errorStr != "" && !strings.Contains(err.Error(), ct.errorStr) {
+			t.Errorf("VerifyCertificates test %d %q error doesnt contain %q: %s", i, ct.name, ct.errorStr, err.Error())
+		}
+		if !ct.expectsError && len(chains) == 0 {
+			t.Errorf("VerifyCertificates test %d %q expected chains, got none", i, ct.name)
+		}
+	}
+}
@@ -45,17 +45,36 @@ func checkUpdatedChallengeStatus(challenge Challenge) (bool, error) {
 	}
 }
 
+// Helper function to record the status of a challenge in its history, if it has changed.
+func observeChallengeStatus(challenge *Challenge) {
+	if n := len(challenge.StatusHistory); n > 0 && challenge.StatusHistory[n-1].Status == challenge.Status {
+		return
+	}
+	challenge.StatusHistory = append(challenge.StatusHistory, ObservedStatus{
+		Status:   challenge.Status,
+		Observed: time.Now(),
+	})
+}
+
 // UpdateChallenge responds to a challenge to indicate to the server to complete the challenge.
+// The returned challenge includes the history of statuses observed while waiting for the challenge to be validated.
 func (c Client) UpdateChallenge(account Account, challenge Challenge) (Challenge, error) {
-	resp, err := c.post(challenge.URL, account.URL, account.PrivateKey, struct{}{}, &challenge, http.StatusOK)
+	var wireChal wireChallenge
+	resp, err := c.post(challenge.URL, account.URL, account.PrivateKey, struct{}{}, &wireChal, http.StatusOK)
 	if err != nil {
 		return challenge, err
 	}
+	if err := wireChal.apply(&challenge); err != nil {
+		return challenge, err
+	}
 
 	if loc := resp.Header.Get("Location"); loc != "" {
 		challenge.URL = loc
 	}
 	challenge.AuthorizationURL = fetchLink(resp, "up")
+	challenge.RetryAfter = fetchRetryAfter(resp, time.Now())
+	challenge.StatusHistory = nil
+	observeChallengeStatus(&challenge)
 
 	if finished, err := checkUpdatedChallengeStatus(challenge); finished {
 		return challenge, err
@@ -67,19 +86,27 @@ func (c Client) UpdateChallenge(account Account, challenge Challenge) (Challenge
 		if time.Now().After(end) {
 			return challenge, errors.New("acme: challenge update timeout")
 		}
-		time.Sleep(pollInterval)
+		if err := c.pollWait(c.pollDelay(pollInterval, challenge.RetryAfter, end)); err != nil {
+			return challenge, err
+		}
 
-		resp, err := c.post(challenge.URL, account.URL, account.PrivateKey, "", &challenge, http.StatusOK)
+		var wireChal wireChallenge
+		resp, err := c.post(challenge.URL, account.URL, account.PrivateKey, "", &wireChal, http.StatusOK)
 		if err != nil {
 			// i don't think it's worth exiting the loop on this error
 			// it could just be connectivity issue that's resolved before the timeout duration
 			continue
 		}
+		if err := wireChal.apply(&challenge); err != nil {
+			return challenge, err
+		}
 
 		if loc := resp.Header.Get("Location"); loc != "" {
 			challenge.URL = loc
 		}
 		challenge.AuthorizationURL = fetchLink(resp, "up")
+		challenge.RetryAfter = fetchRetryAfter(resp, time.Now())
+		observeChallengeStatus(&challenge)
 
 		if finished, err := checkUpdatedChallengeStatus(challenge); finished {
 			return challenge, err
@@ -90,13 +117,21 @@ func (c Client) UpdateChallenge(account Account, challenge Challenge) (Challenge
 // FetchChallenge fetches an existing challenge from the given url.
 func (c Client) FetchChallenge(account Account, challengeURL string) (Challenge, error) {
 	challenge := Challenge{}
-	resp, err := c.post(challengeURL, account.URL, account.PrivateKey, "", &challenge, http.StatusOK)
+	var wireChal wireChallenge
+	resp, err := c.post(challengeURL, account.URL, account.PrivateKey, "", &wireChal, http.StatusOK)
 	if err != nil {
 		return challenge, err
 	}
+	if err := wireChal.apply(&challenge); err != nil {
+		return challenge, err
+	}
 
-	challenge.URL = resp.Header.Get("Location")
+	challenge.URL = challengeURL
+	if loc := resp.Header.Get("Location"); loc != "" {
+		challenge.URL = loc
+	}
 	challenge.AuthorizationURL = fetchLink(resp, "up")
+	challenge.RetryAfter = fetchRetryAfter(resp, time.Now())
 
 	return challenge, nil
 }
@@ -43,6 +43,23 @@ func TestClient_UpdateChallenge(t *testing.T) {
 	if updatedChal.Status != "valid" {
 		t.Fatalf("expected valid challenge, got: %s", chal.Status)
 	}
+	if n := len(updatedChal.StatusHistory); n == 0 || updatedChal.StatusHistory[n-1].Status != "valid" {
+		t.Fatalf("expected status history ending in valid, got: %+v", updatedChal.StatusHistory)
+	}
+}
+
+func Test_observeChallengeStatus(t *testing.T) {
+	chal := Challenge{}
+	for _, status := range []string{"processing", "processing", "processing", "valid"} {
+		chal.Status = status
+		observeChallengeStatus(&chal)
+	}
+	if len(chal.StatusHistory) != 2 || chal.StatusHistory[0].Status != "processing" || chal.StatusHistory[1].Status != "valid" {
+		t.Fatalf("unexpected status history: %+v", chal.StatusHistory)
+	}
+	if chal.StatusHistory[1].Observed.Before(chal.StatusHistory[0].Observed) {
+		t.Fatalf("expected status history in order, got: %+v", chal.StatusHistory)
+	}
 }
 
 func TestClient_FetchChallenge(t *testing.T) {
@@ -62,6 +79,9 @@ func TestClient_FetchChallenge(t *testing.T) {
 	if chal.Token != fetchedChal.Token {
 		t.Fatalf("tokens different")
 	}
+	if fetchedChal.URL == "" {
+		t.Fatal("no challenge url")
+	}
 }
 
 func Test_checkUpdatedChallengeStatus(t *testing.T) {
@@ -0,0 +1,188 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// NewCSR creates a certificate signing request for the given identifiers, signed with key.
+// Each identifier is placed in the matching subject alternative name, dns identifiers as dNSName, ip identifiers as
+// iPAddress and email identifiers as rfc822Name. The common name is set to the first dns identifier if it fits.
+// The csr is checked with VerifyCSR before it is returned.
+func NewCSR(key crypto.Signer, identifiers []Identifier) (*x509.CertificateRequest, error) {
+	return newCSR(rand.Reader, key, identifiers)
+}
+
+// Helper function to create a certificate signing request using the given random source, see NewCSR.
+func newCSR(random io.Reader, key crypto.Signer, identifiers []Identifier) (*x509.CertificateRequest, error) {
+	if key == nil {
+		return nil, errors.New("acme: no csr key")
+	}
+	if len(identifiers) == 0 {
+		return nil, errors.New("acme: no csr identifiers")
+	}
+
+	tpl := &x509.CertificateRequest{}
+	for _, id := range identifiers {
+		switch strings.ToLower(id.Type) {
+		case IdentifierTypeDNS:
+			tpl.DNSNames = append(tpl.DNSNames, id.Value)
+			// common names are limited to 64 characters, see https://tools.ietf.org/html/rfc5280#appendix-A.1
+			if tpl.Subject.CommonName == "" && len(id.Value) <= 64 {
+				tpl.Subject = pkix.Name{CommonName: id.Value}
+			}
+		case IdentifierTypeIP:
+			ip := net.ParseIP(id.Value)
+			if ip == nil {
+				return nil, fmt.Errorf("acme: invalid ip identifier: %q", id.Value)
+			}
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		case IdentifierTypeEmail:
+			if !strings.Contains(id.Value, "@") {
+				return nil, fmt.Errorf("acme: invalid email identifier: %q", id.Value)
+			}
+			tpl.EmailAddresses = append(tpl.EmailAddresses, id.Value)
+		default:
+			return nil, fmt.Errorf("acme: unsupported csr identifier type: %q", id.Type)
+		}
+	}
+
+	der, err := x509.CreateCertificateRequest(random, tpl, key)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error creating certificate request: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error parsing certificate request: %v", err)
+	}
+
+	if err := VerifyCSR(csr, identifiers); err != nil {
+		return nil, err
+	}
+
+	return csr, nil
+}
+
+// NewOrderCSR creates a certificate signing request for the identifiers of an order, see NewCSR.
+// Identifiers not supported by the server, as described by the IdentifierTypes and NoMixedIdentifiers quirks set
+// with WithQuirks, are rejected, as are keys rejected by the policy set with WithKeyPolicy.
+// The csr is signed using the random source set with WithRand.
+func (c Client) NewOrderCSR(key crypto.Signer, order Order) (*x509.CertificateRequest, error) {
+	if err := c.quirks.checkIdentifiers(order.Identifiers); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if err := c.checkKey(key.Public()); err != nil {
+			return nil, err
+		}
+	}
+	return newCSR(c.random(), key, order.Identifiers)
+}
+
+// VerifyCSR checks the signature of a certificate signing request, and that its subject alternative names cover
+// exactly the given identifiers, eg those of an order, so it won't be rejected when finalizing an order.
+// A common name, if set, must also be one of the identifiers.
+func VerifyCSR(csr *x509.CertificateRequest, identifiers []Identifier) error {
+	if csr == nil {
+		return errors.New("acme: no csr")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("acme: invalid csr signature: %v", err)
+	}
+
+	var want []string
+	for _, id := range identifiers {
+		key, err := sanKey(id.Type, id.Value)
+		if err != nil {
+			return err
+		}
+		want = append(want, key)
+	}
+
+	var got []string
+	for _, name := range csr.DNSNames {
+		got = append(got, IdentifierTypeDNS+":"+strings.ToLower(name))
+	}
+	for _, ip := range csr.IPAddresses {
+		got = append(got, IdentifierTypeIP+":"+ip.String())
+	}
+	for _, email := range csr.EmailAddresses {
+		got = append(got, IdentifierTypeEmail+":"+strings.ToLower(email))
+	}
+
+	missing, extra := diffStrings(want, got)
+	if len(missing) > 0 {
+		return fmt.Errorf("acme: csr is missing identifiers: %s", strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		return fmt.Errorf("acme: csr has identifiers not in order: %s", strings.Join(extra, ", "))
+	}
+
+	if cn := csr.Subject.CommonName; cn != "" {
+		found := false
+		for _, key := range want {
+			if key == IdentifierTypeDNS+":"+strings.ToLower(cn) || key == IdentifierTypeIP+":"+cn {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("acme: csr common name %q is not an identifier", cn)
+		}
+	}
+
+	return nil
+}
+
+// Helper function to get a normalised type:value key of an identifier for comparison with subject alternative names.
+func sanKey(idType, value string) (string, error) {
+	switch strings.ToLower(idType) {
+	case IdentifierTypeDNS:
+		return IdentifierTypeDNS + ":" + strings.ToLower(value), nil
+	case IdentifierTypeIP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", fmt.Errorf("acme: invalid ip identifier: %q", value)
+		}
+		return IdentifierTypeIP + ":" + ip.String(), nil
+	case IdentifierTypeEmail:
+		return IdentifierTypeEmail + ":" + strings.ToLower(value), nil
+	default:
+		return "", fmt.Errorf("acme: unsupported csr identifier type: %q", idType)
+	}
+}
+
+// Helper function to compare two lists of strings as sets, returning those only in want and those only in got.
+func diffStrings(want, got []string) ([]string, []string) {
+	wantSet := map[string]bool{}
+	for _, s := range want {
+		wantSet[s] = true
+	}
+	gotSet := map[string]bool{}
+	for _, s := range got {
+		gotSet[s] = true
+	}
+
+	var missing, extra []string
+	for s := range wantSet {
+		if !gotSet[s] {
+			missing = append(missing, s)
+		}
+	}
+	for s := range gotSet {
+		if !wantSet[s] {
+			extra = append(extra, s)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+
+	return missing, extra
+}
@@ -0,0 +1,115 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNewCSR(t *testing.T) {
+	key := makePrivateKey(t)
+	ids := []Identifier{
+		{Type: IdentifierTypeIP, Value: "2001:db8::1"},
+		{Type: IdentifierTypeDNS, Value: "Example.com"},
+		{Type: IdentifierTypeDNS, Value: "www.example.com"},
+		{Type: IdentifierTypeEmail, Value: "user@example.com"},
+	}
+
+	csr, err := NewCSR(key, ids)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if csr.Subject.CommonName != "Example.com" {
+		t.Fatalf("expected common name of first dns identifier, got: %q", csr.Subject.CommonName)
+	}
+	if len(csr.DNSNames) != 2 || len(csr.IPAddresses) != 1 || len(csr.EmailAddresses) != 1 {
+		t.Fatalf("unexpected subject alternative names: %v %v %v", csr.DNSNames, csr.IPAddresses, csr.EmailAddresses)
+	}
+
+	tests := []struct {
+		name     string
+		ids      []Identifier
+		errorStr string
+	}{
+		{name: "no identifiers", errorStr: "no csr identifiers"},
+		{name: "bad ip", ids: []Identifier{{Type: IdentifierTypeIP, Value: "example.com"}}, errorStr: "invalid ip"},
+		{name: "bad email", ids: []Identifier{{Type: IdentifierTypeEmail, Value: "example.com"}}, errorStr: "invalid email"},
+		{name: "unsupported type", ids: []Identifier{{Type: "permanent-identifier", Value: "1234"}}, errorStr: "unsupported"},
+	}
+	for i, ct := range tests {
+		_, err := NewCSR(key, ct.ids)
+		if err == nil || !strings.Contains(err.Error(), ct.errorStr) {
+			t.Errorf("NewCSR test %d %q expected error containing %q, got: %v", i, ct.name, ct.errorStr, err)
+		}
+	}
+}
+
+func TestVerifyCSR(t *testing.T) {
+	key := makePrivateKey(t)
+	makeRaw := func(tpl *x509.CertificateRequest) *x509.CertificateRequest {
+		der, err := x509.CreateCertificateRequest(rand.Reader, tpl, key)
+		if err != nil {
+			t.Fatalf("error creating certificate request: %v", err)
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			t.Fatalf("error parsing certificate request: %v", err)
+		}
+		return csr
+	}
+	ids := []Identifier{{Type: IdentifierTypeDNS, Value: "example.com"}, {Type: IdentifierTypeIP, Value: "192.0.2.1"}}
+
+	tests := []struct {
+		name     string
+		csr      *x509.CertificateRequest
+		errorStr string
+	}{
+		{name: "exact", csr: makeRaw(&x509.CertificateRequest{DNSNames: []string{"EXAMPLE.com"}, IPAddresses: parseIPs(t, "192.0.2.1")})},
+		{name: "missing", csr: makeRaw(&x509.CertificateRequest{DNSNames: []string{"example.com"}}), errorStr: "missing identifiers: ip:192.0.2.1"},
+		{name: "extra", csr: makeRaw(&x509.CertificateRequest{DNSNames: []string{"example.com", "www.example.com"}, IPAddresses: parseIPs(t, "192.0.2.1")}), errorStr: "not in order: dns:www.example.com"},
+		{name: "ip as dns", csr: makeRaw(&x509.CertificateRequest{DNSNames: []string{"example.com", "192.0.2.1"}}), errorStr: "missing identifiers"},
+		{name: "common name", csr: makeRaw(&x509.CertificateRequest{Subject: pkix.Name{CommonName: "other.com"}, DNSNames: []string{"example.com"}, IPAddresses: parseIPs(t, "192.0.2.1")}), errorStr: "common name"},
+	}
+	for i, ct := range tests {
+		err := VerifyCSR(ct.csr, ids)
+		if ct.errorStr == "" {
+			if err != nil {
+				t.Errorf("VerifyCSR test %d %q expected no error, got: %v", i, ct.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), ct.errorStr) {
+			t.Errorf("VerifyCSR test %d %q expected error containing %q, got: %v", i, ct.name, ct.errorStr, err)
+		}
+	}
+}
+
+func TestClient_NewOrderCSR(t *testing.T) {
+	key := makePrivateKey(t)
+	order := Order{Identifiers: []Identifier{{Type: IdentifierTypeDNS, Value: "example.com"}, {Type: IdentifierTypeIP, Value: "192.0.2.1"}}}
+
+	if _, err := (Client{}).NewOrderCSR(key, order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := (Client{quirks: Quirks{NoMixedIdentifiers: true}}).NewOrderCSR(key, order); err == nil {
+		t.Fatal("expected error mixing identifiers, got none")
+	}
+	if _, err := (Client{quirks: Quirks{IdentifierTypes: []string{IdentifierTypeDNS}}}).NewOrderCSR(key, order); err == nil {
+		t.Fatal("expected error for unsupported identifier type, got none")
+	}
+}
+
+func parseIPs(t *testing.T, ips ...string) []net.IP {
+	var parsed []net.IP
+	for _, ip := range ips {
+		p := net.ParseIP(ip)
+		if p == nil {
+			t.Fatalf("invalid ip: %s", ip)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed
+}
@@ -0,0 +1,213 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// Causes of a csr rejection, as found by Client.DiagnoseCSR.
+const (
+	CSRCauseIdentifiers        = "identifiers"
+	CSRCauseCommonName         = "commonName"
+	CSRCauseWeakKey            = "weakKey"
+	CSRCauseKeyAlgorithm       = "keyAlgorithm"
+	CSRCauseSignatureAlgorithm = "signatureAlgorithm"
+	CSRCauseAccountKey         = "accountKey"
+)
+
+// Maximum number of names in a csr accepted by most CAs, eg Let's Encrypt.
+const csrMaxNames = 100
+
+// CSRFinding is a problem with a csr which may cause a CA to reject it.
+type CSRFinding struct {
+	// One of the CSRCause constants.
+	Cause string
+
+	// Description of the problem and how to fix it.
+	Detail string
+}
+
+// CSRError is returned by Client.DiagnoseFinalizeError and Issuer.Issue when the acme server rejects a csr with a badCSR problem,
+// explaining what is wrong with the csr in place of the often terse detail of the problem.
+// The order may still be ready, so it can be finalized again with a corrected csr.
+type CSRError struct {
+	// The badCSR problem returned by the acme server.
+	Problem Problem
+
+	// Problems found with the csr, from checking it locally against the order and common CA policy, and from the
+	// detail of the problem. May be empty if the cause could not be determined.
+	Findings []CSRFinding
+}
+
+// Error returns the findings, followed by the problem returned by the server.
+func (err CSRError) Error() string {
+	if len(err.Findings) == 0 {
+		return err.Problem.Error()
+	}
+	return fmt.Sprintf("acme: csr rejected: %s (%v)", err.diagnosis(), err.Problem)
+}
+
+// Helper function to join the details of the findings of a csr error.
+func (err CSRError) diagnosis() string {
+	details := make([]string, len(err.Findings))
+	for i, f := range err.Findings {
+		details[i] = f.Detail
+	}
+	return strings.Join(details, "; ")
+}
+
+// Keywords in the detail of a badCSR problem, and the cause they indicate, checked in order.
+var csrProblemKeywords = []struct {
+	keywords []string
+	cause    string
+}{
+	{[]string{"account key", "same as the account"}, CSRCauseAccountKey},
+	{[]string{"signature algorithm", "sha1", "sha-1", "md5"}, CSRCauseSignatureAlgorithm},
+	{[]string{"too small", "key size", "weak", "modulus", "factor"}, CSRCauseWeakKey},
+	{[]string{"key type", "curve", "unsupported key", "public key"}, CSRCauseKeyAlgorithm},
+	{[]string{"common name", "commonname", " cn "}, CSRCauseCommonName},
+	{[]string{"identifier", "dns name", "names", "subject alternative", "authorization"}, CSRCauseIdentifiers},
+}
+
+// DiagnoseCSR checks a csr against the identifiers of an order and common CA policy, eg those of Let's Encrypt,
+// returning any problems which may cause it to be rejected when finalizing the order. Keys rejected by the policy
+// set with WithKeyPolicy are also reported. Returns no findings if no problems are found.
+func (c Client) DiagnoseCSR(account Account, order Order, csr *x509.CertificateRequest) []CSRFinding {
+	if csr == nil {
+		return nil
+	}
+
+	var findings []CSRFinding
+	add := func(cause, format string, args ...interface{}) {
+		findings = append(findings, CSRFinding{Cause: cause, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// subject alternative names must match the order identifiers exactly
+	var want, got []string
+	for _, id := range order.Identifiers {
+		if key, err := sanKey(id.Type, id.Value); err == nil {
+			want = append(want, key)
+		}
+	}
+	for _, name := range csr.DNSNames {
+		got = append(got, IdentifierTypeDNS+":"+strings.ToLower(name))
+	}
+	for _, ip := range csr.IPAddresses {
+		got = append(got, IdentifierTypeIP+":"+ip.String())
+	}
+	for _, email := range csr.EmailAddresses {
+		got = append(got, IdentifierTypeEmail+":"+strings.ToLower(email))
+	}
+	missing, extra := diffStrings(want, got)
+	if len(extra) > 0 {
+		add(CSRCauseIdentifiers, "csr has names which are not identifiers of the order, remove them or add them to a new order: %s",
+			strings.Join(extra, ", "))
+	}
+	if len(missing) > 0 {
+		add(CSRCauseIdentifiers, "csr is missing identifiers of the order, add them as subject alternative names: %s",
+			strings.Join(missing, ", "))
+	}
+	if len(got) > csrMaxNames {
+		add(CSRCauseIdentifiers, "csr has %d names, more than the %d most CAs accept, split them across orders", len(got), csrMaxNames)
+	}
+
+	if cn := csr.Subject.CommonName; cn != "" {
+		found := false
+		for _, key := range got {
+			if key == IdentifierTypeDNS+":"+strings.ToLower(cn) || key == IdentifierTypeIP+":"+cn {
+				found = true
+			}
+		}
+		if !found {
+			add(CSRCauseCommonName, "csr common name %q is not one of its subject alternative names, remove it or add it as a name", cn)
+		} else if len(cn) > 64 {
+			add(CSRCauseCommonName, "csr common name %q is longer than 64 characters, remove it", cn)
+		}
+	}
+
+	switch pub := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if size := pub.N.BitLen(); size < 2048 {
+			add(CSRCauseWeakKey, "csr rsa key size %d is too small, use at least 2048 bits", size)
+		} else if size > 4096 {
+			add(CSRCauseKeyAlgorithm, "csr rsa key size %d is larger than most CAs accept, use at most 4096 bits", size)
+		}
+	case *ecdsa.PublicKey:
+		if name := pub.Curve.Params().Name; name != "P-256" && name != "P-384" {
+			add(CSRCauseKeyAlgorithm, "csr ecdsa curve %s is not accepted by most CAs, use P-256 or P-384", name)
+		}
+	default:
+		add(CSRCauseKeyAlgorithm, "csr key type %T is not accepted by most CAs, use an rsa or ecdsa key", csr.PublicKey)
+	}
+	if c.keyPolicy != nil {
+		if err := c.keyPolicy(csr.PublicKey); err != nil {
+			add(CSRCauseWeakKey, "csr key rejected by key policy: %v", err)
+		}
+	}
+
+	switch csr.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		add(CSRCauseSignatureAlgorithm, "csr signature algorithm %v is insecure, sign it with sha-256 or stronger", csr.SignatureAlgorithm)
+	default:
+		if err := csr.CheckSignature(); err != nil {
+			add(CSRCauseSignatureAlgorithm, "csr signature is invalid: %v", err)
+		}
+	}
+
+	if account.PrivateKey != nil {
+		csrPrint, err1 := JWKThumbprint(csr.PublicKey)
+		accountPrint, err2 := JWKThumbprint(account.PrivateKey.Public())
+		if err1 == nil && err2 == nil && csrPrint == accountPrint {
+			add(CSRCauseAccountKey, "csr key is the account key, use a different key for the certificate")
+		}
+	}
+
+	return findings
+}
+
+// DiagnoseFinalizeError explains an error returned by Client.FinalizeOrder for a csr, if it is a badCSR problem,
+// returning the problem with the findings of DiagnoseCSR and the cause indicated by the problem detail if no local
+// finding has the same cause. Returns false if the error is not a badCSR problem.
+func (c Client) DiagnoseFinalizeError(err error, account Account, order Order, csr *x509.CertificateRequest) (CSRError, bool) {
+	prob, ok := err.(Problem)
+	if !ok || !strings.HasSuffix(prob.Type, ":badCSR") {
+		return CSRError{}, false
+	}
+	return c.csrError(prob, account, order, csr), true
+}
+
+// Helper function to diagnose a csr rejected with a badCSR problem.
+func (c Client) csrError(prob Problem, account Account, order Order, csr *x509.CertificateRequest) CSRError {
+	err := CSRError{
+		Problem:  prob,
+		Findings: c.DiagnoseCSR(account, order, csr),
+	}
+
+	detail := " " + strings.ToLower(prob.Detail) + " "
+	for _, kw := range csrProblemKeywords {
+		matched := false
+		for _, keyword := range kw.keywords {
+			if strings.Contains(detail, keyword) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, f := range err.Findings {
+			if f.Cause == kw.cause {
+				return err
+			}
+		}
+		err.Findings = append(err.Findings, CSRFinding{
+			Cause:  kw.cause,
+			Detail: fmt.Sprintf("acme server reported a %s problem not found locally, check its ca policy: %s", kw.cause, prob.Detail),
+		})
+		return err
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClient_DiagnoseCSR(t *testing.T) {
+	c := Client{}
+	account := Account{PrivateKey: makePrivateKey(t)}
+	order := Order{Identifiers: []Identifier{{Type: "dns", Value: "a.example.com"}, {Type: "dns", Value: "b.example.com"}}}
+
+	csr, err := newCSR(rand.Reader, makePrivateKey(t), order.Identifiers)
+	if err != nil {
+		t.Fatalf("unexpected error creating csr: %v", err)
+	}
+	if findings := c.DiagnoseCSR(account, order, csr); len(findings) != 0 {
+		t.Fatalf("expected no findings for a valid csr, got: %+v", findings)
+	}
+
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	tpl := &x509.CertificateRequest{DNSNames: []string{"a.example.com", "c.example.com"}}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tpl, p521)
+	if err != nil {
+		t.Fatalf("error creating csr: %v", err)
+	}
+	csr, err = x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatalf("error parsing csr: %v", err)
+	}
+	causes := map[string]string{}
+	for _, f := range c.DiagnoseCSR(account, order, csr) {
+		causes[f.Cause] += f.Detail + "\n"
+	}
+	if !strings.Contains(causes[CSRCauseIdentifiers], "dns:c.example.com") || !strings.Contains(causes[CSRCauseIdentifiers], "dns:b.example.com") {
+		t.Fatalf("expected extra and missing identifier findings, got: %v", causes)
+	}
+	if !strings.Contains(causes[CSRCauseKeyAlgorithm], "P-521") {
+		t.Fatalf("expected key algorithm finding, got: %v", causes)
+	}
+
+	// reusing the account key
+	csr, err = newCSR(rand.Reader, account.PrivateKey, order.Identifiers)
+	if err != nil {
+		t.Fatalf("unexpected error creating csr: %v", err)
+	}
+	findings := c.DiagnoseCSR(account, order, csr)
+	if len(findings) != 1 || findings[0].Cause != CSRCauseAccountKey {
+		t.Fatalf("expected account key finding, got: %+v", findings)
+	}
+
+	// causes reported by the server which aren't found locally are included
+	csrErr := c.csrError(Problem{Type: "urn:ietf:params:acme:error:badCSR", Detail: "Error finalizing order :: key too small"}, Account{}, order, csr)
+	if len(csrErr.Findings) != 1 || csrErr.Findings[0].Cause != CSRCauseWeakKey {
+		t.Fatalf("expected weak key finding from problem detail, got: %+v", csrErr.Findings)
+	}
+}
+
+func TestClient_FinalizeOrder_badCSR(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	order, err := c.NewOrderDomains(account, "a.example.test")
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	auth, err := c.FetchAuthorization(account, order.Authorizations[0])
+	if err != nil {
+		t.Fatalf("unexpected error fetching authorization: %v", err)
+	}
+	if _, err := c.UpdateChallenge(account, auth.ChallengeMap[ChallengeTypeHTTP01]); err != nil {
+		t.Fatalf("unexpected error updating challenge: %v", err)
+	}
+
+	ids := []Identifier{{Type: "dns", Value: "a.example.test"}, {Type: "dns", Value: "extra.example.test"}}
+	csr, err := newCSR(rand.Reader, makePrivateKey(t), ids)
+	if err != nil {
+		t.Fatalf("unexpected error creating csr: %v", err)
+	}
+	_, err = c.FinalizeOrder(account, order, csr)
+	if prob, ok := err.(Problem); !ok || prob.Type != "urn:ietf:params:acme:error:badCSR" {
+		t.Fatalf("expected badCSR problem, got: %v", err)
+	}
+	csrErr, ok := c.DiagnoseFinalizeError(err, account, order, csr)
+	if !ok {
+		t.Fatalf("expected csr error, got: %v", err)
+	}
+	if len(csrErr.Findings) != 1 || csrErr.Findings[0].Cause != CSRCauseIdentifiers || !strings.Contains(csrErr.Error(), "extra.example.test") {
+		t.Fatalf("expected extra identifier finding, got: %+v", csrErr.Findings)
+	}
+	if prob := ErrorProblem(csrErr); prob.HTTPStatus() != 400 || !strings.Contains(prob.Detail, "extra.example.test") {
+		t.Fatalf("expected relayed problem with findings, got: %+v", prob)
+	}
+
+	if _, ok := c.DiagnoseFinalizeError(errors.New("other error"), account, order, csr); ok {
+		t.Fatal("expected no csr error for another error")
+	}
+
+	// the order can be finalized again with a corrected csr
+	csr, err = c.NewOrderCSR(makePrivateKey(t), order)
+	if err != nil {
+		t.Fatalf("unexpected error creating csr: %v", err)
+	}
+	if order, err = c.FinalizeOrder(account, order, csr); err != nil || order.Status != "valid" {
+		t.Fatalf("expected order to be finalized, got: %s, %v", order.Status, err)
+	}
+}
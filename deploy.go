@@ -0,0 +1,357 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Different outcomes of deploying a certificate, see DeploymentStatus.
+const (
+	DeploymentStatusDeployed   = "deployed"
+	DeploymentStatusRolledBack = "rolledBack"
+	DeploymentStatusFailed     = "failed"
+)
+
+// Deployment is a certificate chain and its private key installed by a Deployer.
+type Deployment struct {
+	Identifiers []Identifier
+
+	// The certificate chain, leaf certificate first. Empty when rolling back if there was no previous deployment.
+	Certificates []*x509.Certificate
+
+	// The private key of the certificate, nil if not set on the Issuer.
+	PrivateKey crypto.Signer
+}
+
+// Deployer is implemented by types which install an issued certificate, eg writing files and reloading a web server,
+// or uploading it to a load balancer.
+type Deployer interface {
+	// Deploy installs a certificate.
+	Deploy(ctx context.Context, deployment Deployment) error
+
+	// Rollback restores the previous deployment after this or a later deployer failed to deploy a new certificate.
+	// The previous deployment has no certificates if none was previously deployed by the Issuer.
+	Rollback(ctx context.Context, previous Deployment) error
+}
+
+// DeploymentStatus records the outcome of deploying a certificate with the deployers of an Issuer.
+// It is kept in the Issuer store, if set, and can be read with Issuer.DeploymentStatus.
+type DeploymentStatus struct {
+	// One of DeploymentStatusDeployed, DeploymentStatusRolledBack or DeploymentStatusFailed if rolling back also
+	// failed, so the deployers may be left in an inconsistent state.
+	Status string `json:"status"`
+
+	// ARI unique identifier of the certificate which was deployed, see ARICertID, or its serial number if it has
+	// no authority key identifier.
+	CertID string `json:"certId"`
+
+	Time time.Time `json:"time"`
+
+	// Description of the failure, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Deploy installs a certificate chain with each of the issuer deployers in turn. If a deployer fails, the deployers
+// which have run, including the failed one, are rolled back in reverse order to the previous certificate deployed for
+// the identifiers.
+// The previous certificate and the status of the deployment are kept in the issuer store, if set. Without a store
+// deployers are rolled back to an empty deployment.
+// Issue calls Deploy once a certificate is issued if the issuer has any deployers.
+func (is Issuer) Deploy(ctx context.Context, identifiers []Identifier, certs []*x509.Certificate) (DeploymentStatus, error) {
+	status := DeploymentStatus{Time: time.Now()}
+
+	if len(certs) == 0 {
+		return status, errors.New("acme: no certificates to deploy")
+	}
+	status.CertID = deploymentCertID(certs[0])
+	if is.CertificateKey != nil && !samePublicKey(is.CertificateKey.Public(), certs[0].PublicKey) {
+		return status, errors.New("acme: certificate key does not match the certificate")
+	}
+
+	previous := Deployment{Identifiers: identifiers}
+	if is.Store != nil {
+		b, err := is.Store.Get(deploymentKey(identifiers, "certificate"))
+		if err != nil && err != ErrStoreNotFound {
+			return status, fmt.Errorf("acme: error reading previous deployment: %v", err)
+		}
+		if err == nil {
+			previous.Certificates, previous.PrivateKey, err = DecodeCertificate(b)
+			if err != nil {
+				return status, err
+			}
+		}
+	}
+
+	deployment := Deployment{Identifiers: identifiers, Certificates: certs, PrivateKey: is.CertificateKey}
+	var deployErr error
+	for i, d := range is.Deployers {
+		if err := d.Deploy(ctx, deployment); err != nil {
+			deployErr = fmt.Errorf("acme: error deploying certificate with deployer %d: %v", i, err)
+			status.Status = DeploymentStatusRolledBack
+			var rollbackErrs []string
+			for j := i; j >= 0; j-- {
+				if err := is.Deployers[j].Rollback(ctx, previous); err != nil {
+					rollbackErrs = append(rollbackErrs, fmt.Sprintf("deployer %d: %v", j, err))
+				}
+			}
+			if len(rollbackErrs) > 0 {
+				status.Status = DeploymentStatusFailed
+				deployErr = fmt.Errorf("%v, error rolling back %s", deployErr, strings.Join(rollbackErrs, ", "))
+			}
+			status.Error = deployErr.Error()
+			break
+		}
+	}
+	if deployErr == nil {
+		status.Status = DeploymentStatusDeployed
+	}
+
+	if is.Store == nil {
+		return status, deployErr
+	}
+
+	if deployErr == nil {
+		b, err := EncodeCertificate(certs, is.CertificateKey)
+		if err != nil {
+			return status, err
+		}
+		if err := is.Store.Put(deploymentKey(identifiers, "certificate"), b); err != nil {
+			return status, fmt.Errorf("acme: error storing deployment: %v", err)
+		}
+	}
+
+	b, err := json.Marshal(status)
+	if err != nil {
+		return status, fmt.Errorf("acme: error encoding deployment status: %v", err)
+	}
+	if err := is.Store.Put(deploymentKey(identifiers, "status"), b); err != nil && deployErr == nil {
+		deployErr = fmt.Errorf("acme: error storing deployment status: %v", err)
+	}
+
+	return status, deployErr
+}
+
+// DeploymentStatus returns the status of the last deployment of a certificate for the identifiers, read from the
+// issuer store. Returns ErrStoreNotFound if no certificate has been deployed.
+func (is Issuer) DeploymentStatus(identifiers []Identifier) (DeploymentStatus, error) {
+	var status DeploymentStatus
+	if is.Store == nil {
+		return status, errors.New("acme: issuer has no store")
+	}
+
+	b, err := is.Store.Get(deploymentKey(identifiers, "status"))
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(b, &status); err != nil {
+		return status, fmt.Errorf("acme: error parsing deployment status: %v", err)
+	}
+
+	return status, nil
+}
+
+// Helper function to get the store key of deployment data for a set of identifiers.
+func deploymentKey(identifiers []Identifier, name string) string {
+	return "deployments/" + identifiersHash(identifiers) + "/" + name
+}
+
+// Helper function to identify a deployed certificate.
+func deploymentCertID(cert *x509.Certificate) string {
+	if id, err := ARICertID(cert); err == nil {
+		return id
+	}
+	return cert.SerialNumber.String()
+}
+
+// Helper function to compare two public keys.
+func samePublicKey(a, b crypto.PublicKey) bool {
+	ab, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bb, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// FileDeployer is a Deployer which writes the pem encoded certificate chain and private key to files, then calls
+// Reload, eg to run "nginx -s reload".
+// Files are written to a temporary file first and renamed so a partially written file is never read. The key and
+// certificate files are each replaced atomically but not together, so a reader may briefly see the new key with the
+// old certificate, and should only use the files once Reload is called. Set KeyFile to the same file as CertFile to
+// write the key and chain together as a single file, which is replaced atomically.
+// The files replaced by Deploy are kept in memory so Rollback can restore them, so the same FileDeployer must be used
+// to deploy and roll back. A FileDeployer must not be copied after first use.
+type FileDeployer struct {
+	// File the certificate chain is written to, leaf certificate first.
+	CertFile string
+
+	// File the private key is written to, optional. The Issuer must have a CertificateKey if set.
+	// If the same as CertFile, the key is written before the certificate chain in the same file.
+	KeyFile string
+
+	// Called once the files are written, optional.
+	Reload func(ctx context.Context) error
+
+	lock  sync.Mutex
+	saved []savedFile
+}
+
+// Contents of a file before it was replaced by a FileDeployer.
+type savedFile struct {
+	name    string
+	existed bool
+	data    []byte
+	mode    os.FileMode
+}
+
+// Deploy implements Deployer.Deploy
+func (fd *FileDeployer) Deploy(ctx context.Context, deployment Deployment) error {
+	saved, err := fd.read()
+	if err != nil {
+		return err
+	}
+	fd.lock.Lock()
+	fd.saved = saved
+	fd.lock.Unlock()
+
+	if err := fd.write(deployment); err != nil {
+		return err
+	}
+	if fd.Reload == nil {
+		return nil
+	}
+	return fd.Reload(ctx)
+}
+
+// Rollback implements Deployer.Rollback
+// The files replaced by the last call to Deploy are restored and Reload is called. Files which didn't exist before
+// are removed, in which case Reload is not called. If Deploy wasn't called, eg since a restart, the previous
+// deployment is deployed again, and without a previous deployment the files are left in place.
+func (fd *FileDeployer) Rollback(ctx context.Context, previous Deployment) error {
+	fd.lock.Lock()
+	saved := fd.saved
+	fd.saved = nil
+	fd.lock.Unlock()
+
+	if saved == nil {
+		if len(previous.Certificates) == 0 {
+			return nil
+		}
+		return fd.Deploy(ctx, previous)
+	}
+
+	restored := false
+	for _, f := range saved {
+		if !f.existed {
+			if err := os.Remove(f.name); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("acme: error removing %s: %v", f.name, err)
+			}
+			continue
+		}
+		if err := writeFileAtomic(f.name, f.data, f.mode); err != nil {
+			return err
+		}
+		restored = true
+	}
+	if !restored || fd.Reload == nil {
+		return nil
+	}
+	return fd.Reload(ctx)
+}
+
+// Helper function to read the files which are replaced by a deployment.
+func (fd *FileDeployer) read() ([]savedFile, error) {
+	saved := []savedFile{}
+	for _, name := range []string{fd.KeyFile, fd.CertFile} {
+		// a combined key and certificate file is only saved once
+		if name == "" || (len(saved) > 0 && saved[0].name == name) {
+			continue
+		}
+		f := savedFile{name: name}
+		fi, err := os.Stat(name)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("acme: error reading %s: %v", name, err)
+		}
+		if err == nil {
+			f.existed = true
+			f.mode = fi.Mode().Perm()
+			if f.data, err = ioutil.ReadFile(name); err != nil {
+				return nil, fmt.Errorf("acme: error reading %s: %v", name, err)
+			}
+		}
+		saved = append(saved, f)
+	}
+	return saved, nil
+}
+
+// Helper function to write the certificate and key files of a deployment.
+func (fd *FileDeployer) write(deployment Deployment) error {
+	if fd.CertFile == "" {
+		return errors.New("acme: no certificate file")
+	}
+
+	var chain []byte
+	for _, cert := range deployment.Certificates {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	if fd.KeyFile == "" {
+		return writeFileAtomic(fd.CertFile, chain, 0644)
+	}
+
+	if deployment.PrivateKey == nil {
+		return errors.New("acme: no private key to deploy")
+	}
+	key, err := encodePrivateKey(deployment.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("acme: error encoding private key: %v", err)
+	}
+	if fd.KeyFile == fd.CertFile {
+		return writeFileAtomic(fd.CertFile, append([]byte(key), chain...), 0600)
+	}
+	if err := writeFileAtomic(fd.KeyFile, []byte(key), 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(fd.CertFile, chain, 0644)
+}
+
+// Helper function to write a file via a temporary file in the same directory and rename it into place.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("acme: error creating %s: %v", name, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("acme: error writing %s: %v", name, err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return fmt.Errorf("acme: error writing %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("acme: error writing %s: %v", name, err)
+	}
+
+	if err := os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("acme: error writing %s: %v", name, err)
+	}
+	return nil
+}
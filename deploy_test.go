@@ -0,0 +1,226 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Deployer recording the certificates deployed and rolled back
+type testDeployer struct {
+	deployErr, rollbackErr error
+	deployed, rolledBack   [][]byte
+}
+
+func (td *testDeployer) Deploy(ctx context.Context, deployment Deployment) error {
+	td.deployed = append(td.deployed, deployment.Certificates[0].Raw)
+	return td.deployErr
+}
+
+func (td *testDeployer) Rollback(ctx context.Context, previous Deployment) error {
+	var raw []byte
+	if len(previous.Certificates) > 0 {
+		raw = previous.Certificates[0].Raw
+	}
+	td.rolledBack = append(td.rolledBack, raw)
+	return td.rollbackErr
+}
+
+func TestIssuer_Deploy(t *testing.T) {
+	ids := []Identifier{{Type: "dns", Value: "example.com"}}
+	first, firstKey := makeSelfSigned(t, "example.com")
+	second, secondKey := makeSelfSigned(t, "example.com")
+
+	d1, d2 := &testDeployer{}, &testDeployer{}
+	is := Issuer{Store: &MemoryStore{}, Deployers: []Deployer{d1, d2}, CertificateKey: firstKey}
+
+	if _, err := is.DeploymentStatus(ids); err != ErrStoreNotFound {
+		t.Fatalf("expected no deployment status, got: %v", err)
+	}
+
+	status, err := is.Deploy(context.Background(), ids, []*x509.Certificate{first})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Status != DeploymentStatusDeployed || len(d1.deployed) != 1 || len(d2.deployed) != 1 {
+		t.Fatalf("expected certificate deployed by both deployers, got: %+v", status)
+	}
+
+	if _, err := is.Deploy(context.Background(), ids, []*x509.Certificate{second}); err == nil ||
+		!strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected key mismatch error, got: %v", err)
+	}
+
+	// second deployer fails, both roll back to the first certificate
+	is.CertificateKey = secondKey
+	d2.deployErr = errors.New("load balancer unavailable")
+	status, err = is.Deploy(context.Background(), ids, []*x509.Certificate{second})
+	if err == nil || !strings.Contains(err.Error(), "load balancer unavailable") {
+		t.Fatalf("expected deploy error, got: %v", err)
+	}
+	if status.Status != DeploymentStatusRolledBack {
+		t.Fatalf("expected rolled back status, got: %+v", status)
+	}
+	for i, d := range []*testDeployer{d1, d2} {
+		if len(d.rolledBack) != 1 || string(d.rolledBack[0]) != string(first.Raw) {
+			t.Fatalf("expected deployer %d rolled back to first certificate, got: %d rollbacks", i, len(d.rolledBack))
+		}
+	}
+	stored, err := is.DeploymentStatus(ids)
+	if err != nil {
+		t.Fatalf("unexpected error reading status: %v", err)
+	}
+	if stored.Status != DeploymentStatusRolledBack || stored.CertID != status.CertID || stored.Error == "" {
+		t.Fatalf("unexpected stored status: %+v", stored)
+	}
+
+	// first deployer fails and can't roll back
+	d1.deployErr, d1.rollbackErr = errors.New("disk full"), errors.New("still full")
+	status, err = is.Deploy(context.Background(), ids, []*x509.Certificate{second})
+	if err == nil || !strings.Contains(err.Error(), "still full") {
+		t.Fatalf("expected rollback error, got: %v", err)
+	}
+	if status.Status != DeploymentStatusFailed || len(d2.rolledBack) != 1 {
+		t.Fatalf("expected failed status without rolling back the second deployer, got: %+v", status)
+	}
+
+	if _, err := (Issuer{}).Deploy(context.Background(), ids, nil); err == nil {
+		t.Fatal("expected error deploying no certificates, got none")
+	}
+}
+
+func TestFileDeployer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme-deploy")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key := makeSelfSigned(t, "example.com")
+	var reloads int
+	fd := &FileDeployer{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		Reload: func(ctx context.Context) error {
+			reloads++
+			return nil
+		},
+	}
+	deployment := Deployment{Certificates: []*x509.Certificate{cert}, PrivateKey: key}
+
+	if err := fd.Deploy(context.Background(), deployment); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reloads != 1 {
+		t.Fatalf("expected 1 reload, got: %d", reloads)
+	}
+	b, err := ioutil.ReadFile(fd.CertFile)
+	if err != nil || !strings.HasPrefix(string(b), "-----BEGIN CERTIFICATE-----") {
+		t.Fatalf("expected certificate file, got: %s %v", b, err)
+	}
+	fi, err := os.Stat(fd.KeyFile)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected private key file, got: %v %v", fi, err)
+	}
+
+	if err := (&FileDeployer{CertFile: fd.CertFile, KeyFile: fd.KeyFile}).Deploy(context.Background(), Deployment{Certificates: deployment.Certificates}); err == nil {
+		t.Fatal("expected error deploying key file without key, got none")
+	}
+
+	// files created by the deployer are removed
+	if err := fd.Rollback(context.Background(), Deployment{}); err != nil {
+		t.Fatalf("unexpected error rolling back: %v", err)
+	}
+	for _, f := range []string{fd.CertFile, fd.KeyFile} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got: %v", f, err)
+		}
+	}
+}
+
+func TestFileDeployer_combined(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme-deploy")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key := makeSelfSigned(t, "example.com")
+	file := filepath.Join(dir, "combined.pem")
+	fd := &FileDeployer{CertFile: file, KeyFile: file}
+	if err := fd.Deploy(context.Background(), Deployment{Certificates: []*x509.Certificate{cert}, PrivateKey: key}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	if _, err := tls.X509KeyPair(b, b); err != nil {
+		t.Fatalf("expected combined key and certificate, got: %v", err)
+	}
+	if fi, err := os.Stat(file); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected private file, got: %v %v", fi, err)
+	}
+}
+
+func TestFileDeployer_Rollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme-deploy")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// files written by something else, eg an existing web server certificate
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, []byte("existing cert"), 0640); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, []byte("existing key"), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	var reloads int
+	fd := &FileDeployer{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Reload: func(ctx context.Context) error {
+			reloads++
+			if reloads == 1 {
+				return errors.New("reload failed")
+			}
+			return nil
+		},
+	}
+	cert, key := makeSelfSigned(t, "example.com")
+	is := Issuer{Deployers: []Deployer{fd}, CertificateKey: key}
+	status, err := is.Deploy(context.Background(), nil, []*x509.Certificate{cert})
+	if err == nil || status.Status != DeploymentStatusRolledBack {
+		t.Fatalf("expected deployment to be rolled back, got: %+v %v", status, err)
+	}
+	if reloads != 2 {
+		t.Fatalf("expected reload after restoring files, got %d reloads", reloads)
+	}
+	for f, expected := range map[string]string{certFile: "existing cert", keyFile: "existing key"} {
+		b, err := ioutil.ReadFile(f)
+		if err != nil || string(b) != expected {
+			t.Fatalf("expected %s to be restored, got: %q %v", f, b, err)
+		}
+	}
+	if fi, err := os.Stat(certFile); err != nil || fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode of %s to be restored, got: %v %v", certFile, fi, err)
+	}
+
+	// without a deploy to undo or a previous deployment the files are left in place
+	if err := fd.Rollback(context.Background(), Deployment{}); err != nil {
+		t.Fatalf("unexpected error rolling back: %v", err)
+	}
+	if b, err := ioutil.ReadFile(certFile); err != nil || string(b) != "existing cert" {
+		t.Fatalf("expected %s to be kept, got: %q %v", certFile, b, err)
+	}
+}
@@ -0,0 +1,1149 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DevCADirectoryURL is the directory url of a DevCA when accessed with the http client returned by DevCA.HTTPClient.
+// The host is never resolved, as requests are handled within the process.
+const DevCADirectoryURL = "https://acme.devca.invalid/dir"
+
+// Validity of certificates issued by a DevCA.
+const devCACertValidity = 90 * 24 * time.Hour
+
+// Maximum number of unused nonces kept by a DevCA, after which the oldest are forgotten.
+const devCAMaxNonces = 1000
+
+// Names and ip addresses a DevCA issues certificates for, also set as name constraints of its root so that trusting
+// the root doesn't allow it to issue certificates for public names.
+var (
+	devCAPermittedDNSDomains = []string{"localhost", ".test", ".local"}
+	devCAPermittedIPRanges   = []*net.IPNet{
+		{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+		{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+	}
+)
+
+// DevCA is a minimal acme server embedded in the process, for running applications locally with https without an
+// acme server such as pebble or network access, see AutoCert.DevMode.
+// All challenges are validated immediately once responded to, and certificates are issued directly by a self-signed
+// root, which must be trusted, eg installed in a browser, for the certificates to be trusted.
+// Certificates are only issued for localhost, names under .test or .local, and loopback ip addresses, which the root
+// is constrained to.
+// A DevCA is safe for concurrent use. It is not suitable for production use.
+type DevCA struct {
+	root    *x509.Certificate
+	rootKey crypto.Signer
+
+	lock     sync.Mutex
+	lastID   int
+	nonces   map[string]bool
+	nonceIDs []string
+	accounts map[string]*devAccount
+	orders   map[string]*devOrder
+	authzs   map[string]*devAuthz
+	certs    map[string]*devCert
+}
+
+type devAccount struct {
+	id         string
+	key        crypto.PublicKey
+	thumbprint string
+	status     string
+	contact    []string
+	orders     []string
+}
+
+type devOrder struct {
+	id          string
+	account     string
+	status      string
+	expires     time.Time
+	identifiers []Identifier
+	authzs      []string
+	cert        string
+}
+
+type devAuthz struct {
+	id         string
+	account    string
+	identifier Identifier
+	wildcard   bool
+	status     string
+	expires    time.Time
+	challenges []devChallenge
+}
+
+type devChallenge struct {
+	typ       string
+	token     string
+	status    string
+	validated time.Time
+}
+
+type devCert struct {
+	id      string
+	account string
+	cert    *x509.Certificate
+	revoked bool
+}
+
+// A verified request to a DevCA.
+type devRequest struct {
+	base    string
+	payload []byte
+	account *devAccount
+
+	// key of the request, if signed with a jwk rather than an account kid
+	jwk crypto.PublicKey
+}
+
+// NewDevCA creates a DevCA with a newly generated root certificate and key.
+func NewDevCA() (*DevCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error generating dev ca key: %v", err)
+	}
+
+	serial, err := devSerial()
+	if err != nil {
+		return nil, err
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "acme dev ca " + hex.EncodeToString(serial.Bytes()[:4])},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         devCAPermittedDNSDomains,
+		PermittedIPRanges:           devCAPermittedIPRanges,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error creating dev ca root: %v", err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error parsing dev ca root: %v", err)
+	}
+
+	return newDevCA(root, key), nil
+}
+
+// LoadDevCA loads a DevCA from the root certificate and key encoded by DevCA.PEM, so that the same root can be
+// trusted across restarts. Accounts, orders and certificates of the previous DevCA are not kept.
+func LoadDevCA(data []byte) (*DevCA, error) {
+	block, rest := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("acme: dev ca has no root certificate")
+	}
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error parsing dev ca root: %v", err)
+	}
+	key, err := decodePrivateKey(string(rest))
+	if err != nil {
+		return nil, fmt.Errorf("acme: error decoding dev ca key: %v", err)
+	}
+
+	rootPrint, err := JWKThumbprint(root.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error computing dev ca root thumbprint: %v", err)
+	}
+	keyPrint, err := JWKThumbprint(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("acme: error computing dev ca key thumbprint: %v", err)
+	}
+	if rootPrint != keyPrint {
+		return nil, errors.New("acme: dev ca key does not match root certificate")
+	}
+
+	return newDevCA(root, key), nil
+}
+
+// Helper function to create a DevCA with no state.
+func newDevCA(root *x509.Certificate, key crypto.Signer) *DevCA {
+	return &DevCA{
+		root:     root,
+		rootKey:  key,
+		nonces:   map[string]bool{},
+		accounts: map[string]*devAccount{},
+		orders:   map[string]*devOrder{},
+		authzs:   map[string]*devAuthz{},
+		certs:    map[string]*devCert{},
+	}
+}
+
+// Root returns the root certificate which issues the certificates of the DevCA.
+func (ca *DevCA) Root() *x509.Certificate {
+	return ca.root
+}
+
+// RootPEM returns the pem encoded root certificate of the DevCA, eg for installing in a browser or trust store.
+func (ca *DevCA) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})
+}
+
+// PEM returns the pem encoded root certificate and private key of the DevCA, which can be loaded with LoadDevCA.
+func (ca *DevCA) PEM() ([]byte, error) {
+	key, err := encodePrivateKey(ca.rootKey)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error encoding dev ca key: %v", err)
+	}
+	return append(ca.RootPEM(), key...), nil
+}
+
+// HTTPClient returns an http client which sends all requests to the DevCA within the process, regardless of host.
+func (ca *DevCA) HTTPClient() *http.Client {
+	return &http.Client{Transport: devCATransport{ca}}
+}
+
+// NewClient creates a Client for the DevCA, using its http client and any other options.
+func (ca *DevCA) NewClient(options ...OptionFunc) (Client, error) {
+	return NewClient(DevCADirectoryURL, append(options, WithHTTPClient(ca.HTTPClient()))...)
+}
+
+// Transport which handles requests with a DevCA within the process.
+type devCATransport struct {
+	ca *DevCA
+}
+
+// RoundTrip implements http.RoundTripper
+func (t devCATransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	// a round tripper must not modify the request
+	r := req.WithContext(req.Context())
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	w := &devResponseWriter{header: http.Header{}}
+	t.ca.ServeHTTP(w, r)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(w.body.Bytes())),
+		ContentLength: int64(w.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// Response written by a DevCA to a request handled by a devCATransport.
+type devResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter
+func (w *devResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *devResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write implements http.ResponseWriter
+func (w *devResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// ServeHTTP implements http.Handler, so a DevCA can also be served on a listener, eg for clients in other processes.
+// Resource urls are relative to the host of each request.
+func (ca *DevCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+
+	w.Header().Set("Replay-Nonce", ca.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.URL.Path {
+	case "/dir":
+		ca.writeJSON(w, http.StatusOK, Directory{
+			NewNonce:   base + "/new-nonce",
+			NewAccount: base + "/new-acct",
+			NewOrder:   base + "/new-order",
+			RevokeCert: base + "/revoke-cert",
+			KeyChange:  base + "/key-change",
+		})
+		return
+	case "/new-nonce":
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		WriteProblem(w, devProblem("malformed", "method not allowed", http.StatusMethodNotAllowed))
+		return
+	}
+
+	req, err := ca.verify(r, base)
+	if err != nil {
+		WriteProblem(w, err)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/new-acct":
+		err = ca.newAccount(w, req)
+	case r.URL.Path == "/key-change":
+		err = ca.keyChange(w, req)
+	case r.URL.Path == "/new-order":
+		err = ca.newOrder(w, req)
+	case r.URL.Path == "/revoke-cert":
+		err = ca.revokeCert(w, req)
+	case len(parts) == 2 && parts[0] == "acct":
+		err = ca.account(w, req, parts[1])
+	case len(parts) == 3 && parts[0] == "acct" && parts[2] == "orders":
+		err = ca.accountOrders(w, req, parts[1])
+	case len(parts) == 2 && parts[0] == "order":
+		err = ca.order(w, req, parts[1])
+	case len(parts) == 3 && parts[0] == "order" && parts[2] == "finalize":
+		err = ca.finalize(w, req, parts[1])
+	case len(parts) == 2 && parts[0] == "authz":
+		err = ca.authz(w, req, parts[1])
+	case len(parts) == 3 && parts[0] == "chal":
+		err = ca.challenge(w, req, parts[1], parts[2])
+	case len(parts) == 2 && parts[0] == "cert":
+		err = ca.cert(w, req, parts[1])
+	default:
+		err = devProblem("malformed", "resource not found", http.StatusNotFound)
+	}
+	if err != nil {
+		WriteProblem(w, err)
+	}
+}
+
+// Helper function to create a problem of an acme error type.
+func devProblem(typ, detail string, status int) Problem {
+	return Problem{
+		Type:   "urn:ietf:params:acme:error:" + typ,
+		Detail: detail,
+		Status: status,
+	}
+}
+
+// Helper function to create a random serial number.
+func devSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("acme: error creating serial number: %v", err)
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// Helper function to create a new unique resource id.
+func (ca *DevCA) nextID() string {
+	ca.lastID++
+	return strconv.Itoa(ca.lastID)
+}
+
+// Helper function to check whether an identifier is within the name constraints of a DevCA root.
+func devCAPermitted(id Identifier) bool {
+	if id.Type == IdentifierTypeIP {
+		ip := net.ParseIP(id.Value)
+		for _, network := range devCAPermittedIPRanges {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	name := normalizeDomain(strings.TrimPrefix(id.Value, "*."))
+	for _, domain := range devCAPermittedDNSDomains {
+		if strings.HasPrefix(domain, ".") {
+			if strings.HasSuffix(name, domain) {
+				return true
+			}
+		} else if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to create a nonce which may be used once.
+func (ca *DevCA) newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	ca.nonces[nonce] = true
+	ca.nonceIDs = append(ca.nonceIDs, nonce)
+	if len(ca.nonceIDs) > devCAMaxNonces {
+		delete(ca.nonces, ca.nonceIDs[0])
+		ca.nonceIDs = ca.nonceIDs[1:]
+	}
+	return nonce
+}
+
+// Helper function to write a json response.
+func (ca *DevCA) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		WriteProblem(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// Helper function to parse and verify a jws request, checking its nonce, url and signature.
+func (ca *DevCA) verify(r *http.Request, base string) (devRequest, error) {
+	req := devRequest{base: base}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return req, devProblem("malformed", "error reading request: "+err.Error(), http.StatusBadRequest)
+	}
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &jws); err != nil {
+		return req, devProblem("malformed", "invalid jws: "+err.Error(), http.StatusBadRequest)
+	}
+
+	header, pub, payload, err := devParseJWS(jws.Protected, jws.Payload, jws.Signature, ca.accountKey(base))
+	if err != nil {
+		return req, err
+	}
+	if !ca.nonces[header.Nonce] {
+		return req, devProblem("badNonce", "invalid nonce", http.StatusBadRequest)
+	}
+	delete(ca.nonces, header.Nonce)
+	if header.URL != base+r.URL.Path {
+		return req, devProblem("unauthorized", fmt.Sprintf("jws url %q does not match request url", header.URL), http.StatusUnauthorized)
+	}
+
+	req.payload = payload
+	if header.KID == "" {
+		if r.URL.Path != "/new-acct" && r.URL.Path != "/revoke-cert" {
+			return req, devProblem("malformed", "jwk may only be used to create accounts or revoke certificates", http.StatusBadRequest)
+		}
+		req.jwk = pub
+		return req, nil
+	}
+
+	account := ca.accounts[strings.TrimPrefix(header.KID, base+"/acct/")]
+	if account == nil || account.status != "valid" {
+		return req, devProblem("accountDoesNotExist", "no valid account for kid "+header.KID, http.StatusBadRequest)
+	}
+	req.account = account
+	return req, nil
+}
+
+// Protected header of a jws.
+type devHeader struct {
+	Alg   string          `json:"alg"`
+	JWK   json.RawMessage `json:"jwk"`
+	KID   string          `json:"kid"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+}
+
+// Helper function to return a function finding the key of an account by its kid.
+func (ca *DevCA) accountKey(base string) func(kid string) crypto.PublicKey {
+	return func(kid string) crypto.PublicKey {
+		if account := ca.accounts[strings.TrimPrefix(kid, base+"/acct/")]; account != nil {
+			return account.key
+		}
+		return nil
+	}
+}
+
+// Helper function to decode a jws and verify its signature, with either its jwk or the key of its kid.
+func devParseJWS(protected, payload, signature string, kidKey func(kid string) crypto.PublicKey) (devHeader, crypto.PublicKey, []byte, error) {
+	var header devHeader
+	b, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return header, nil, nil, devProblem("malformed", "invalid jws protected header: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return header, nil, nil, devProblem("malformed", "invalid jws protected header: "+err.Error(), http.StatusBadRequest)
+	}
+
+	var pub crypto.PublicKey
+	switch {
+	case len(header.JWK) > 0 && header.KID != "":
+		return header, nil, nil, devProblem("malformed", "jws has both jwk and kid", http.StatusBadRequest)
+	case len(header.JWK) > 0:
+		if pub, err = parseJWK(header.JWK); err != nil {
+			return header, nil, nil, devProblem("badPublicKey", err.Error(), http.StatusBadRequest)
+		}
+	case header.KID != "":
+		if pub = kidKey(header.KID); pub == nil {
+			return header, nil, nil, devProblem("accountDoesNotExist", "no account for kid "+header.KID, http.StatusBadRequest)
+		}
+	default:
+		return header, nil, nil, devProblem("malformed", "jws has no jwk or kid", http.StatusBadRequest)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return header, nil, nil, devProblem("malformed", "invalid jws signature: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := devVerifySignature(header.Alg, pub, []byte(protected+"."+payload), sig); err != nil {
+		return header, nil, nil, devProblem("malformed", err.Error(), http.StatusBadRequest)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return header, nil, nil, devProblem("malformed", "invalid jws payload: "+err.Error(), http.StatusBadRequest)
+	}
+	return header, pub, data, nil
+}
+
+// Helper function to decode an rsa or ecdsa public jwk.
+func parseJWK(data []byte) (crypto.PublicKey, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid jwk: %v", err)
+	}
+	decode := func(s string) *big.Int {
+		b, _ := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b)
+	}
+
+	switch jwk.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported jwk curve %q", jwk.Crv)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: decode(jwk.X), Y: decode(jwk.Y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("jwk point is not on curve")
+		}
+		return pub, nil
+	case "RSA":
+		e := decode(jwk.E)
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid jwk rsa exponent")
+		}
+		return &rsa.PublicKey{N: decode(jwk.N), E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwk key type %q", jwk.Kty)
+	}
+}
+
+// Helper function to verify a jws signature.
+func devVerifySignature(alg string, pub crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "ES384":
+		hash = crypto.SHA384
+	case "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported jws algorithm %q", alg)
+	}
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256(signed)
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384(signed)
+		digest = sum[:]
+	default:
+		sum := sha512.Sum512(signed)
+		digest = sum[:]
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("jws algorithm %q does not match rsa key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			return errors.New("invalid jws signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid jws signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid jws signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+	return nil
+}
+
+// Helper function to find an account by its key thumbprint.
+func (ca *DevCA) accountByThumbprint(thumbprint string) *devAccount {
+	for _, account := range ca.accounts {
+		if account.thumbprint == thumbprint {
+			return account
+		}
+	}
+	return nil
+}
+
+// Helper function to write an account response.
+func (ca *DevCA) writeAccount(w http.ResponseWriter, req devRequest, account *devAccount, status int) {
+	w.Header().Set("Location", req.base+"/acct/"+account.id)
+	ca.writeJSON(w, status, wireAccount{
+		Status:  account.status,
+		Contact: account.contact,
+		Orders:  req.base + "/acct/" + account.id + "/orders",
+	})
+}
+
+// Helper function to handle a new account request, returning any existing account for the key.
+func (ca *DevCA) newAccount(w http.ResponseWriter, req devRequest) error {
+	if req.jwk == nil {
+		return devProblem("malformed", "new account requests must be signed with a jwk", http.StatusBadRequest)
+	}
+	var payload struct {
+		Contact            []string `json:"contact"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		return devProblem("malformed", "invalid new account request: "+err.Error(), http.StatusBadRequest)
+	}
+
+	thumbprint, err := JWKThumbprint(req.jwk)
+	if err != nil {
+		return devProblem("badPublicKey", err.Error(), http.StatusBadRequest)
+	}
+	if account := ca.accountByThumbprint(thumbprint); account != nil {
+		ca.writeAccount(w, req, account, http.StatusOK)
+		return nil
+	}
+	if payload.OnlyReturnExisting {
+		return devProblem("accountDoesNotExist", "no account exists with the provided key", http.StatusBadRequest)
+	}
+
+	account := &devAccount{
+		id:         ca.nextID(),
+		key:        req.jwk,
+		thumbprint: thumbprint,
+		status:     "valid",
+		contact:    payload.Contact,
+	}
+	ca.accounts[account.id] = account
+	ca.writeAccount(w, req, account, http.StatusCreated)
+	return nil
+}
+
+// Helper function to handle an account update or fetch.
+func (ca *DevCA) account(w http.ResponseWriter, req devRequest, id string) error {
+	if req.account.id != id {
+		return devProblem("unauthorized", "account does not match kid", http.StatusForbidden)
+	}
+	if len(req.payload) > 0 {
+		var payload struct {
+			Status  string   `json:"status"`
+			Contact []string `json:"contact"`
+		}
+		if err := json.Unmarshal(req.payload, &payload); err != nil {
+			return devProblem("malformed", "invalid account update: "+err.Error(), http.StatusBadRequest)
+		}
+		switch payload.Status {
+		case "":
+		case "deactivated":
+			req.account.status = payload.Status
+		default:
+			return devProblem("malformed", "invalid account status "+payload.Status, http.StatusBadRequest)
+		}
+		if payload.Contact != nil {
+			req.account.contact = payload.Contact
+		}
+	}
+	ca.writeAccount(w, req, req.account, http.StatusOK)
+	return nil
+}
+
+// Helper function to handle a request for the orders of an account.
+func (ca *DevCA) accountOrders(w http.ResponseWriter, req devRequest, id string) error {
+	if req.account.id != id {
+		return devProblem("unauthorized", "account does not match kid", http.StatusForbidden)
+	}
+	orders := []string{}
+	for _, orderID := range req.account.orders {
+		orders = append(orders, req.base+"/order/"+orderID)
+	}
+	ca.writeJSON(w, http.StatusOK, struct {
+		Orders []string `json:"orders"`
+	}{orders})
+	return nil
+}
+
+// Helper function to handle an account key change.
+func (ca *DevCA) keyChange(w http.ResponseWriter, req devRequest) error {
+	var inner struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(req.payload, &inner); err != nil {
+		return devProblem("malformed", "invalid key change request: "+err.Error(), http.StatusBadRequest)
+	}
+	noKID := func(kid string) crypto.PublicKey { return nil }
+	header, newKey, payload, err := devParseJWS(inner.Protected, inner.Payload, inner.Signature, noKID)
+	if err != nil {
+		return err
+	}
+	if len(header.JWK) == 0 || header.URL != req.base+"/key-change" {
+		return devProblem("malformed", "invalid key change inner jws", http.StatusBadRequest)
+	}
+
+	var keyChange struct {
+		Account string          `json:"account"`
+		OldKey  json.RawMessage `json:"oldKey"`
+	}
+	if err := json.Unmarshal(payload, &keyChange); err != nil {
+		return devProblem("malformed", "invalid key change payload: "+err.Error(), http.StatusBadRequest)
+	}
+	if keyChange.Account != req.base+"/acct/"+req.account.id {
+		return devProblem("malformed", "key change account does not match kid", http.StatusBadRequest)
+	}
+	oldKey, err := parseJWK(keyChange.OldKey)
+	if err != nil {
+		return devProblem("malformed", "invalid key change old key: "+err.Error(), http.StatusBadRequest)
+	}
+	if oldPrint, _ := JWKThumbprint(oldKey); oldPrint != req.account.thumbprint {
+		return devProblem("malformed", "key change old key does not match account key", http.StatusBadRequest)
+	}
+
+	thumbprint, err := JWKThumbprint(newKey)
+	if err != nil {
+		return devProblem("badPublicKey", err.Error(), http.StatusBadRequest)
+	}
+	if existing := ca.accountByThumbprint(thumbprint); existing != nil {
+		w.Header().Set("Location", req.base+"/acct/"+existing.id)
+		return devProblem("malformed", "new key is already in use by an account", http.StatusConflict)
+	}
+
+	req.account.key = newKey
+	req.account.thumbprint = thumbprint
+	ca.writeAccount(w, req, req.account, http.StatusOK)
+	return nil
+}
+
+// Helper function to handle a new order request, creating a pending authorization for each identifier.
+func (ca *DevCA) newOrder(w http.ResponseWriter, req devRequest) error {
+	if req.account == nil {
+		return devProblem("malformed", "new order requests must be signed with an account kid", http.StatusBadRequest)
+	}
+	var payload struct {
+		Identifiers []Identifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		return devProblem("malformed", "invalid new order request: "+err.Error(), http.StatusBadRequest)
+	}
+	if len(payload.Identifiers) == 0 {
+		return devProblem("malformed", "order has no identifiers", http.StatusBadRequest)
+	}
+
+	order := &devOrder{
+		id:      ca.nextID(),
+		account: req.account.id,
+		status:  "pending",
+		expires: time.Now().Add(7 * 24 * time.Hour),
+	}
+	for _, id := range payload.Identifiers {
+		switch {
+		case id.Type == IdentifierTypeDNS && id.Value != "":
+		case id.Type == IdentifierTypeIP && net.ParseIP(id.Value) != nil:
+		default:
+			return devProblem("unsupportedIdentifier", fmt.Sprintf("unsupported identifier %s:%s", id.Type, id.Value), http.StatusBadRequest)
+		}
+		if !devCAPermitted(id) {
+			return devProblem("rejectedIdentifier", fmt.Sprintf("dev ca only issues certificates for localhost, .test and .local names and loopback addresses, not %s:%s", id.Type, id.Value), http.StatusBadRequest)
+		}
+
+		authz := &devAuthz{
+			id:         ca.nextID(),
+			account:    req.account.id,
+			identifier: id,
+			status:     "pending",
+			expires:    order.expires,
+		}
+		if strings.HasPrefix(id.Value, "*.") {
+			authz.identifier.Value = strings.TrimPrefix(id.Value, "*.")
+			authz.wildcard = true
+		}
+		types := []string{ChallengeTypeHTTP01, ChallengeTypeDNS01, ChallengeTypeTLSALPN01}
+		if authz.wildcard {
+			types = []string{ChallengeTypeDNS01}
+		}
+		for _, typ := range types {
+			b := make([]byte, 32)
+			_, _ = rand.Read(b)
+			authz.challenges = append(authz.challenges, devChallenge{
+				typ:    typ,
+				token:  base64.RawURLEncoding.EncodeToString(b),
+				status: "pending",
+			})
+		}
+		ca.authzs[authz.id] = authz
+
+		order.identifiers = append(order.identifiers, id)
+		order.authzs = append(order.authzs, authz.id)
+	}
+	ca.orders[order.id] = order
+	req.account.orders = append(req.account.orders, order.id)
+
+	w.Header().Set("Location", req.base+"/order/"+order.id)
+	ca.writeJSON(w, http.StatusCreated, ca.wireOrder(req, order))
+	return nil
+}
+
+// Helper function to update the status of a pending order from the statuses of its authorizations.
+func (ca *DevCA) updateOrderStatus(order *devOrder) {
+	if order.status != "pending" {
+		return
+	}
+	ready := true
+	for _, id := range order.authzs {
+		switch ca.authzs[id].status {
+		case "valid":
+		case "pending":
+			ready = false
+		default:
+			order.status = "invalid"
+			return
+		}
+	}
+	if ready {
+		order.status = "ready"
+	}
+}
+
+// Helper function to create the wire representation of an order.
+func (ca *DevCA) wireOrder(req devRequest, order *devOrder) wireOrder {
+	ca.updateOrderStatus(order)
+	wo := wireOrder{
+		Status:      order.status,
+		Expires:     order.expires.UTC().Format(time.RFC3339),
+		Identifiers: order.identifiers,
+		Finalize:    req.base + "/order/" + order.id + "/finalize",
+	}
+	for _, id := range order.authzs {
+		wo.Authorizations = append(wo.Authorizations, req.base+"/authz/"+id)
+	}
+	if order.cert != "" {
+		wo.Certificate = req.base + "/cert/" + order.cert
+	}
+	return wo
+}
+
+// Helper function to handle an order fetch.
+func (ca *DevCA) order(w http.ResponseWriter, req devRequest, id string) error {
+	order := ca.orders[id]
+	if order == nil || req.account == nil || order.account != req.account.id {
+		return devProblem("malformed", "order not found", http.StatusNotFound)
+	}
+	ca.writeJSON(w, http.StatusOK, ca.wireOrder(req, order))
+	return nil
+}
+
+// Helper function to handle an authorization fetch or deactivation.
+func (ca *DevCA) authz(w http.ResponseWriter, req devRequest, id string) error {
+	authz := ca.authzs[id]
+	if authz == nil || req.account == nil || authz.account != req.account.id {
+		return devProblem("malformed", "authorization not found", http.StatusNotFound)
+	}
+	if len(req.payload) > 0 {
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(req.payload, &payload); err != nil {
+			return devProblem("malformed", "invalid authorization update: "+err.Error(), http.StatusBadRequest)
+		}
+		if payload.Status != "deactivated" {
+			return devProblem("malformed", "invalid authorization status "+payload.Status, http.StatusBadRequest)
+		}
+		authz.status = payload.Status
+	}
+	ca.writeJSON(w, http.StatusOK, ca.wireAuthz(req, authz))
+	return nil
+}
+
+// Helper function to create the wire representation of an authorization.
+func (ca *DevCA) wireAuthz(req devRequest, authz *devAuthz) wireAuthorization {
+	wa := wireAuthorization{
+		Identifier: authz.identifier,
+		Status:     authz.status,
+		Expires:    authz.expires.UTC().Format(time.RFC3339),
+		Wildcard:   authz.wildcard,
+	}
+	for i := range authz.challenges {
+		wa.Challenges = append(wa.Challenges, ca.wireChallenge(req, authz, i))
+	}
+	return wa
+}
+
+// Helper function to create the wire representation of a challenge.
+func (ca *DevCA) wireChallenge(req devRequest, authz *devAuthz, i int) wireChallenge {
+	chal := authz.challenges[i]
+	wc := wireChallenge{
+		Type:   chal.typ,
+		URL:    req.base + "/chal/" + authz.id + "/" + strconv.Itoa(i),
+		Status: chal.status,
+		Token:  chal.token,
+	}
+	if !chal.validated.IsZero() {
+		wc.Validated = chal.validated.UTC().Format(time.RFC3339)
+	}
+	return wc
+}
+
+// Helper function to handle a challenge fetch or response.
+func (ca *DevCA) challenge(w http.ResponseWriter, req devRequest, authzID, index string) error {
+	authz := ca.authzs[authzID]
+	i, err := strconv.Atoi(index)
+	if authz == nil || err != nil || i < 0 || i >= len(authz.challenges) || req.account == nil || authz.account != req.account.id {
+		return devProblem("malformed", "challenge not found", http.StatusNotFound)
+	}
+
+	// responding to a challenge validates it immediately
+	if len(req.payload) > 0 && authz.challenges[i].status == "pending" {
+		if authz.status != "pending" {
+			return devProblem("malformed", "authorization is "+authz.status, http.StatusBadRequest)
+		}
+		authz.challenges[i].status = "valid"
+		authz.challenges[i].validated = time.Now()
+		authz.status = "valid"
+	}
+
+	w.Header().Add("Link", `<`+req.base+"/authz/"+authz.id+`>;rel="up"`)
+	ca.writeJSON(w, http.StatusOK, ca.wireChallenge(req, authz, i))
+	return nil
+}
+
+// Helper function to handle an order finalize request, issuing a certificate for its csr.
+func (ca *DevCA) finalize(w http.ResponseWriter, req devRequest, id string) error {
+	order := ca.orders[id]
+	if order == nil || req.account == nil || order.account != req.account.id {
+		return devProblem("malformed", "order not found", http.StatusNotFound)
+	}
+	ca.updateOrderStatus(order)
+	if order.status != "ready" {
+		return devProblem("orderNotReady", "order is "+order.status, http.StatusForbidden)
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		return devProblem("malformed", "invalid finalize request: "+err.Error(), http.StatusBadRequest)
+	}
+	der, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		return devProblem("badCSR", "invalid csr encoding: "+err.Error(), http.StatusBadRequest)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return devProblem("badCSR", "invalid csr: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return devProblem("badCSR", "invalid csr signature: "+err.Error(), http.StatusBadRequest)
+	}
+
+	if err := devCheckCSRIdentifiers(csr, order.identifiers); err != nil {
+		return devProblem("badCSR", err.Error(), http.StatusBadRequest)
+	}
+
+	serial, err := devSerial()
+	if err != nil {
+		return err
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: csr.Subject.CommonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devCACertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tpl, ca.root, csr.PublicKey, ca.rootKey)
+	if err != nil {
+		return fmt.Errorf("acme: error creating dev ca certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return fmt.Errorf("acme: error parsing dev ca certificate: %v", err)
+	}
+
+	issued := &devCert{id: ca.nextID(), account: order.account, cert: cert}
+	ca.certs[issued.id] = issued
+	order.cert = issued.id
+	order.status = "valid"
+
+	w.Header().Set("Location", req.base+"/order/"+order.id)
+	ca.writeJSON(w, http.StatusOK, ca.wireOrder(req, order))
+	return nil
+}
+
+// Helper function to check the names of a csr match the identifiers of an order.
+func devCheckCSRIdentifiers(csr *x509.CertificateRequest, identifiers []Identifier) error {
+	names := map[string]bool{}
+	for _, name := range csr.DNSNames {
+		names[IdentifierTypeDNS+":"+strings.ToLower(name)] = true
+	}
+	for _, ip := range csr.IPAddresses {
+		names[IdentifierTypeIP+":"+ip.String()] = true
+	}
+	if cn := csr.Subject.CommonName; cn != "" && !names[IdentifierTypeDNS+":"+strings.ToLower(cn)] && !names[IdentifierTypeIP+":"+cn] {
+		return fmt.Errorf("csr common name %q is not in its subject alternative names", cn)
+	}
+
+	expected := map[string]bool{}
+	for _, id := range identifiers {
+		value := strings.ToLower(id.Value)
+		if id.Type == IdentifierTypeIP {
+			value = net.ParseIP(id.Value).String()
+		}
+		expected[id.Type+":"+value] = true
+	}
+	for name := range names {
+		if !expected[name] {
+			return fmt.Errorf("csr name %s is not an identifier of the order", name)
+		}
+	}
+	for name := range expected {
+		if !names[name] {
+			return fmt.Errorf("order identifier %s is missing from the csr", name)
+		}
+	}
+	return nil
+}
+
+// Helper function to handle a certificate download.
+func (ca *DevCA) cert(w http.ResponseWriter, req devRequest, id string) error {
+	issued := ca.certs[id]
+	if issued == nil || req.account == nil || issued.account != req.account.id {
+		return devProblem("malformed", "certificate not found", http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: issued.cert.Raw})
+	return nil
+}
+
+// Helper function to handle a certificate revocation, signed by the issuing account or the certificate key.
+func (ca *DevCA) revokeCert(w http.ResponseWriter, req devRequest) error {
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      *int   `json:"reason"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		return devProblem("malformed", "invalid revocation request: "+err.Error(), http.StatusBadRequest)
+	}
+	der, err := base64.RawURLEncoding.DecodeString(payload.Certificate)
+	if err != nil {
+		return devProblem("malformed", "invalid certificate encoding: "+err.Error(), http.StatusBadRequest)
+	}
+	if payload.Reason != nil && (*payload.Reason < 0 || *payload.Reason == 7 || *payload.Reason > 10) {
+		return devProblem("badRevocationReason", fmt.Sprintf("invalid revocation reason %d", *payload.Reason), http.StatusBadRequest)
+	}
+
+	var issued *devCert
+	for _, c := range ca.certs {
+		if bytes.Equal(c.cert.Raw, der) {
+			issued = c
+			break
+		}
+	}
+	if issued == nil {
+		return devProblem("malformed", "certificate was not issued by this ca", http.StatusNotFound)
+	}
+
+	switch {
+	case req.account != nil:
+		if issued.account != req.account.id {
+			return devProblem("unauthorized", "account did not issue the certificate", http.StatusForbidden)
+		}
+	default:
+		keyPrint, _ := JWKThumbprint(req.jwk)
+		certPrint, _ := JWKThumbprint(issued.cert.PublicKey)
+		if account := ca.accountByThumbprint(keyPrint); (account == nil || account.id != issued.account) && keyPrint != certPrint {
+			return devProblem("unauthorized", "key is not authorized to revoke the certificate", http.StatusForbidden)
+		}
+	}
+
+	if issued.revoked {
+		return devProblem("alreadyRevoked", "certificate is already revoked", http.StatusBadRequest)
+	}
+	issued.revoked = true
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,218 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDevCA(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	account, err := c.NewAccount(makePrivateKey(t), false, true, "mailto:dev@example.test")
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	existing, err := c.NewAccount(account.PrivateKey, true, true)
+	if err != nil || existing.URL != account.URL {
+		t.Fatalf("expected existing account %s, got: %s, %v", account.URL, existing.URL, err)
+	}
+
+	ids := []Identifier{{Type: "dns", Value: "localhost"}, {Type: "dns", Value: "*.example.test"}, {Type: "ip", Value: "127.0.0.1"}}
+	key := makePrivateKey(t)
+	csr, err := newCSR(rand.Reader, key, ids)
+	if err != nil {
+		t.Fatalf("unexpected error creating csr: %v", err)
+	}
+	is := Issuer{
+		Client:  c,
+		Account: account,
+		Solvers: map[string]Solver{ChallengeTypeHTTP01: noopSolver{}, ChallengeTypeDNS01: noopSolver{}},
+	}
+	result, err := is.Issue(context.Background(), ids, csr)
+	if err != nil {
+		t.Fatalf("unexpected error issuing certificate: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root())
+	if _, err := VerifyCertificates(result.Certificates, x509.VerifyOptions{Roots: roots}, "localhost", "www.example.test", "127.0.0.1"); err != nil {
+		t.Fatalf("unexpected error verifying certificate: %v", err)
+	}
+
+	// a csr which doesn't match the order is rejected
+	order, err := c.NewOrder(account, ids[:1])
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	auth, err := c.FetchAuthorization(account, order.Authorizations[0])
+	if err != nil {
+		t.Fatalf("unexpected error fetching authorization: %v", err)
+	}
+	if _, err := c.UpdateChallenge(account, auth.ChallengeMap[ChallengeTypeHTTP01]); err != nil {
+		t.Fatalf("unexpected error updating challenge: %v", err)
+	}
+	if _, err := c.FinalizeOrder(account, order, csr); err == nil || !strings.Contains(err.Error(), "badCSR") {
+		t.Fatalf("expected badCSR error, got: %v", err)
+	}
+
+	if err := c.RevokeCertificate(account, result.Certificates[0], key, ReasonKeyCompromise); err != nil {
+		t.Fatalf("unexpected error revoking certificate: %v", err)
+	}
+	if err := c.RevokeCertificate(account, result.Certificates[0], account.PrivateKey, ReasonUnspecified); err == nil || !strings.Contains(err.Error(), "alreadyRevoked") {
+		t.Fatalf("expected alreadyRevoked error, got: %v", err)
+	}
+
+	rolled, err := c.AccountKeyChange(account, makePrivateKey(t))
+	if err != nil {
+		t.Fatalf("unexpected error changing account key: %v", err)
+	}
+	if _, err := c.FetchOrderList(rolled); err != nil {
+		t.Fatalf("unexpected error fetching orders with new key: %v", err)
+	}
+	if _, err := c.NewAccount(account.PrivateKey, true, true); err == nil {
+		t.Fatal("expected old account key to no longer exist, got none")
+	}
+
+	// loaded ca has the same root, and can be served on a listener
+	data, err := ca.PEM()
+	if err != nil {
+		t.Fatalf("unexpected error encoding dev ca: %v", err)
+	}
+	loaded, err := LoadDevCA(data)
+	if err != nil {
+		t.Fatalf("unexpected error loading dev ca: %v", err)
+	}
+	if !loaded.Root().Equal(ca.Root()) {
+		t.Fatal("expected loaded dev ca to have the same root")
+	}
+	if _, err := LoadDevCA(ca.RootPEM()); err == nil {
+		t.Fatal("expected error loading dev ca without key, got none")
+	}
+
+	srv := httptest.NewServer(loaded)
+	defer srv.Close()
+	served, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client for served dev ca: %v", err)
+	}
+	if _, err := served.NewAccount(makePrivateKey(t), false, true); err != nil {
+		t.Fatalf("unexpected error creating account on served dev ca: %v", err)
+	}
+}
+
+func TestDevCA_constraints(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	if !ca.Root().PermittedDNSDomainsCritical || len(ca.Root().PermittedDNSDomains) == 0 || len(ca.Root().PermittedIPRanges) == 0 {
+		t.Fatalf("expected dev ca root to have name constraints, got: %v %v", ca.Root().PermittedDNSDomains, ca.Root().PermittedIPRanges)
+	}
+
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	for _, id := range []Identifier{{Type: "dns", Value: "example.com"}, {Type: "dns", Value: "test"}, {Type: "ip", Value: "10.0.0.1"}} {
+		if _, err := c.NewOrder(account, []Identifier{id}); err == nil || !strings.Contains(err.Error(), "rejectedIdentifier") {
+			t.Fatalf("expected %s:%s to be rejected, got: %v", id.Type, id.Value, err)
+		}
+	}
+	for _, id := range []Identifier{{Type: "dns", Value: "a.localhost"}, {Type: "dns", Value: "*.example.test"}, {Type: "dns", Value: "host.local"}, {Type: "ip", Value: "::1"}} {
+		if _, err := c.NewOrder(account, []Identifier{id}); err != nil {
+			t.Fatalf("unexpected error creating order for %s:%s: %v", id.Type, id.Value, err)
+		}
+	}
+}
+
+func TestDevCA_nonces(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	first := ca.newNonce()
+	for i := 0; i < devCAMaxNonces; i++ {
+		ca.newNonce()
+	}
+	if len(ca.nonces) != devCAMaxNonces || len(ca.nonceIDs) != devCAMaxNonces {
+		t.Fatalf("expected %d nonces, got: %d %d", devCAMaxNonces, len(ca.nonces), len(ca.nonceIDs))
+	}
+	if ca.nonces[first] {
+		t.Fatal("expected oldest nonce to be forgotten")
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestDevCA_RoundTrip(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	body := &closeRecorder{Reader: strings.NewReader("{}")}
+	req, err := http.NewRequest(http.MethodPost, DevCADirectoryURL, body)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	resp, err := ca.HTTPClient().Transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if !body.closed {
+		t.Fatal("expected request body to be closed")
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Replay-Nonce") == "" || resp.Request != req {
+		t.Fatalf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestAutoCert_DevMode(t *testing.T) {
+	m := &AutoCert{DevMode: true}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+	ca, err := m.DevCA()
+	if err != nil {
+		t.Fatalf("unexpected error getting dev ca: %v", err)
+	}
+	if err := cert.Leaf.CheckSignatureFrom(ca.Root()); err != nil {
+		t.Fatalf("expected certificate issued by dev ca: %v", err)
+	}
+
+	again, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error getting existing certificate: %v", err)
+	}
+	if !again.Leaf.Equal(cert.Leaf) {
+		t.Fatal("expected existing certificate to be reused")
+	}
+}
@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// DirectoryChange describes the differences between a cached directory and a re-fetched one, provided to the hook
+// set with WithDirectoryChangeHook.
+type DirectoryChange struct {
+	Old Directory
+	New Directory
+
+	// Human readable description of each change, eg "renewalInfo added" or "meta.termsOfService changed".
+	Changes []string
+}
+
+// The directory of a Client, shared between copies so a refreshed directory is used by all of them.
+type directoryCache struct {
+	lock      sync.RWMutex
+	directory Directory
+}
+
+func newDirectoryCache(dir Directory) *directoryCache {
+	return &directoryCache{directory: dir}
+}
+
+func (dc *directoryCache) get() Directory {
+	if dc == nil {
+		return Directory{}
+	}
+	dc.lock.RLock()
+	defer dc.lock.RUnlock()
+	return dc.directory
+}
+
+// Replaces the cached directory, returning the previous one.
+func (dc *directoryCache) set(dir Directory) Directory {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+	old := dc.directory
+	dc.directory = dir
+	return old
+}
+
+// RefreshDirectory fetches the directory again, replacing the directory used by this client and all copies of it.
+// If it differs from the previous directory, eg a new endpoint, changed terms of service or new profiles, the hook
+// set with WithDirectoryChangeHook is called. Long running programs can call this periodically to pick up changes to
+// the capabilities of a CA.
+func (c Client) RefreshDirectory() (Directory, error) {
+	if c.dir == nil {
+		return Directory{}, fmt.Errorf("acme: client has no directory")
+	}
+	old := c.dir.get()
+
+	dir := Directory{URL: old.URL}
+	if _, err := c.get(old.URL, &dir, http.StatusOK); err != nil {
+		return old, err
+	}
+	old = c.dir.set(dir)
+
+	if changes := diffDirectory(old, dir); len(changes) > 0 && c.directoryHook != nil {
+		c.directoryHook(DirectoryChange{Old: old, New: dir, Changes: changes})
+	}
+
+	return dir, nil
+}
+
+// Helper function to describe the differences between two directories.
+func diffDirectory(old, new Directory) []string {
+	var changes []string
+	diff := func(name, o, n string) {
+		switch {
+		case o == n:
+		case o == "":
+			changes = append(changes, name+" added")
+		case n == "":
+			changes = append(changes, name+" removed")
+		default:
+			changes = append(changes, name+" changed")
+		}
+	}
+
+	diff("newNonce", old.NewNonce, new.NewNonce)
+	diff("newAccount", old.NewAccount, new.NewAccount)
+	diff("newOrder", old.NewOrder, new.NewOrder)
+	diff("newAuthz", old.NewAuthz, new.NewAuthz)
+	diff("revokeCert", old.RevokeCert, new.RevokeCert)
+	diff("keyChange", old.KeyChange, new.KeyChange)
+	diff("renewalInfo", old.RenewalInfo, new.RenewalInfo)
+	diff("meta.termsOfService", old.Meta.TermsOfService, new.Meta.TermsOfService)
+	diff("meta.website", old.Meta.Website, new.Meta.Website)
+
+	if !reflect.DeepEqual(old.Meta.CaaIdentities, new.Meta.CaaIdentities) {
+		changes = append(changes, "meta.caaIdentities changed")
+	}
+	if old.Meta.ExternalAccountRequired != new.Meta.ExternalAccountRequired {
+		changes = append(changes, "meta.externalAccountRequired changed")
+	}
+
+	var profiles []string
+	for name := range old.Meta.Profiles {
+		profiles = append(profiles, name)
+	}
+	for name := range new.Meta.Profiles {
+		if _, ok := old.Meta.Profiles[name]; !ok {
+			profiles = append(profiles, name)
+		}
+	}
+	sort.Strings(profiles)
+	for _, name := range profiles {
+		o, inOld := old.Meta.Profiles[name]
+		n, inNew := new.Meta.Profiles[name]
+		switch {
+		case !inOld:
+			changes = append(changes, "meta.profiles."+name+" added")
+		case !inNew:
+			changes = append(changes, "meta.profiles."+name+" removed")
+		case o != n:
+			changes = append(changes, "meta.profiles."+name+" changed")
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,66 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_RefreshDirectory(t *testing.T) {
+	var srv *httptest.Server
+	var refreshed int32
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&refreshed) == 0 {
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce","meta":{"termsOfService":"` + srv.URL + `/tos-1"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce","renewalInfo":"` + srv.URL + `/ari",` +
+			`"meta":{"termsOfService":"` + srv.URL + `/tos-2","profiles":{"shortlived":"6 day certificates"}}}`))
+	}))
+	defer srv.Close()
+
+	var changes []DirectoryChange
+	c, err := NewClient(srv.URL, WithDirectoryChangeHook(func(change DirectoryChange) {
+		changes = append(changes, change)
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	copied := c
+
+	if _, err := c.RefreshDirectory(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes for identical directory, got: %+v", changes)
+	}
+
+	atomic.StoreInt32(&refreshed, 1)
+	dir, err := c.RefreshDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dir.URL != srv.URL || dir.RenewalInfo != srv.URL+"/ari" {
+		t.Fatalf("unexpected refreshed directory: %+v", dir)
+	}
+	if !reflect.DeepEqual(copied.Directory(), dir) {
+		t.Fatalf("expected copied client to share refreshed directory, got: %+v", copied.Directory())
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change notification, got: %d", len(changes))
+	}
+	expected := []string{"renewalInfo added", "meta.termsOfService changed", "meta.profiles.shortlived added"}
+	if !reflect.DeepEqual(changes[0].Changes, expected) {
+		t.Fatalf("expected changes %q, got: %q", expected, changes[0].Changes)
+	}
+	if changes[0].Old.Meta.TermsOfService != srv.URL+"/tos-1" || changes[0].New.Meta.TermsOfService != srv.URL+"/tos-2" {
+		t.Fatalf("unexpected old and new directories: %+v", changes[0])
+	}
+
+	if _, err := (Client{}).RefreshDirectory(); err == nil {
+		t.Fatal("expected error refreshing client without directory, got none")
+	}
+}
@@ -0,0 +1,83 @@
+package acme
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultDNSChangeTTL is the suggested ttl, in seconds, of the records returned by DNSChanges.
+const DefaultDNSChangeTTL = 60
+
+// DNSChange is a dns record which must be created to fulfil the dns-01 challenge of an authorization.
+// See https://tools.ietf.org/html/rfc8555#section-8.4
+type DNSChange struct {
+	// Fully qualified name of the record, eg "_acme-challenge.example.com."
+	Name string `json:"name"`
+
+	// Type of the record, always "TXT"
+	Type string `json:"type"`
+
+	// Value of the record
+	Value string `json:"value"`
+
+	// Suggested ttl of the record in seconds
+	TTL int `json:"ttl"`
+
+	// The identifier and authorization the record is for
+	Identifier       Identifier `json:"identifier"`
+	AuthorizationURL string     `json:"authorizationUrl"`
+
+	// The dns-01 challenge fulfilled by the record, used by CompleteDNSChanges.
+	Challenge Challenge `json:"challenge"`
+}
+
+// DNSChanges returns the dns records which must be created to fulfil the pending authorizations of an order with
+// dns-01 challenges, without creating them or updating any challenges.
+// This allows the records to be created by an external process, eg a deployment pipeline, after which
+// CompleteDNSChanges tells the server to validate them.
+func (c Client) DNSChanges(account Account, order Order) ([]DNSChange, error) {
+	var changes []DNSChange
+
+	for _, authURL := range order.Authorizations {
+		auth, err := c.FetchAuthorization(account, authURL)
+		if err != nil {
+			return changes, err
+		}
+
+		switch auth.Status {
+		case "valid":
+			continue
+		case "pending":
+		default:
+			return changes, fmt.Errorf("acme: authorization %s for %s has status %q", authURL, auth.Identifier.Value, auth.Status)
+		}
+
+		chal, ok := auth.ChallengeMap[ChallengeTypeDNS01]
+		if !ok {
+			return changes, fmt.Errorf("acme: no dns-01 challenge in authorization for %s, challenges: %v", auth.Identifier.Value, auth.ChallengeTypes)
+		}
+
+		changes = append(changes, DNSChange{
+			Name:             "_acme-challenge." + strings.TrimSuffix(strings.TrimPrefix(auth.Identifier.Value, "*."), ".") + ".",
+			Type:             "TXT",
+			Value:            EncodeDNS01KeyAuthorization(chal.KeyAuthorization),
+			TTL:              DefaultDNSChangeTTL,
+			Identifier:       auth.Identifier,
+			AuthorizationURL: authURL,
+			Challenge:        chal,
+		})
+	}
+
+	return changes, nil
+}
+
+// CompleteDNSChanges tells the server to validate the challenges of dns changes returned by DNSChanges, once the
+// records have been created, waiting for each challenge to be validated.
+func (c Client) CompleteDNSChanges(account Account, changes []DNSChange) error {
+	for _, change := range changes {
+		if _, err := c.UpdateChallenge(account, change.Challenge); err != nil {
+			return fmt.Errorf("acme: error validating dns change %s for %s: %v", change.Name, change.Identifier.Value, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package acme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClient_DNSChanges(t *testing.T) {
+	domain := randString() + ".com"
+	account, order := makeOrder(t, Identifier{Type: "dns", Value: domain})
+
+	changes, err := testClient.DNSChanges(account, order)
+	if err != nil {
+		t.Fatalf("unexpected error getting dns changes: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 dns change, got: %d", len(changes))
+	}
+
+	change := changes[0]
+	if change.Name != "_acme-challenge."+domain+"." || change.Type != "TXT" || change.TTL != DefaultDNSChangeTTL {
+		t.Fatalf("unexpected dns change: %+v", change)
+	}
+	if change.Value != EncodeDNS01KeyAuthorization(change.Challenge.KeyAuthorization) || change.Value == "" {
+		t.Fatalf("unexpected dns change value: %s", change.Value)
+	}
+
+	// apply the changes as an external process would
+	for _, change := range changes {
+		doPost("set-txt", struct {
+			Host  string `json:"host"`
+			Value string `json:"value"`
+		}{
+			Host:  change.Name,
+			Value: change.Value,
+		})
+		defer doPost("clear-txt", struct {
+			Host string `json:"host"`
+		}{
+			Host: change.Name,
+		})
+	}
+
+	if err := testClient.CompleteDNSChanges(account, changes); err != nil {
+		t.Fatalf("unexpected error completing dns changes: %v", err)
+	}
+
+	order, err = testClient.FetchOrder(account, order.URL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching order: %v", err)
+	}
+	if order.Status != "ready" {
+		t.Fatalf("expected ready order, got: %s", order.Status)
+	}
+
+	// all authorizations are now valid so no changes are needed
+	if changes, err := testClient.DNSChanges(account, order); err != nil || len(changes) != 0 {
+		t.Fatalf("expected no dns changes, got: %+v, %v", changes, err)
+	}
+}
+
+func TestClient_CompleteDNSChanges(t *testing.T) {
+	account, _ := makeOrder(t)
+	err := testClient.CompleteDNSChanges(account, []DNSChange{{Name: "_acme-challenge.example.com.", Challenge: Challenge{URL: "http://localhost:1/chal"}}})
+	if err == nil || !strings.Contains(err.Error(), "_acme-challenge.example.com.") {
+		t.Fatalf("expected error naming the change, got: %v", err)
+	}
+}
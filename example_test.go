@@ -0,0 +1,168 @@
+package acme_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+// Issues a wildcard certificate using the dns-01 challenge, against an embedded development CA in place of a real
+// acme server.
+func ExampleClient_NewOrder_dns01() {
+	ca, err := acme.NewDevCA()
+	if err != nil {
+		log.Fatalf("Error creating dev ca: %v", err)
+	}
+	client, err := ca.NewClient()
+	if err != nil {
+		log.Fatalf("Error creating client: %v", err)
+	}
+
+	accountKey, err := client.GenerateKey()
+	if err != nil {
+		log.Fatalf("Error generating account key: %v", err)
+	}
+	account, err := client.NewAccount(accountKey, false, true, "mailto:admin@example.test")
+	if err != nil {
+		log.Fatalf("Error creating account: %v", err)
+	}
+
+	order, err := client.NewOrder(account, []acme.Identifier{{Type: acme.IdentifierTypeDNS, Value: "*.example.test"}})
+	if err != nil {
+		log.Fatalf("Error creating order: %v", err)
+	}
+
+	for _, authURL := range order.Authorizations {
+		auth, err := client.FetchAuthorization(account, authURL)
+		if err != nil {
+			log.Fatalf("Error fetching authorization: %v", err)
+		}
+		chal, ok := auth.ChallengeMap[acme.ChallengeTypeDNS01]
+		if !ok {
+			log.Fatalf("No dns-01 challenge for %s", auth.Identifier.Value)
+		}
+
+		// create a TXT record with this name and value, and wait for it to propagate, before updating the challenge
+		txt := acme.EncodeDNS01KeyAuthorization(chal.KeyAuthorization)
+		fmt.Printf("TXT _acme-challenge.%s (%d characters)\n", auth.Identifier.Value, len(txt))
+
+		if _, err := client.UpdateChallenge(account, chal); err != nil {
+			log.Fatalf("Error updating challenge: %v", err)
+		}
+	}
+
+	certKey, err := client.GenerateKey()
+	if err != nil {
+		log.Fatalf("Error generating certificate key: %v", err)
+	}
+	csr, err := client.NewOrderCSR(certKey, order)
+	if err != nil {
+		log.Fatalf("Error creating csr: %v", err)
+	}
+	order, err = client.FinalizeOrder(account, order, csr)
+	if err != nil {
+		log.Fatalf("Error finalizing order: %v", err)
+	}
+
+	certs, err := client.FetchCertificates(account, order.Certificate)
+	if err != nil {
+		log.Fatalf("Error fetching certificates: %v", err)
+	}
+	fmt.Println(order.Status, certs[0].DNSNames)
+
+	// Output:
+	// TXT _acme-challenge.example.test (43 characters)
+	// valid [*.example.test]
+}
+
+// Rolls over the key of an account, after which the account is only found with the new key.
+func ExampleClient_AccountKeyChange() {
+	ca, err := acme.NewDevCA()
+	if err != nil {
+		log.Fatalf("Error creating dev ca: %v", err)
+	}
+	client, err := ca.NewClient()
+	if err != nil {
+		log.Fatalf("Error creating client: %v", err)
+	}
+
+	oldKey, err := client.GenerateKey()
+	if err != nil {
+		log.Fatalf("Error generating account key: %v", err)
+	}
+	account, err := client.NewAccount(oldKey, false, true)
+	if err != nil {
+		log.Fatalf("Error creating account: %v", err)
+	}
+
+	newKey, err := client.GenerateKey()
+	if err != nil {
+		log.Fatalf("Error generating new account key: %v", err)
+	}
+	account, err = client.AccountKeyChange(account, newKey)
+	if err != nil {
+		log.Fatalf("Error changing account key: %v", err)
+	}
+
+	existing, err := client.NewAccount(newKey, true, true)
+	if err != nil {
+		log.Fatalf("Error fetching account with new key: %v", err)
+	}
+	fmt.Println("found with new key:", existing.URL == account.URL)
+
+	_, err = client.NewAccount(oldKey, true, true)
+	fmt.Println("found with old key:", err == nil)
+
+	// Output:
+	// found with new key: true
+	// found with old key: false
+}
+
+// Serves https with certificates issued on demand by AutoCert, using DevMode to issue them from an embedded
+// development CA. Without DevMode, certificates are issued by the acme server at DirectoryURL.
+func Example_autocertManager() {
+	m := &acme.AutoCert{
+		DevMode:   true,
+		HostCheck: acme.WhitelistHosts("localhost"),
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello over https")
+	}))
+	srv.TLS = &tls.Config{GetCertificate: m.GetCertificate}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// clients must trust the root of the dev ca
+	ca, err := m.DevCA()
+	if err != nil {
+		log.Fatalf("Error getting dev ca: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root())
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"},
+		},
+	}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		log.Fatalf("Error fetching: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalf("Error reading response: %v", err)
+	}
+	fmt.Println(string(body), resp.TLS.PeerCertificates[0].DNSNames)
+
+	// Output:
+	// hello over https [localhost]
+}
@@ -0,0 +1,109 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Optional features of an acme server, used with Client.Supports.
+const (
+	// The server provides a list of orders for an account.
+	// See https://tools.ietf.org/html/rfc8555#section-7.1.2.1
+	FeatureOrdersList = "ordersList"
+
+	// The server permits authorizations to be created before an order.
+	// See https://tools.ietf.org/html/rfc8555#section-7.4.1
+	FeaturePreAuthorization = "preAuthorization"
+
+	// The server provides renewal information for certificates.
+	// See https://datatracker.ietf.org/doc/draft-ietf-acme-ari/
+	FeatureRenewalInfo = "renewalInfo"
+
+	// The server offers certificate profiles.
+	// See https://datatracker.ietf.org/doc/draft-aaron-acme-profiles/
+	FeatureProfiles = "profiles"
+
+	// The server provides alternate certificate chains.
+	// See https://tools.ietf.org/html/rfc8555#section-7.4.2
+	FeatureAlternateChains = "alternateChains"
+
+	// The server requires external account binding when creating accounts.
+	// See https://tools.ietf.org/html/rfc8555#section-7.3.4
+	FeatureExternalAccountBinding = "externalAccountBinding"
+)
+
+// Maximum number of orders inspected when probing for alternate chains.
+const alternateChainsProbeOrders = 10
+
+// Supports reports whether the acme server supports the given feature.
+//
+// Most features are detected from the directory and don't make any requests.
+// FeatureOrdersList fetches the account if the orders url isn't already known.
+// FeatureAlternateChains isn't advertised by servers, so is detected by downloading a certificate from one of the
+// account's recent valid orders and checking for alternate links, reporting false if the account has no certificates.
+func (c Client) Supports(account Account, feature string) (bool, error) {
+	switch feature {
+	case FeaturePreAuthorization:
+		return c.Directory().NewAuthz != "", nil
+
+	case FeatureRenewalInfo:
+		return c.Directory().RenewalInfo != "", nil
+
+	case FeatureProfiles:
+		return len(c.Directory().Meta.Profiles) > 0, nil
+
+	case FeatureExternalAccountBinding:
+		return c.Directory().Meta.ExternalAccountRequired, nil
+
+	case FeatureOrdersList:
+		if account.Orders != "" {
+			return true, nil
+		}
+		if account.URL == "" {
+			return false, nil
+		}
+		fetched := Account{}
+		if err := c.Fetch(account, account.URL, &fetched, http.StatusOK); err != nil {
+			return false, err
+		}
+		return fetched.Orders != "", nil
+
+	case FeatureAlternateChains:
+		return c.probeAlternateChains(account)
+
+	default:
+		return false, fmt.Errorf("acme: unknown feature %q", feature)
+	}
+}
+
+// Helper function to check for alternate links on a certificate issued to the account.
+func (c Client) probeAlternateChains(account Account) (bool, error) {
+	if account.Orders == "" {
+		return false, nil
+	}
+
+	orderList, err := c.FetchOrderList(account)
+	if err != nil {
+		return false, err
+	}
+
+	for i, orderURL := range orderList.Orders {
+		if i >= alternateChainsProbeOrders {
+			break
+		}
+		order, err := c.FetchOrder(account, orderURL)
+		if err != nil {
+			return false, err
+		}
+		if order.Status != "valid" || order.Certificate == "" {
+			continue
+		}
+		resp, _, err := c.postRaw(0, order.Certificate, account.URL, account.PrivateKey, "", []int{http.StatusOK})
+		if err != nil {
+			return false, err
+		}
+		return len(fetchLinks(resp, "alternate")) > 0, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,55 @@
+package acme
+
+import "testing"
+
+func TestClient_Supports_directory(t *testing.T) {
+	dir := Directory{
+		NewAuthz:    "https://example.com/new-authz",
+		RenewalInfo: "https://example.com/renewal-info",
+	}
+	dir.Meta.Profiles = map[string]string{"classic": "the default profile"}
+	c := Client{dir: newDirectoryCache(dir)}
+
+	tests := []struct {
+		feature  string
+		expected bool
+	}{
+		{feature: FeaturePreAuthorization, expected: true},
+		{feature: FeatureRenewalInfo, expected: true},
+		{feature: FeatureProfiles, expected: true},
+		{feature: FeatureExternalAccountBinding, expected: false},
+		{feature: FeatureOrdersList, expected: false},
+		{feature: FeatureAlternateChains, expected: false},
+	}
+
+	for _, ct := range tests {
+		supported, err := c.Supports(Account{}, ct.feature)
+		if err != nil {
+			t.Errorf("feature %q unexpected error: %v", ct.feature, err)
+		}
+		if supported != ct.expected {
+			t.Errorf("feature %q expected %t, got %t", ct.feature, ct.expected, supported)
+		}
+	}
+
+	if _, err := c.Supports(Account{}, "bogus"); err == nil {
+		t.Error("expected error for unknown feature, got none")
+	}
+}
+
+func TestClient_Supports(t *testing.T) {
+	account := makeAccount(t)
+
+	supported, err := testClient.Supports(account, FeatureOrdersList)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if supported != (account.Orders != "") {
+		t.Fatalf("expected orders list support %t, got %t", account.Orders != "", supported)
+	}
+
+	// no certificates issued to the account yet
+	if supported, err := testClient.Supports(account, FeatureAlternateChains); err != nil || supported {
+		t.Fatalf("expected no alternate chains for new account, got %t, %v", supported, err)
+	}
+}
@@ -0,0 +1,265 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Statuses of an operation recorded with an idempotency token.
+const (
+	operationStarted   = "started"
+	operationCompleted = "completed"
+)
+
+// Operations which may be recorded with an idempotency token.
+const (
+	operationNewAccount = "newAccount"
+	operationKeyChange  = "keyChange"
+	operationRevoke     = "revokeCertificate"
+)
+
+// Record of an operation performed with an idempotency token, persisted in a Store.
+type operationRecord struct {
+	Token     string `json:"token"`
+	Operation string `json:"operation"`
+	Status    string `json:"status"`
+
+	// Account record of the account key used by the operation, so a retried operation uses the same key.
+	Account json.RawMessage `json:"account,omitempty"`
+
+	// Fingerprint of the request, eg of the certificate being revoked, so a token can't be reused for a different
+	// request.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// NewAccountOnce registers a new account, as NewAccountOptions, recording an idempotency token in the store so that
+// retrying with the same token, eg a job redelivered by a work queue, returns the same account rather than registering
+// another one. The private key of the first attempt is recorded, and used by any retries in place of privateKey.
+// Retrying with the same token but different options, eg other contacts, returns an error.
+func (c Client) NewAccountOnce(store Store, token string, privateKey crypto.Signer, options ...NewAccountOptionFunc) (Account, error) {
+	if privateKey == nil {
+		return Account{}, errors.New("acme: no private key provided")
+	}
+
+	fingerprint, err := c.newAccountFingerprint(privateKey, options)
+	if err != nil {
+		return Account{}, err
+	}
+	rec, _, err := startOperation(store, token, operationNewAccount, fingerprint, &Account{PrivateKey: privateKey})
+	if err != nil {
+		return Account{}, err
+	}
+	recorded, err := DecodeAccount(rec.Account)
+	if err != nil {
+		return Account{}, err
+	}
+	if rec.Status == operationCompleted {
+		return recorded, nil
+	}
+
+	account, err := c.NewAccountOptions(recorded.PrivateKey, options...)
+	if err != nil {
+		return account, err
+	}
+
+	return account, completeOperation(store, rec, &account)
+}
+
+// AccountKeyChangeOnce rolls over an account to a new key, as AccountKeyChange, recording an idempotency token in the
+// store so that retrying with the same token doesn't roll over the key again. The new key of the first attempt is
+// recorded, and used by any retries in place of newPrivateKey. If a previous attempt was interrupted, the acme server
+// is checked to see whether the key was already rolled over before trying again.
+func (c Client) AccountKeyChangeOnce(store Store, token string, account Account, newPrivateKey crypto.Signer) (Account, error) {
+	if newPrivateKey == nil {
+		return account, errors.New("acme: no new private key provided")
+	}
+
+	rec, resumed, err := startOperation(store, token, operationKeyChange, "", &Account{URL: account.URL, PrivateKey: newPrivateKey})
+	if err != nil {
+		return account, err
+	}
+	recorded, err := DecodeAccount(rec.Account)
+	if err != nil {
+		return account, err
+	}
+	if recorded.URL != account.URL {
+		return account, fmt.Errorf("acme: idempotency token %q already used for account %s", token, recorded.URL)
+	}
+	if rec.Status == operationCompleted {
+		account.PrivateKey = recorded.PrivateKey
+		return account, nil
+	}
+
+	if resumed {
+		// a previous attempt may have rolled over the key without recording it
+		existing, err := c.NewAccountOptions(recorded.PrivateKey, NewAcctOptOnlyReturnExisting())
+		if err == nil && existing.URL == account.URL {
+			account.PrivateKey = recorded.PrivateKey
+			return account, completeOperation(store, rec, &account)
+		}
+	}
+
+	account, err = c.AccountKeyChange(account, recorded.PrivateKey)
+	if err != nil {
+		return account, err
+	}
+
+	return account, completeOperation(store, rec, &account)
+}
+
+// RevokeCertificateOnce revokes a certificate, as RevokeCertificateOptions, recording an idempotency token in the
+// store so that retrying with the same token doesn't revoke again. If a previous attempt was interrupted and the
+// certificate is already revoked, the revocation is considered complete. Retrying with the same token but a different
+// certificate returns an error.
+func (c Client) RevokeCertificateOnce(store Store, token string, account Account, cert *x509.Certificate, options ...RevokeCertificateOptionFunc) error {
+	if cert == nil {
+		return errors.New("acme: no certificate provided")
+	}
+
+	rec, resumed, err := startOperation(store, token, operationRevoke, CertificateFingerprint(cert), nil)
+	if err != nil {
+		return err
+	}
+	if rec.Status == operationCompleted {
+		return nil
+	}
+
+	if err := c.RevokeCertificateOptions(account, cert, options...); err != nil {
+		prob, ok := err.(Problem)
+		if !resumed || !ok || !strings.HasSuffix(prob.Type, ":alreadyRevoked") {
+			return err
+		}
+	}
+
+	return completeOperation(store, rec, nil)
+}
+
+// Helper function to get the store key of an idempotency token.
+// Tokens are hashed as they may contain characters which aren't valid in a store key.
+func operationKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "operations/" + hex.EncodeToString(sum[:])
+}
+
+// Helper function to fingerprint the request made with new account options, so a token can't be reused with different
+// options. The signature of an external account binding is excluded, as it covers the account key which may differ
+// between attempts.
+func (c Client) newAccountFingerprint(privateKey crypto.Signer, options []NewAccountOptionFunc) (string, error) {
+	req := NewAccountRequest{}
+	for _, opt := range options {
+		if err := opt(privateKey, &Account{}, &req, c); err != nil {
+			return "", err
+		}
+	}
+	if len(req.ExternalAccountBinding) > 0 {
+		var eab struct {
+			Protected string `json:"protected"`
+		}
+		if err := json.Unmarshal(req.ExternalAccountBinding, &eab); err != nil {
+			return "", fmt.Errorf("acme: error parsing external account binding: %v", err)
+		}
+		req.ExternalAccountBinding, _ = json.Marshal(eab)
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("acme: error encoding new account request: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Helper function to record the start of an operation with an idempotency token.
+// Returns the existing record and true if the token has already been used for the same operation and request, or the
+// new record and false.
+func startOperation(store Store, token, operation, fingerprint string, account *Account) (operationRecord, bool, error) {
+	if store == nil {
+		return operationRecord{}, false, errors.New("acme: no store provided")
+	}
+	if token == "" {
+		return operationRecord{}, false, errors.New("acme: no idempotency token provided")
+	}
+
+	rec := operationRecord{
+		Token:       token,
+		Operation:   operation,
+		Status:      operationStarted,
+		Fingerprint: fingerprint,
+		Time:        time.Now(),
+	}
+	if account != nil {
+		b, err := EncodeAccount(*account)
+		if err != nil {
+			return rec, false, err
+		}
+		rec.Account = b
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return rec, false, fmt.Errorf("acme: error encoding operation: %v", err)
+	}
+
+	key := operationKey(token)
+	if as, ok := store.(AtomicStore); ok {
+		err = as.Create(key, b)
+	} else {
+		_, err = store.Get(key)
+		switch err {
+		case nil:
+			err = ErrStoreExists
+		case ErrStoreNotFound:
+			err = store.Put(key, b)
+		}
+	}
+	if err == nil {
+		return rec, false, nil
+	}
+	if err != ErrStoreExists {
+		return rec, false, fmt.Errorf("acme: error storing operation: %v", err)
+	}
+
+	b, err = store.Get(key)
+	if err != nil {
+		return rec, false, fmt.Errorf("acme: error reading operation: %v", err)
+	}
+	var existing operationRecord
+	if err := json.Unmarshal(b, &existing); err != nil {
+		return rec, false, fmt.Errorf("acme: error parsing operation: %v", err)
+	}
+	if existing.Operation != operation {
+		return rec, false, fmt.Errorf("acme: idempotency token %q already used for %s", token, existing.Operation)
+	}
+	if existing.Fingerprint != fingerprint {
+		return rec, false, fmt.Errorf("acme: idempotency token %q already used for a different %s request", token, operation)
+	}
+	return existing, true, nil
+}
+
+// Helper function to record the completion of an operation, along with the resulting account if any.
+func completeOperation(store Store, rec operationRecord, account *Account) error {
+	rec.Status = operationCompleted
+	rec.Time = time.Now()
+	if account != nil {
+		b, err := EncodeAccount(*account)
+		if err != nil {
+			return err
+		}
+		rec.Account = b
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("acme: error encoding operation: %v", err)
+	}
+	if err := store.Put(operationKey(rec.Token), b); err != nil {
+		return fmt.Errorf("acme: error storing operation: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package acme
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_idempotentOperations(t *testing.T) {
+	var srv *httptest.Server
+	var newAccounts, keyChanges, revocations, rolledOver int32
+	problem := func(w http.ResponseWriter, status int, typ string) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"type":"urn:ietf:params:acme:error:` + typ + `"}`))
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce","newAccount":"` + srv.URL + `/new-acct",` +
+				`"keyChange":"` + srv.URL + `/key-change","revokeCert":"` + srv.URL + `/revoke"}`))
+		case "/nonce":
+		case "/new-acct":
+			body, _ := ioutil.ReadAll(r.Body)
+			var jws struct {
+				Payload string `json:"payload"`
+			}
+			_ = json.Unmarshal(body, &jws)
+			payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+			if strings.Contains(string(payload), `"onlyReturnExisting":true`) {
+				if atomic.LoadInt32(&rolledOver) == 0 {
+					problem(w, http.StatusBadRequest, "accountDoesNotExist")
+					return
+				}
+				w.Header().Set("Location", srv.URL+"/acct/1")
+				_, _ = w.Write([]byte(`{"status":"valid"}`))
+				return
+			}
+			atomic.AddInt32(&newAccounts, 1)
+			w.Header().Set("Location", srv.URL+"/acct/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"status":"valid"}`))
+		case "/key-change":
+			// the first key change succeeds but the response is lost
+			atomic.StoreInt32(&rolledOver, 1)
+			if atomic.AddInt32(&keyChanges, 1) == 1 {
+				problem(w, http.StatusInternalServerError, "serverInternal")
+			}
+		case "/revoke":
+			if atomic.AddInt32(&revocations, 1) > 1 {
+				problem(w, http.StatusBadRequest, "alreadyRevoked")
+				return
+			}
+			// the first revocation succeeds but the response is lost
+			problem(w, http.StatusInternalServerError, "serverInternal")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	store := &MemoryStore{}
+
+	// retries with the same token return the first account, even with a different key
+	key := makePrivateKey(t)
+	account, err := c.NewAccountOnce(store, "job-1", key)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	retried, err := c.NewAccountOnce(store, "job-1", makePrivateKey(t))
+	if err != nil {
+		t.Fatalf("unexpected error retrying account creation: %v", err)
+	}
+	if retried.URL != account.URL || retried.Thumbprint != account.Thumbprint {
+		t.Fatalf("expected same account on retry, got: %+v, %+v", account, retried)
+	}
+	if n := atomic.LoadInt32(&newAccounts); n != 1 {
+		t.Fatalf("expected 1 account registration, got: %d", n)
+	}
+
+	// an interrupted key change is detected and not repeated, using the key of the first attempt
+	newKey := makePrivateKey(t)
+	if _, err := c.AccountKeyChangeOnce(store, "job-2", account, newKey); err == nil {
+		t.Fatal("expected error from lost key change response, got none")
+	}
+	for i := 0; i < 2; i++ {
+		rolled, err := c.AccountKeyChangeOnce(store, "job-2", account, makePrivateKey(t))
+		if err != nil {
+			t.Fatalf("unexpected error retrying key change: %v", err)
+		}
+		thumbprint, _ := JWKThumbprint(newKey.Public())
+		rolledThumbprint, _ := JWKThumbprint(rolled.PrivateKey.Public())
+		if rolledThumbprint != thumbprint {
+			t.Fatal("expected key of first key change attempt")
+		}
+	}
+	if n := atomic.LoadInt32(&keyChanges); n != 1 {
+		t.Fatalf("expected 1 key change, got: %d", n)
+	}
+
+	// an interrupted revocation is complete if the certificate is already revoked
+	cert, _ := makeSelfSigned(t, "example.com")
+	if err := c.RevokeCertificateOnce(store, "job-3", account, cert); err == nil {
+		t.Fatal("expected error from lost revocation response, got none")
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.RevokeCertificateOnce(store, "job-3", account, cert); err != nil {
+			t.Fatalf("unexpected error retrying revocation: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&revocations); n != 2 {
+		t.Fatalf("expected 2 revocation requests, got: %d", n)
+	}
+
+	other, _ := makeSelfSigned(t, "other.example.com")
+	if err := c.RevokeCertificateOnce(store, "job-3", account, other); err == nil || !strings.Contains(err.Error(), "different") {
+		t.Fatalf("expected error reusing token for another certificate, got: %v", err)
+	}
+	if _, err := c.NewAccountOnce(store, "job-1", key, NewAcctOptWithContacts("mailto:other@example.com")); err == nil || !strings.Contains(err.Error(), "different") {
+		t.Fatalf("expected error reusing token with different account options, got: %v", err)
+	}
+	if err := c.RevokeCertificateOnce(store, "job-1", account, cert); err == nil {
+		t.Fatal("expected error reusing token for another operation, got none")
+	}
+	if err := c.RevokeCertificateOnce(store, "", account, cert); err == nil {
+		t.Fatal("expected error without token, got none")
+	}
+}
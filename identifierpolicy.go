@@ -0,0 +1,142 @@
+package acme
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IdentifierPolicy is called with the identifiers of each new order and pre-authorization before it is submitted by a
+// Client, returning an error to reject identifiers which don't meet an organisation's issuance policy, set with
+// WithIdentifierPolicy. Wildcard identifiers are given with a "*." prefix, as in an order.
+type IdentifierPolicy func(identifiers []Identifier) error
+
+// IdentifierPolicies returns an IdentifierPolicy which checks identifiers against each of the policies in turn,
+// returning the error of the first policy to reject them.
+func IdentifierPolicies(policies ...IdentifierPolicy) IdentifierPolicy {
+	return func(identifiers []Identifier) error {
+		for _, policy := range policies {
+			if err := policy(identifiers); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DenyIdentifiers returns an IdentifierPolicy which rejects identifiers matching any of the patterns. A pattern
+// matches an identifier value exactly, any name in a domain when it has a leading ".", eg ".internal.example.com", or
+// any ip address in a network when it is in cidr notation, eg "10.0.0.0/8".
+func DenyIdentifiers(patterns ...string) IdentifierPolicy {
+	return func(identifiers []Identifier) error {
+		for _, id := range identifiers {
+			for _, pattern := range patterns {
+				if matchIdentifier(id, pattern) {
+					return fmt.Errorf("identifier %s:%s is denied by %q", id.Type, id.Value, pattern)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// RequireSuffixes returns an IdentifierPolicy which rejects dns identifiers which are not equal to or a subdomain of
+// any of the suffixes, eg "example.com" allows "example.com", "www.example.com" and "*.example.com". Identifiers of
+// other types are rejected.
+func RequireSuffixes(suffixes ...string) IdentifierPolicy {
+	return func(identifiers []Identifier) error {
+		for _, id := range identifiers {
+			if id.Type != IdentifierTypeDNS {
+				return fmt.Errorf("identifier %s:%s is not a dns name", id.Type, id.Value)
+			}
+			name := normalizeDomain(strings.TrimPrefix(id.Value, "*."))
+			found := false
+			for _, suffix := range suffixes {
+				suffix = normalizeDomain(suffix)
+				if name == suffix || strings.HasSuffix(name, "."+suffix) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("identifier %s:%s is not in any of %s", id.Type, id.Value, strings.Join(suffixes, ", "))
+			}
+		}
+		return nil
+	}
+}
+
+// MaxWildcardDepth returns an IdentifierPolicy which rejects wildcard identifiers with more than depth labels after
+// the wildcard, eg a depth of 2 allows "*.example.com" but not "*.dev.example.com", and a depth of 0 rejects all
+// wildcards. Wildcards which are not the whole left most label, eg "a.*.example.com" or "*a.example.com", are always
+// rejected.
+func MaxWildcardDepth(depth int) IdentifierPolicy {
+	return func(identifiers []Identifier) error {
+		for _, id := range identifiers {
+			if id.Type != IdentifierTypeDNS || !strings.Contains(id.Value, "*") {
+				continue
+			}
+			base := strings.TrimPrefix(id.Value, "*.")
+			if strings.Contains(base, "*") {
+				return fmt.Errorf("identifier %s:%s has a wildcard which is not the left most label", id.Type, id.Value)
+			}
+			if labels := len(strings.Split(normalizeDomain(base), ".")); labels > depth {
+				return fmt.Errorf("identifier %s:%s has a wildcard %d labels deep, more than %d", id.Type, id.Value, labels, depth)
+			}
+		}
+		return nil
+	}
+}
+
+// RejectPublicSuffixes returns an IdentifierPolicy which rejects dns identifiers which are a public suffix, or a
+// wildcard for a public suffix, eg "co.uk" or "*.co.uk". The public suffix of a domain is found with publicSuffix,
+// which has the same signature as golang.org/x/net/publicsuffix.PublicSuffix so it can be used directly.
+func RejectPublicSuffixes(publicSuffix func(domain string) (suffix string, icann bool)) IdentifierPolicy {
+	return func(identifiers []Identifier) error {
+		for _, id := range identifiers {
+			if id.Type != IdentifierTypeDNS {
+				continue
+			}
+			name := normalizeDomain(strings.TrimPrefix(id.Value, "*."))
+			if suffix, _ := publicSuffix(name); suffix == name {
+				return fmt.Errorf("identifier %s:%s is a public suffix", id.Type, id.Value)
+			}
+		}
+		return nil
+	}
+}
+
+// Helper function to check whether an identifier matches a deny pattern.
+func matchIdentifier(id Identifier, pattern string) bool {
+	if id.Type == IdentifierTypeIP {
+		ip := net.ParseIP(id.Value)
+		if _, network, err := net.ParseCIDR(pattern); err == nil {
+			return ip != nil && network.Contains(ip)
+		}
+		if patternIP := net.ParseIP(pattern); patternIP != nil {
+			return ip != nil && patternIP.Equal(ip)
+		}
+	}
+	value := normalizeDomain(id.Value)
+	pattern = normalizeDomain(pattern)
+	if strings.HasPrefix(pattern, ".") {
+		return strings.HasSuffix(strings.TrimPrefix(value, "*"), pattern)
+	}
+	return value == pattern
+}
+
+// Helper function to lower case a domain and remove any trailing dot for comparison.
+func normalizeDomain(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Helper function to check identifiers against the policy of a client, if any.
+func (c Client) checkIdentifiers(identifiers []Identifier) error {
+	if c.identifierPolicy == nil {
+		return nil
+	}
+	if err := c.identifierPolicy(identifiers); err != nil {
+		return fmt.Errorf("acme: identifiers rejected by policy: %v", err)
+	}
+	return nil
+}
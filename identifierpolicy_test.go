@@ -0,0 +1,88 @@
+package acme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIdentifierPolicies(t *testing.T) {
+	publicSuffix := func(domain string) (string, bool) {
+		labels := strings.Split(domain, ".")
+		if len(labels) > 1 && labels[len(labels)-2] == "co" {
+			return strings.Join(labels[len(labels)-2:], "."), true
+		}
+		return labels[len(labels)-1], true
+	}
+	policy := IdentifierPolicies(
+		DenyIdentifiers(".internal.example.com", "secret.example.com", "10.0.0.0/8", "192.168.1.1"),
+		MaxWildcardDepth(2),
+		RejectPublicSuffixes(publicSuffix),
+	)
+
+	tests := []struct {
+		identifiers []Identifier
+		errorString string
+	}{
+		{[]Identifier{{Type: "dns", Value: "www.example.com"}, {Type: "dns", Value: "*.example.com"}, {Type: "ip", Value: "127.0.0.1"}}, ""},
+		{[]Identifier{{Type: "dns", Value: "internal.example.com"}}, ""},
+		{[]Identifier{{Type: "dns", Value: "db.Internal.example.com."}}, "denied by \".internal.example.com\""},
+		{[]Identifier{{Type: "dns", Value: "*.internal.example.com"}}, "denied by \".internal.example.com\""},
+		{[]Identifier{{Type: "dns", Value: "SECRET.example.com"}}, "denied by \"secret.example.com\""},
+		{[]Identifier{{Type: "ip", Value: "10.1.2.3"}}, "denied by \"10.0.0.0/8\""},
+		{[]Identifier{{Type: "ip", Value: "192.168.1.1"}}, "denied by \"192.168.1.1\""},
+		{[]Identifier{{Type: "dns", Value: "*.dev.example.com"}}, "3 labels deep"},
+		{[]Identifier{{Type: "dns", Value: "a.*.example.com"}}, "not the left most label"},
+		{[]Identifier{{Type: "dns", Value: "*.co.uk"}}, "public suffix"},
+		{[]Identifier{{Type: "dns", Value: "example.co.uk"}}, ""},
+	}
+	for i, currentTest := range tests {
+		err := policy(currentTest.identifiers)
+		if currentTest.errorString == "" {
+			if err != nil {
+				t.Errorf("IdentifierPolicies test %d expected no error, got: %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), currentTest.errorString) {
+			t.Errorf("IdentifierPolicies test %d expected error containing %q, got: %v", i, currentTest.errorString, err)
+		}
+	}
+
+	if err := MaxWildcardDepth(0)([]Identifier{{Type: "dns", Value: "*.example.com"}}); err == nil {
+		t.Error("expected max wildcard depth 0 to reject wildcards, got no error")
+	}
+}
+
+func TestRequireSuffixes(t *testing.T) {
+	policy := RequireSuffixes("example.com", "Example.org.")
+	if err := policy([]Identifier{{Type: "dns", Value: "example.com"}, {Type: "dns", Value: "*.www.example.org"}}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := policy([]Identifier{{Type: "dns", Value: "notexample.com"}}); err == nil {
+		t.Fatal("expected error for domain outside suffixes, got none")
+	}
+	if err := policy([]Identifier{{Type: "ip", Value: "127.0.0.1"}}); err == nil {
+		t.Fatal("expected error for ip identifier, got none")
+	}
+}
+
+func TestClient_IdentifierPolicy(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient(WithIdentifierPolicy(RequireSuffixes("example.test")))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	if _, err := c.NewOrderDomains(account, "www.example.test"); err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if _, err := c.NewOrderDomains(account, "www.example.test", "www.example.net"); err == nil || !strings.Contains(err.Error(), "rejected by policy") {
+		t.Fatalf("expected policy error creating order, got: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package depcheck
+
+import (
+	"bufio"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Helper function to read the module path from a go.mod file.
+func modulePath(t *testing.T, goMod string) string {
+	f, err := os.Open(goMod)
+	if err != nil {
+		t.Fatalf("error opening %s: %v", goMod, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+		}
+	}
+	t.Fatalf("no module path in %s", goMod)
+	return ""
+}
+
+// Helper function to determine if an import path is in the standard library, ie its first element has no dot.
+func isStdlib(importPath string) bool {
+	first := strings.SplitN(importPath, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
+
+func TestImports(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatalf("error finding module root: %v", err)
+	}
+	module := modulePath(t, filepath.Join(root, "go.mod"))
+
+	// only files built without any build tags are checked, extras may use tags to opt in to other dependencies
+	ctx := build.Default
+	ctx.BuildTags = nil
+
+	checked := 0
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+			return filepath.SkipDir
+		}
+		if path != root {
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				// a separate module, free to have its own dependencies
+				return filepath.SkipDir
+			}
+		}
+
+		pkg, err := ctx.ImportDir(path, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return nil
+			}
+			t.Errorf("error reading package %s: %v", path, err)
+			return nil
+		}
+		checked++
+
+		for _, imp := range pkg.Imports {
+			if isStdlib(imp) {
+				continue
+			}
+			if path != root && (imp == module || strings.HasPrefix(imp, module+"/")) {
+				continue
+			}
+			rel, _ := filepath.Rel(root, path)
+			if path == root {
+				t.Errorf("core package imports %q, only the standard library is allowed", imp)
+			} else {
+				t.Errorf("package %s imports %q, only the standard library and this module are allowed without a build tag", rel, imp)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error walking module: %v", err)
+	}
+	if checked == 0 {
+		t.Fatal("no packages checked")
+	}
+}
@@ -0,0 +1,8 @@
+// Package depcheck enforces that the acme client depends only on the standard library.
+//
+// It contains no code, only a test which inspects the imports of every package in the module as built with no build
+// tags. The core package may only import the standard library. Other packages in the module, eg the vaultstore and
+// kubestore stores, may also import packages of this module. Extras which need third party dependencies, eg dns
+// provider solvers, must either be placed behind a build tag or in a separate module with its own go.mod, so the
+// dependencies are never required to build the core client.
+package depcheck
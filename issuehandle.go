@@ -0,0 +1,107 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrIssueCancelled is returned by IssueHandle.Wait when issuance was stopped with IssueHandle.Cancel.
+var ErrIssueCancelled = errors.New("acme: issuance cancelled")
+
+// IssueHandle is an issuance started with Issuer.Start, which can be cancelled without affecting any other issuance,
+// eg when the user of an interactive tool aborts a single request.
+type IssueHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lock      sync.Mutex
+	cancelled bool
+
+	result IssueResult
+	err    error
+}
+
+// Start issues a certificate in the background, as Issue, returning a handle to wait for or cancel the issuance.
+func (is Issuer) Start(ctx context.Context, identifiers []Identifier, csr *x509.CertificateRequest) *IssueHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &IssueHandle{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(h.done)
+		defer cancel()
+
+		result, err := is.Issue(ctx, identifiers, csr)
+
+		h.lock.Lock()
+		cancelled := h.cancelled
+		h.lock.Unlock()
+		// issuance which finished before being cancelled keeps its result
+		if cancelled && err != nil {
+			err = ErrIssueCancelled
+			if derr := is.deactivatePending(result.Order); derr != nil {
+				err = fmt.Errorf("%v, %v", ErrIssueCancelled, derr)
+			}
+		}
+
+		h.result, h.err = result, err
+	}()
+
+	return h
+}
+
+// Cancel stops the issuance, including any challenge or order polling in progress, and deactivates the pending
+// authorizations of its order so they can't be validated later. Issuance which has already finished is unaffected.
+// Cancel does not wait for the issuance to stop, see Wait.
+func (h *IssueHandle) Cancel() {
+	select {
+	case <-h.done:
+		return
+	default:
+	}
+
+	h.lock.Lock()
+	h.cancelled = true
+	h.lock.Unlock()
+	h.cancel()
+}
+
+// Done returns a channel which is closed once the issuance has finished or been cancelled.
+func (h *IssueHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait waits for the issuance to finish, returning its result. If it was cancelled the error is ErrIssueCancelled,
+// or describes why the pending authorizations could not be deactivated.
+func (h *IssueHandle) Wait() (IssueResult, error) {
+	<-h.done
+	return h.result, h.err
+}
+
+// Helper function to deactivate the pending authorizations of an order.
+func (is Issuer) deactivatePending(order Order) error {
+	var failures []string
+	for _, authURL := range order.Authorizations {
+		auth, err := is.Client.FetchAuthorization(is.Account, authURL)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", authURL, err))
+			continue
+		}
+		if auth.Status != "pending" {
+			continue
+		}
+		if _, err := is.Client.DeactivateAuthorization(is.Account, authURL); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", authURL, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("error deactivating authorizations: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package acme
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type noopSolver struct{}
+
+func (noopSolver) Present(ctx context.Context, auth Authorization, chal Challenge) error { return nil }
+func (noopSolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error { return nil }
+
+func TestIssuer_Start_cancel(t *testing.T) {
+	var srv *httptest.Server
+	var deactivated int32
+	polled := make(chan struct{}, 100)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce","newOrder":"` + srv.URL + `/new-order"}`))
+		case "/nonce":
+		case "/new-order":
+			w.Header().Set("Location", srv.URL+"/order")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"status":"pending","finalize":"` + srv.URL + `/finalize","authorizations":["` + srv.URL + `/authz"]}`))
+		case "/authz":
+			body, _ := ioutil.ReadAll(r.Body)
+			var jws struct {
+				Payload string `json:"payload"`
+			}
+			_ = json.Unmarshal(body, &jws)
+			payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+			status := "pending"
+			if strings.Contains(string(payload), "deactivated") || atomic.LoadInt32(&deactivated) > 0 {
+				atomic.AddInt32(&deactivated, 1)
+				status = "deactivated"
+			}
+			_, _ = w.Write([]byte(`{"identifier":{"type":"dns","value":"example.test"},"status":"` + status + `",` +
+				`"challenges":[{"type":"http-01","url":"` + srv.URL + `/chal","status":"pending","token":"token"}]}`))
+		case "/chal":
+			polled <- struct{}{}
+			_, _ = w.Write([]byte(`{"type":"http-01","url":"` + srv.URL + `/chal","status":"processing","token":"token"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	c.PollInterval = 10 * time.Millisecond
+	c.PollTimeout = time.Minute
+	is := Issuer{
+		Client:  c,
+		Account: Account{URL: srv.URL + "/acct", PrivateKey: makePrivateKey(t)},
+		Solvers: map[string]Solver{ChallengeTypeHTTP01: noopSolver{}},
+	}
+
+	h := is.Start(context.Background(), []Identifier{{Type: "dns", Value: "example.test"}}, nil)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-polled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for challenge to be polled")
+		}
+	}
+
+	h.Cancel()
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for cancelled issuance to stop")
+	}
+	result, err := h.Wait()
+	if err != ErrIssueCancelled {
+		t.Fatalf("expected cancelled error, got: %v", err)
+	}
+	if result.Order.URL != srv.URL+"/order" {
+		t.Fatalf("expected order in result, got: %+v", result.Order)
+	}
+	if atomic.LoadInt32(&deactivated) == 0 {
+		t.Fatal("expected pending authorization to be deactivated")
+	}
+
+	// cancelling a finished issuance has no effect
+	h.Cancel()
+	if _, err := h.Wait(); err != ErrIssueCancelled {
+		t.Fatalf("expected same result after second cancel, got: %v", err)
+	}
+}
+
+// Deployer which cancels an issuance once its certificate has been issued.
+type cancelDeployer struct {
+	handles chan *IssueHandle
+}
+
+func (d cancelDeployer) Deploy(ctx context.Context, deployment Deployment) error {
+	(<-d.handles).Cancel()
+	return nil
+}
+
+func (d cancelDeployer) Rollback(ctx context.Context, previous Deployment) error { return nil }
+
+func TestIssuer_Start_cancelFinished(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	csr, _ := makeCSR(t, []string{"cancel.example.test"})
+	d := cancelDeployer{handles: make(chan *IssueHandle, 1)}
+	is := Issuer{
+		Client:    c,
+		Account:   account,
+		Solvers:   map[string]Solver{ChallengeTypeHTTP01: noopSolver{}},
+		Store:     &MemoryStore{},
+		Deployers: []Deployer{d},
+	}
+
+	h := is.Start(context.Background(), []Identifier{{Type: "dns", Value: "cancel.example.test"}}, csr)
+	d.handles <- h
+	result, err := h.Wait()
+	if err != nil {
+		t.Fatalf("expected issuance which finished before being cancelled to succeed, got: %v", err)
+	}
+	if len(result.Certificates) == 0 {
+		t.Fatal("expected issued certificates")
+	}
+	auth, err := c.FetchAuthorization(account, result.Order.Authorizations[0])
+	if err != nil {
+		t.Fatalf("unexpected error fetching authorization: %v", err)
+	}
+	if auth.Status != "valid" {
+		t.Fatalf("expected authorization to remain valid, got: %s", auth.Status)
+	}
+}
@@ -0,0 +1,532 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Solver is implemented by types which fulfil challenges of a particular type, eg by serving a http-01 token or
+// creating a dns-01 TXT record.
+//
+// The context passed to Present has a deadline of when the order or authorization expires, whichever is sooner.
+// Solvers can use this to choose record TTLs and timeouts, or return an error early if the remaining time is too
+// short to make the challenge available, eg waiting for dns propagation.
+// CleanUp is passed a separate context with the same metadata, which is not cancelled with the issuance so that
+// anything created by Present is still removed, and has a timeout of one minute.
+type Solver interface {
+	// Present makes the challenge response available for the acme server to validate.
+	Present(ctx context.Context, auth Authorization, chal Challenge) error
+
+	// CleanUp removes anything created by Present once the challenge has been validated or has failed.
+	CleanUp(ctx context.Context, auth Authorization, chal Challenge) error
+}
+
+// Verifier is implemented by types which perform additional checks once the acme server has validated a challenge,
+// eg confirming an internal inventory has been updated. An error from Verify stops the order being finalized.
+type Verifier interface {
+	Verify(ctx context.Context, auth Authorization, chal Challenge) error
+}
+
+// VerifierFunc is an adapter to allow the use of ordinary functions as a Verifier.
+type VerifierFunc func(ctx context.Context, auth Authorization, chal Challenge) error
+
+// Verify calls f(ctx, auth, chal)
+func (f VerifierFunc) Verify(ctx context.Context, auth Authorization, chal Challenge) error {
+	return f(ctx, auth, chal)
+}
+
+// Issuer obtains certificates by creating an order, fulfilling each authorization with the configured solvers,
+// finalizing the order and fetching the certificate chain.
+type Issuer struct {
+	Client  Client
+	Account Account
+
+	// Solvers maps challenge types to the solver used to fulfil them.
+	Solvers map[string]Solver
+
+	// Verifiers maps challenge types to additional checks run once a challenge of that type is valid, optional.
+	// Verifiers are also run for the valid challenge of authorizations which were already valid.
+	Verifiers map[string]Verifier
+
+	// ChallengeTypes is the order of preference of challenge types, used when an authorization offers more than one
+	// challenge with a solver. Default http-01, dns-01 then tls-alpn-01 if not set.
+	ChallengeTypes []string
+
+	// MinSolveWindow is the minimum amount of time which must remain before an order or authorization expires for a
+	// challenge to be attempted. Default 0, challenges are attempted until expiry.
+	MinSolveWindow time.Duration
+
+	// Concurrency is the maximum number of authorizations of an order fulfilled at once.
+	// Default 1 if not set or if set to 0, authorizations are fulfilled one at a time.
+	// Solvers must be safe for concurrent use if set greater than 1.
+	Concurrency int
+
+	// BestEffort attempts every authorization of an order even if one fails, returning an error describing all
+	// failures. By default the first failure stops any authorizations which have not yet started, and cancels the
+	// context of solvers in progress.
+	BestEffort bool
+
+	// Store is used to record an intent before finalizing an order, optional.
+	// If a previous Issue for the same identifiers stopped after finalizing, eg the process crashed, the recorded
+	// order is checked and its certificate fetched instead of creating a duplicate order, unless the certificate is for
+	// a different key than the csr passed to Issue.
+	Store Store
+
+	// DryRun stops issuance once all authorizations are valid, without finalizing the order, so challenge solving can
+	// be tested against a production server without issuing a certificate. The csr passed to Issue may be nil.
+	DryRun bool
+
+	// DeactivateAuthorizations deactivates the authorizations of the order after a dry run, so they can't be reused
+	// by a later order and the next dry run validates the challenges again.
+	DeactivateAuthorizations bool
+
+	// Deployers install each issued certificate, in order, rolling back to the previous certificate if any fail.
+	// See Deploy.
+	Deployers []Deployer
+
+	// CertificateKey is the private key of the csr passed to Issue, provided to deployers, optional.
+	CertificateKey crypto.Signer
+
+	// Bundle is the preferred roots and intermediates of the CA, optional. If set, the default and alternate
+	// certificate chains are fetched and the first which verifies against the bundle is used.
+	Bundle *BundleSource
+}
+
+// IssueResult holds the outcome of issuing a certificate with an Issuer.
+type IssueResult struct {
+	// The finalized order
+	Order Order
+
+	// The issued certificate chain, leaf certificate first
+	Certificates []*x509.Certificate
+
+	// Details of the issuance run, populated whether or not issuance succeeded.
+	Report Report
+
+	// Outcome of deploying the certificate, if the issuer has any deployers.
+	Deployment DeploymentStatus
+}
+
+var defaultChallengeTypes = []string{ChallengeTypeHTTP01, ChallengeTypeDNS01, ChallengeTypeTLSALPN01}
+
+// Issue creates a new order for the identifiers, fulfils each pending authorization, then finalizes the order with
+// the csr and fetches the issued certificate chain.
+// If the acme server rejects the csr with a badCSR problem, a CSRError explaining what is wrong with it is returned.
+// If the issuer has any deployers, the certificate is then deployed, see Deploy. The certificate is returned even if
+// deploying it fails.
+// Any metadata of the context set with ContextWithMetadata is included in the report and request hook calls.
+func (is Issuer) Issue(ctx context.Context, identifiers []Identifier, csr *x509.CertificateRequest) (IssueResult, error) {
+	md := MetadataFromContext(ctx)
+	rec := newReportRecorder(identifiers, md)
+	if md != nil {
+		is.Client = is.Client.WithMetadata(md)
+	}
+	is.Client.onResponse = rec.response
+	is.Client.done = ctx.Done()
+
+	result, err := is.issue(ctx, identifiers, csr, rec)
+	if err == nil && !is.DryRun && len(is.Deployers) > 0 {
+		done := rec.phase("deploy")
+		result.Deployment, err = is.Deploy(ctx, identifiers, result.Certificates)
+		done()
+	}
+	result.Report = rec.finish(result, err)
+
+	return result, err
+}
+
+// Helper function to perform issuance, recording each phase.
+func (is Issuer) issue(ctx context.Context, identifiers []Identifier, csr *x509.CertificateRequest, rec *reportRecorder) (IssueResult, error) {
+	result := IssueResult{}
+
+	if len(is.Solvers) == 0 {
+		return result, errors.New("acme: issuer has no solvers")
+	}
+
+	if is.Store != nil && !is.DryRun {
+		done := rec.phase("resume")
+		resumed, ok, err := is.resumeFinalize(ctx, identifiers, csr)
+		done()
+		if ok || err != nil {
+			return resumed, err
+		}
+	}
+
+	done := rec.phase("order")
+	order, err := is.Client.NewOrder(is.Account, identifiers)
+	done()
+	if err != nil {
+		return result, err
+	}
+	result.Order = order
+
+	done = rec.phase("authorize")
+	err = is.authorizeAll(ctx, order, rec)
+	done()
+	if err != nil {
+		return result, err
+	}
+
+	if is.DryRun {
+		return is.finishDryRun(result)
+	}
+
+	if is.Store != nil {
+		if err := is.putFinalizeIntent(identifiers, order); err != nil {
+			return result, err
+		}
+	}
+
+	done = rec.phase("finalize")
+	order, err = is.finalize(order, csr)
+	done()
+	result.Order = order
+	if err != nil {
+		return result, err
+	}
+
+	done = rec.phase("certificate")
+	defer done()
+	return is.fetchCertificates(ctx, identifiers, result)
+}
+
+// Helper function to finalize an order, explaining a badCSR problem with a CSRError.
+func (is Issuer) finalize(order Order, csr *x509.CertificateRequest) (Order, error) {
+	finalized, err := is.Client.FinalizeOrder(is.Account, order, csr)
+	if csrErr, ok := is.Client.DiagnoseFinalizeError(err, is.Account, order, csr); ok {
+		return finalized, csrErr
+	}
+	return finalized, err
+}
+
+// Helper function to finish a dry run, refreshing the order and optionally deactivating its authorizations.
+func (is Issuer) finishDryRun(result IssueResult) (IssueResult, error) {
+	order, err := is.Client.FetchOrder(is.Account, result.Order.URL)
+	if err != nil {
+		return result, err
+	}
+	result.Order = order
+
+	if !is.DeactivateAuthorizations {
+		return result, nil
+	}
+
+	for _, authURL := range order.Authorizations {
+		if _, err := is.Client.DeactivateAuthorization(is.Account, authURL); err != nil {
+			return result, fmt.Errorf("acme: error deactivating authorization %s: %v", authURL, err)
+		}
+	}
+
+	return result, nil
+}
+
+// Helper function to download the certificate of a finalized order and remove any finalize intent.
+// If the issuer has a bundle, the chain which verifies against it is used, or the default chain with an error if none
+// do.
+func (is Issuer) fetchCertificates(ctx context.Context, identifiers []Identifier, result IssueResult) (IssueResult, error) {
+	if is.Bundle == nil {
+		certs, err := is.Client.FetchCertificates(is.Account, result.Order.Certificate)
+		if err != nil {
+			return result, err
+		}
+		result.Certificates = certs
+	} else {
+		chains, err := is.Client.fetchChains(is.Account, result.Order.Certificate)
+		if err != nil {
+			return result, err
+		}
+		result.Certificates = chains[0]
+		chain, err := is.Bundle.SelectChain(ctx, chains...)
+		if err != nil {
+			return result, err
+		}
+		result.Certificates = chain
+	}
+
+	if is.Store != nil {
+		if err := is.Store.Delete(finalizeIntentKey(identifiers)); err != nil {
+			return result, fmt.Errorf("acme: error removing finalize intent: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Helper function to get the store key of the finalize intent for a set of identifiers.
+func finalizeIntentKey(identifiers []Identifier) string {
+	return "intents/finalize/" + identifiersHash(identifiers)
+}
+
+// Helper function to hash a set of identifiers for use in store keys.
+// Identifiers are sorted so the same set in any order has the same hash.
+func identifiersHash(identifiers []Identifier) string {
+	ids := make([]string, len(identifiers))
+	for i, id := range identifiers {
+		ids[i] = id.Type + ":" + strings.ToLower(id.Value)
+	}
+	sort.Strings(ids)
+	sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Helper function to record that an order is about to be finalized.
+func (is Issuer) putFinalizeIntent(identifiers []Identifier, order Order) error {
+	b, err := EncodeOrder(order)
+	if err != nil {
+		return err
+	}
+	if err := is.Store.Put(finalizeIntentKey(identifiers), b); err != nil {
+		return fmt.Errorf("acme: error storing finalize intent: %v", err)
+	}
+	return nil
+}
+
+// Helper function to resume a previously recorded finalize intent.
+// Returns true if the intent was resumed, or false if a new order should be created.
+func (is Issuer) resumeFinalize(ctx context.Context, identifiers []Identifier, csr *x509.CertificateRequest) (IssueResult, bool, error) {
+	result := IssueResult{}
+	key := finalizeIntentKey(identifiers)
+
+	b, err := is.Store.Get(key)
+	if err == ErrStoreNotFound {
+		return result, false, nil
+	}
+	if err != nil {
+		return result, false, fmt.Errorf("acme: error reading finalize intent: %v", err)
+	}
+
+	intent, err := DecodeOrder(b)
+	if err != nil {
+		return result, false, err
+	}
+
+	order, err := is.Client.FetchOrder(is.Account, intent.URL)
+	if err != nil {
+		// the order may have been removed by the server, fall back to a new order
+		if _, ok := err.(Problem); ok {
+			return result, false, is.Store.Delete(key)
+		}
+		return result, false, err
+	}
+	result.Order = order
+
+	switch order.Status {
+	case "ready":
+		// the previous finalize never reached the server
+		order, err = is.finalize(order, csr)
+	case "processing":
+		order, err = is.Client.waitFinalizedOrder(is.Account, order)
+	case "valid":
+	default:
+		// pending, invalid or expired orders can't be finalized, start again
+		return result, false, is.Store.Delete(key)
+	}
+	result.Order = order
+	if err != nil {
+		return result, true, err
+	}
+
+	result, err = is.fetchCertificates(ctx, identifiers, result)
+	if err == nil && csr != nil && len(result.Certificates) > 0 && !samePublicKey(csr.PublicKey, result.Certificates[0].PublicKey) {
+		// issued for the key of the csr of a previous run, which the caller may not have, so issue a new certificate
+		return IssueResult{}, false, nil
+	}
+	return result, true, err
+}
+
+// Helper function to fulfil all authorizations of an order, up to Concurrency at once.
+func (is Issuer) authorizeAll(ctx context.Context, order Order, rec *reportRecorder) error {
+	concurrency := is.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// polling of sibling authorizations also stops when failing fast
+	is.Client.done = ctx.Done()
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, concurrency)
+	)
+
+	for _, authURL := range order.Authorizations {
+		sem <- struct{}{}
+		if !is.BestEffort && ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(authURL string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := is.authorize(ctx, order, authURL, rec); err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+				if !is.BestEffort {
+					cancel()
+				}
+			}
+		}(authURL)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	// when failing fast, later errors are likely caused by cancelling the context
+	if len(errs) == 1 || !is.BestEffort {
+		return errs[0]
+	}
+
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Errorf("acme: %d of %d authorizations failed: %s", len(errs), len(order.Authorizations), strings.Join(msgs, "; "))
+}
+
+// Helper function to fulfil a single authorization of an order.
+func (is Issuer) authorize(ctx context.Context, order Order, authURL string, rec *reportRecorder) error {
+	ra := ReportAuthorization{URL: authURL}
+	started := time.Now()
+	defer func() {
+		ra.Seconds = time.Since(started).Seconds()
+		rec.addAuthorization(ra)
+	}()
+
+	auth, err := is.Client.FetchAuthorization(is.Account, authURL)
+	if err != nil {
+		return err
+	}
+	ra.Identifier = auth.Identifier
+	ra.Status = auth.Status
+	ra.Expires = auth.Expires
+
+	switch auth.Status {
+	case "valid":
+		ra.Reused = true
+		for _, chal := range auth.Challenges {
+			if chal.Status == "valid" {
+				ra.ChallengeType = chal.Type
+				ra.Validated = chal.ValidatedTime
+				return is.verify(ctx, auth, chal)
+			}
+		}
+		return nil
+	case "pending":
+	default:
+		return fmt.Errorf("acme: authorization %s for %s has status %q", authURL, auth.Identifier.Value, auth.Status)
+	}
+
+	chal, solver, err := is.pickChallenge(auth)
+	if err != nil {
+		return err
+	}
+	ra.ChallengeType = chal.Type
+
+	if deadline := solveDeadline(order, auth); !deadline.IsZero() {
+		if remaining := time.Until(deadline); remaining < is.MinSolveWindow {
+			return fmt.Errorf("acme: authorization for %s expires in %v, less than the minimum solve window %v",
+				auth.Identifier.Value, remaining, is.MinSolveWindow)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	if err := solver.Present(ctx, auth, chal); err != nil {
+		return fmt.Errorf("acme: error presenting %s challenge for %s: %v", chal.Type, auth.Identifier.Value, err)
+	}
+	defer func() {
+		cleanUpCtx, cancel := solverCleanUpContext(ctx)
+		defer cancel()
+		_ = solver.CleanUp(cleanUpCtx, auth, chal)
+	}()
+
+	chal, err = is.Client.UpdateChallenge(is.Account, chal)
+	ra.ValidationRecord = chal.ValidationRecord
+	ra.Validated = chal.ValidatedTime
+	ra.StatusHistory = chal.StatusHistory
+	if err != nil {
+		ra.Status = "invalid"
+		return fmt.Errorf("acme: error updating %s challenge for %s: %v", chal.Type, auth.Identifier.Value, err)
+	}
+	ra.Status = "valid"
+
+	return is.verify(ctx, auth, chal)
+}
+
+// Maximum time a solver is given to clean up a challenge.
+const solverCleanUpTimeout = time.Minute
+
+// Helper function to create the context for cleaning up a challenge, keeping the metadata of the issuance context
+// but not its cancellation or deadline.
+func solverCleanUpContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	cleanUpCtx := context.Background()
+	if md := MetadataFromContext(ctx); md != nil {
+		cleanUpCtx = ContextWithMetadata(cleanUpCtx, md)
+	}
+	return context.WithTimeout(cleanUpCtx, solverCleanUpTimeout)
+}
+
+// Helper function to run the verifier for a valid challenge, if any.
+func (is Issuer) verify(ctx context.Context, auth Authorization, chal Challenge) error {
+	verifier, ok := is.Verifiers[chal.Type]
+	if !ok {
+		return nil
+	}
+	if err := verifier.Verify(ctx, auth, chal); err != nil {
+		return fmt.Errorf("acme: verification of %s challenge for %s failed: %v", chal.Type, auth.Identifier.Value, err)
+	}
+	return nil
+}
+
+// Helper function to choose the most preferred challenge of an authorization which has a solver.
+func (is Issuer) pickChallenge(auth Authorization) (Challenge, Solver, error) {
+	challengeTypes := is.ChallengeTypes
+	if len(challengeTypes) == 0 {
+		challengeTypes = defaultChallengeTypes
+	}
+
+	for _, t := range challengeTypes {
+		solver, ok := is.Solvers[t]
+		if !ok {
+			continue
+		}
+		chal, ok := auth.ChallengeMap[t]
+		if !ok {
+			continue
+		}
+		return chal, solver, nil
+	}
+
+	return Challenge{}, nil, fmt.Errorf("acme: no solver for challenges %v of authorization for %s", auth.ChallengeTypes, auth.Identifier.Value)
+}
+
+// Helper function to determine the time by which an authorization must be solved.
+// This is the earliest non-zero expiry of the order and authorization, or zero if neither expires.
+func solveDeadline(order Order, auth Authorization) time.Time {
+	deadline := order.Expires
+	if !auth.Expires.IsZero() && (deadline.IsZero() || auth.Expires.Before(deadline)) {
+		deadline = auth.Expires
+	}
+	return deadline
+}
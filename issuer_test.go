@@ -0,0 +1,543 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Solver which uses the challenge test server to fulfil challenges
+type testSolver struct {
+	deadlines chan time.Time
+}
+
+func (ts testSolver) Present(ctx context.Context, auth Authorization, chal Challenge) error {
+	if ts.deadlines != nil {
+		deadline, _ := ctx.Deadline()
+		ts.deadlines <- deadline
+	}
+	preChallenge(auth, chal)
+	return nil
+}
+
+func (ts testSolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error {
+	postChallenge(auth, chal)
+	return nil
+}
+
+type errSolver struct{}
+
+func (es errSolver) Present(ctx context.Context, auth Authorization, chal Challenge) error {
+	return errors.New("present failed")
+}
+
+func (es errSolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error {
+	return nil
+}
+
+func makeIssuer(t *testing.T, solvers map[string]Solver) Issuer {
+	return Issuer{
+		Client:  testClient,
+		Account: makeAccount(t),
+		Solvers: solvers,
+	}
+}
+
+func TestIssuer_Issue(t *testing.T) {
+	domain := randString() + ".com"
+	csr, _ := makeCSR(t, []string{domain})
+
+	deadlines := make(chan time.Time, 1)
+	is := makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: testSolver{deadlines: deadlines}})
+
+	result, err := is.Issue(context.Background(), []Identifier{{Type: "dns", Value: domain}}, csr)
+	if err != nil {
+		t.Fatalf("unexpected error issuing certificate: %v", err)
+	}
+	if result.Order.Status != "valid" {
+		t.Fatalf("expected valid order, got: %s", result.Order.Status)
+	}
+	if len(result.Certificates) == 0 {
+		t.Fatal("no certificates")
+	}
+	if err := result.Certificates[0].VerifyHostname(domain); err != nil {
+		t.Fatalf("error verifying hostname %s: %v", domain, err)
+	}
+
+	deadline := <-deadlines
+	if deadline.IsZero() || deadline.Before(time.Now()) {
+		t.Fatalf("unexpected solver deadline: %v", deadline)
+	}
+
+	if result.Report.OrderURL != result.Order.URL {
+		t.Fatalf("expected report order url %s, got: %s", result.Order.URL, result.Report.OrderURL)
+	}
+	if len(result.Report.Authorizations) != 1 || result.Report.Authorizations[0].ChallengeType != ChallengeTypeDNS01 {
+		t.Fatalf("unexpected report authorizations: %+v", result.Report.Authorizations)
+	}
+	if len(result.Report.Chain) != len(result.Certificates) {
+		t.Fatalf("expected %d certificates in report chain, got: %d", len(result.Certificates), len(result.Report.Chain))
+	}
+}
+
+func TestIssuer_Issue2(t *testing.T) {
+	domain := randString() + ".com"
+	csr, _ := makeCSR(t, []string{domain})
+	ids := []Identifier{{Type: "dns", Value: domain}}
+
+	tests := []struct {
+		name     string
+		issuer   func() Issuer
+		errorStr string
+	}{
+		{
+			name: "no solvers",
+			issuer: func() Issuer {
+				return makeIssuer(t, nil)
+			},
+			errorStr: "no solvers",
+		},
+		{
+			name: "no matching solver",
+			issuer: func() Issuer {
+				return makeIssuer(t, map[string]Solver{"fake-01": testSolver{}})
+			},
+			errorStr: "no solver for challenges",
+		},
+		{
+			name: "present error",
+			issuer: func() Issuer {
+				return makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: errSolver{}})
+			},
+			errorStr: "present failed",
+		},
+		{
+			name: "verifier error",
+			issuer: func() Issuer {
+				is := makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: testSolver{}})
+				is.Verifiers = map[string]Verifier{
+					ChallengeTypeDNS01: VerifierFunc(func(ctx context.Context, auth Authorization, chal Challenge) error {
+						if chal.Status != "valid" {
+							t.Errorf("expected valid challenge to verify, got: %s", chal.Status)
+						}
+						return errors.New("inventory not updated")
+					}),
+				}
+				return is
+			},
+			errorStr: "inventory not updated",
+		},
+		{
+			name: "solve window too small",
+			issuer: func() Issuer {
+				is := makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: testSolver{}})
+				is.MinSolveWindow = 100 * 365 * 24 * time.Hour
+				return is
+			},
+			errorStr: "minimum solve window",
+		},
+	}
+
+	for i, ct := range tests {
+		_, err := ct.issuer().Issue(context.Background(), ids, csr)
+		if err == nil || !strings.Contains(err.Error(), ct.errorStr) {
+			t.Errorf("Issue test %d %q expected error containing %q, got: %v", i, ct.name, ct.errorStr, err)
+		}
+	}
+}
+
+func TestIssuer_Issue_concurrency(t *testing.T) {
+	var domains []string
+	var ids []Identifier
+	for i := 0; i < 5; i++ {
+		domain := randString() + ".com"
+		domains = append(domains, domain)
+		ids = append(ids, Identifier{Type: "dns", Value: domain})
+	}
+	csr, _ := makeCSR(t, domains)
+
+	is := makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: testSolver{}})
+	is.Concurrency = 3
+
+	result, err := is.Issue(context.Background(), ids, csr)
+	if err != nil {
+		t.Fatalf("unexpected error issuing certificate: %v", err)
+	}
+	if len(result.Report.Authorizations) != len(ids) {
+		t.Fatalf("expected %d authorizations in report, got: %d", len(ids), len(result.Report.Authorizations))
+	}
+
+	is = makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: errSolver{}})
+	is.Concurrency = 2
+	is.BestEffort = true
+
+	_, err = is.Issue(context.Background(), ids, csr)
+	if err == nil || !strings.Contains(err.Error(), "5 of 5 authorizations failed") {
+		t.Fatalf("expected all authorizations to fail, got: %v", err)
+	}
+}
+
+func TestIssuer_Issue_resumeFinalize(t *testing.T) {
+	account, order, _ := makeOrderFinalised(t, nil)
+	ids := order.Identifiers
+
+	store := &MemoryStore{}
+	is := Issuer{
+		Client:  testClient,
+		Account: account,
+		// presenting a challenge fails, so a new order can't be issued
+		Solvers: map[string]Solver{ChallengeTypeDNS01: errSolver{}},
+		Store:   store,
+	}
+	if err := is.putFinalizeIntent(ids, order); err != nil {
+		t.Fatalf("unexpected error storing intent: %v", err)
+	}
+
+	result, err := is.Issue(context.Background(), ids, nil)
+	if err != nil {
+		t.Fatalf("unexpected error resuming finalize: %v", err)
+	}
+	if result.Order.URL != order.URL {
+		t.Fatalf("expected resumed order %s, got: %s", order.URL, result.Order.URL)
+	}
+	if len(result.Certificates) == 0 {
+		t.Fatal("no certificates")
+	}
+	if _, err := store.Get(finalizeIntentKey(ids)); err != ErrStoreNotFound {
+		t.Fatalf("expected intent to be removed, got: %v", err)
+	}
+}
+
+func TestIssuer_Issue_dryRun(t *testing.T) {
+	domain := randString() + ".com"
+	ids := []Identifier{{Type: "dns", Value: domain}}
+
+	is := makeIssuer(t, map[string]Solver{ChallengeTypeDNS01: testSolver{}})
+	is.DryRun = true
+	is.DeactivateAuthorizations = true
+
+	result, err := is.Issue(context.Background(), ids, nil)
+	if err != nil {
+		t.Fatalf("unexpected error in dry run: %v", err)
+	}
+	if result.Order.Status != "ready" {
+		t.Fatalf("expected ready order, got: %s", result.Order.Status)
+	}
+	if len(result.Certificates) != 0 {
+		t.Fatal("expected no certificates from dry run")
+	}
+
+	for _, authURL := range result.Order.Authorizations {
+		auth, err := is.Client.FetchAuthorization(is.Account, authURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching authorization: %v", err)
+		}
+		if auth.Status != "deactivated" {
+			t.Fatalf("expected deactivated authorization, got: %s", auth.Status)
+		}
+	}
+}
+
+func Test_finalizeIntentKey(t *testing.T) {
+	a := finalizeIntentKey([]Identifier{{Type: "dns", Value: "a.com"}, {Type: "dns", Value: "B.com"}})
+	b := finalizeIntentKey([]Identifier{{Type: "dns", Value: "b.com"}, {Type: "dns", Value: "a.com"}})
+	if a != b {
+		t.Fatalf("expected matching keys, got: %s %s", a, b)
+	}
+	if c := finalizeIntentKey([]Identifier{{Type: "dns", Value: "a.com"}}); c == a {
+		t.Fatalf("expected different keys for different identifiers, got: %s", c)
+	}
+	if _, err := DirStore("store").path(a); err != nil {
+		t.Fatalf("invalid store key %s: %v", a, err)
+	}
+}
+
+func TestIssuer_pickChallenge(t *testing.T) {
+	auth := Authorization{
+		ChallengeMap: map[string]Challenge{
+			ChallengeTypeHTTP01: {Type: ChallengeTypeHTTP01},
+			ChallengeTypeDNS01:  {Type: ChallengeTypeDNS01},
+		},
+	}
+	solvers := map[string]Solver{
+		ChallengeTypeHTTP01: testSolver{},
+		ChallengeTypeDNS01:  testSolver{},
+	}
+
+	tests := []struct {
+		name           string
+		solvers        map[string]Solver
+		challengeTypes []string
+		expected       string
+	}{
+		{
+			name:     "default preference",
+			solvers:  solvers,
+			expected: ChallengeTypeHTTP01,
+		},
+		{
+			name:           "custom preference",
+			solvers:        solvers,
+			challengeTypes: []string{ChallengeTypeDNS01, ChallengeTypeHTTP01},
+			expected:       ChallengeTypeDNS01,
+		},
+		{
+			name:    "no solver",
+			solvers: map[string]Solver{ChallengeTypeTLSALPN01: testSolver{}},
+		},
+	}
+
+	for _, ct := range tests {
+		is := Issuer{Solvers: ct.solvers, ChallengeTypes: ct.challengeTypes}
+		chal, _, err := is.pickChallenge(auth)
+		if ct.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got none", ct.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, got: %v", ct.name, err)
+		}
+		if chal.Type != ct.expected {
+			t.Errorf("%s: expected challenge %s, got: %s", ct.name, ct.expected, chal.Type)
+		}
+	}
+}
+
+func Test_solveDeadline(t *testing.T) {
+	early := time.Now().Add(time.Hour)
+	late := early.Add(time.Hour)
+
+	tests := []struct {
+		order    Order
+		auth     Authorization
+		expected time.Time
+	}{
+		{},
+		{order: Order{Expires: early}, expected: early},
+		{auth: Authorization{Expires: early}, expected: early},
+		{order: Order{Expires: late}, auth: Authorization{Expires: early}, expected: early},
+		{order: Order{Expires: early}, auth: Authorization{Expires: late}, expected: early},
+	}
+
+	for i, ct := range tests {
+		if got := solveDeadline(ct.order, ct.auth); !got.Equal(ct.expected) {
+			t.Errorf("test %d expected deadline %v, got: %v", i, ct.expected, got)
+		}
+	}
+}
+
+func TestIssuer_Issue_resumeFinalizeKey(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := ca.NewClient()
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	ids := []Identifier{{Type: "dns", Value: "resume.example.test"}}
+	is := Issuer{
+		Client:  c,
+		Account: account,
+		Solvers: map[string]Solver{ChallengeTypeHTTP01: noopSolver{}},
+		Store:   &MemoryStore{},
+	}
+
+	// a previous run finalized an order with a key which has since been lost
+	previousCSR, _ := makeCSR(t, []string{"resume.example.test"})
+	previous, err := is.Issue(context.Background(), ids, previousCSR)
+	if err != nil {
+		t.Fatalf("unexpected error issuing certificate: %v", err)
+	}
+	if err := is.putFinalizeIntent(ids, previous.Order); err != nil {
+		t.Fatalf("unexpected error storing intent: %v", err)
+	}
+
+	csr, key := makeCSR(t, []string{"resume.example.test"})
+	result, err := is.Issue(context.Background(), ids, csr)
+	if err != nil {
+		t.Fatalf("unexpected error issuing certificate: %v", err)
+	}
+	if result.Order.URL == previous.Order.URL {
+		t.Fatal("expected a new order for a csr with a different key")
+	}
+	if !samePublicKey(result.Certificates[0].PublicKey, key.Public()) {
+		t.Fatal("expected certificate for the key of the csr")
+	}
+}
+
+// Solver which fails to present challenges for one identifier after a delay
+type failIdentifierSolver struct {
+	identifier string
+	delay      time.Duration
+}
+
+func (fs failIdentifierSolver) Present(ctx context.Context, auth Authorization, chal Challenge) error {
+	if auth.Identifier.Value != fs.identifier {
+		return nil
+	}
+	time.Sleep(fs.delay)
+	return errors.New("present failed")
+}
+
+func (fs failIdentifierSolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error {
+	return nil
+}
+
+// Helper function to make a client for a dev ca which never validates challenges, so updating them polls until the
+// poll timeout.
+func makeProcessingClient(t *testing.T, ca *DevCA) Client {
+	transport := ca.HTTPClient().Transport
+	c, err := NewClient(DevCADirectoryURL, WithHTTPClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := transport.RoundTrip(req)
+		if err != nil || !strings.Contains(req.URL.Path, "/chal/") {
+			return resp, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.Replace(body, []byte(`"status":"valid"`), []byte(`"status":"processing"`), -1)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		return resp, nil
+	})}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	c.PollInterval = 10 * time.Millisecond
+	c.PollTimeout = 10 * time.Second
+	return c
+}
+
+func TestIssuer_Issue_failFastPolling(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c := makeProcessingClient(t, ca)
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+
+	is := Issuer{
+		Client:      c,
+		Account:     account,
+		Solvers:     map[string]Solver{ChallengeTypeHTTP01: failIdentifierSolver{identifier: "fail.example.test", delay: 100 * time.Millisecond}},
+		Concurrency: 2,
+	}
+	ids := []Identifier{{Type: "dns", Value: "poll.example.test"}, {Type: "dns", Value: "fail.example.test"}}
+	csr, _ := makeCSR(t, []string{"poll.example.test", "fail.example.test"})
+
+	start := time.Now()
+	_, err = is.Issue(context.Background(), ids, csr)
+	if err == nil || !strings.Contains(err.Error(), "present failed") {
+		t.Fatalf("expected present error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected polling of the other authorization to stop, elapsed: %v", elapsed)
+	}
+}
+
+// Solver which records the state of the context passed to CleanUp
+type cleanUpSolver struct {
+	presented chan struct{}
+	cleanUps  chan cleanUpState
+}
+
+type cleanUpState struct {
+	err error
+	md  Metadata
+}
+
+func (cs cleanUpSolver) Present(ctx context.Context, auth Authorization, chal Challenge) error {
+	close(cs.presented)
+	return nil
+}
+
+func (cs cleanUpSolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error {
+	cs.cleanUps <- cleanUpState{err: ctx.Err(), md: MetadataFromContext(ctx)}
+	return nil
+}
+
+func TestIssuer_Issue_cleanUpCancelled(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c := makeProcessingClient(t, ca)
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	solver := cleanUpSolver{presented: make(chan struct{}), cleanUps: make(chan cleanUpState, 1)}
+	is := Issuer{
+		Client:  c,
+		Account: account,
+		Solvers: map[string]Solver{ChallengeTypeHTTP01: solver},
+	}
+	csr, _ := makeCSR(t, []string{"cleanup.example.test"})
+
+	ctx, cancel := context.WithCancel(ContextWithMetadata(context.Background(), Metadata{"tenant": "a"}))
+	go func() {
+		<-solver.presented
+		cancel()
+	}()
+	if _, err := is.Issue(ctx, []Identifier{{Type: "dns", Value: "cleanup.example.test"}}, csr); err == nil {
+		t.Fatal("expected error for cancelled issuance, got none")
+	}
+
+	select {
+	case state := <-solver.cleanUps:
+		if state.err != nil {
+			t.Fatalf("expected clean up context to be live, got: %v", state.err)
+		}
+		if state.md["tenant"] != "a" {
+			t.Fatalf("expected clean up context to keep metadata, got: %v", state.md)
+		}
+	default:
+		t.Fatal("expected challenge to be cleaned up")
+	}
+}
+
+func TestIssuer_Issue_badCSR(t *testing.T) {
+	ca, err := NewDevCA()
+	if err != nil {
+		t.Fatalf("unexpected error creating dev ca: %v", err)
+	}
+	c, err := NewClient(DevCADirectoryURL, WithHTTPClient(ca.HTTPClient()))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account, err := c.NewAccount(makePrivateKey(t), false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating account: %v", err)
+	}
+	is := Issuer{
+		Client:  c,
+		Account: account,
+		Solvers: map[string]Solver{ChallengeTypeHTTP01: noopSolver{}},
+	}
+	csr, _ := makeCSR(t, []string{"csr.example.test", "extra.example.test"})
+
+	_, err = is.Issue(context.Background(), []Identifier{{Type: "dns", Value: "csr.example.test"}}, csr)
+	csrErr, ok := err.(CSRError)
+	if !ok {
+		t.Fatalf("expected csr error, got: %v", err)
+	}
+	if len(csrErr.Findings) == 0 || csrErr.Findings[0].Cause != CSRCauseIdentifiers {
+		t.Fatalf("expected identifiers finding, got: %+v", csrErr.Findings)
+	}
+}
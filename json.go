@@ -0,0 +1,29 @@
+package acme
+
+import "encoding/json"
+
+// JSONCodec is implemented by types which encode and decode json, allowing a Client to use an alternative json
+// implementation, eg one producing canonical output. Implementations must be safe for concurrent use.
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// The default JSONCodec, using encoding/json
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Helper function to get the json codec, defaulting to encoding/json if none set.
+func (c Client) jsonCodec() JSONCodec {
+	if c.codec == nil {
+		return stdJSONCodec{}
+	}
+	return c.codec
+}
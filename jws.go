@@ -7,7 +7,6 @@ package acme
 import (
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	_ "crypto/sha512" // need for EC keys
@@ -16,6 +15,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 )
 
@@ -43,7 +43,7 @@ const noPayload = ""
 // as "jwk" field value. The "jwk" and "kid" fields are mutually exclusive.
 //
 // See https://tools.ietf.org/html/rfc7515#section-7.
-func jwsEncodeJSON(claimset interface{}, key crypto.Signer, kid keyID, nonce, url string) ([]byte, error) {
+func jwsEncodeJSON(random io.Reader, claimset interface{}, key crypto.Signer, kid keyID, nonce, url string) ([]byte, error) {
 	alg, sha := jwsHasher(key.Public())
 	if alg == "" || !sha.Available() {
 		return nil, errUnsupportedKey
@@ -70,7 +70,7 @@ func jwsEncodeJSON(claimset interface{}, key crypto.Signer, kid keyID, nonce, ur
 	}
 	hash := sha.New()
 	_, _ = hash.Write([]byte(phead + "." + payload))
-	sig, err := jwsSign(key, sha, hash.Sum(nil))
+	sig, err := jwsSign(random, key, sha, hash.Sum(nil))
 	if err != nil {
 		return nil, err
 	}
@@ -128,14 +128,14 @@ func jwkEncode(pub crypto.PublicKey) (string, error) {
 	return "", errUnsupportedKey
 }
 
-// jwsSign signs the digest using the given key.
+// jwsSign signs the digest using the given key and random source.
 // The hash is unused for ECDSA keys.
-func jwsSign(key crypto.Signer, hash crypto.Hash, digest []byte) ([]byte, error) {
+func jwsSign(random io.Reader, key crypto.Signer, hash crypto.Hash, digest []byte) ([]byte, error) {
 	switch pub := key.Public().(type) {
 	case *rsa.PublicKey:
-		return key.Sign(rand.Reader, digest, hash)
+		return key.Sign(random, digest, hash)
 	case *ecdsa.PublicKey:
-		sigASN1, err := key.Sign(rand.Reader, digest, hash)
+		sigASN1, err := key.Sign(random, digest, hash)
 		if err != nil {
 			return nil, err
 		}
@@ -8,6 +8,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
@@ -176,7 +177,7 @@ func TestJWSEncodeJSON(t *testing.T) {
 			"50rFt_9qOfJ4sfbLtG1Wwae57BQx1g"
 	)
 
-	b, err := jwsEncodeJSON(claims, testKey, noKeyID, "nonce", "url")
+	b, err := jwsEncodeJSON(rand.Reader, claims, testKey, noKeyID, "nonce", "url")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -207,7 +208,7 @@ func TestJWSEncodeKID(t *testing.T) {
 		payload = "eyJNc2ciOiJIZWxsbyBKV1MifQ"
 	)
 
-	b, err := jwsEncodeJSON(claims, testKeyEC, kid, "nonce", "url")
+	b, err := jwsEncodeJSON(rand.Reader, claims, testKeyEC, kid, "nonce", "url")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -247,7 +248,7 @@ func TestJWSEncodeJSONEC(t *testing.T) {
 	}
 	for i, test := range tt {
 		claims := struct{ Msg string }{"Hello JWS"}
-		b, err := jwsEncodeJSON(claims, test.key, noKeyID, "nonce", "url")
+		b, err := jwsEncodeJSON(rand.Reader, claims, test.key, noKeyID, "nonce", "url")
 		if err != nil {
 			t.Errorf("%d: %v", i, err)
 			continue
@@ -372,7 +373,7 @@ func TestJWSEncodeJSONCustom(t *testing.T) {
 				pub: tc.pub,
 			}
 
-			b, err := jwsEncodeJSON(claims, signer, noKeyID, "nonce", "url")
+			b, err := jwsEncodeJSON(rand.Reader, claims, signer, noKeyID, "nonce", "url")
 			if err != nil {
 				t.Fatal(err)
 			}
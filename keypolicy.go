@@ -0,0 +1,72 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+)
+
+// KeyPolicy is called with the public key of each account key and certificate key before it is used by a Client,
+// returning an error to reject keys which don't meet an organisation's requirements, set with WithKeyPolicy.
+type KeyPolicy func(pub crypto.PublicKey) error
+
+// MinimumKeySize returns a KeyPolicy which rejects rsa keys smaller than rsaBits, ecdsa keys on curves smaller than
+// ecdsaBits and keys of any other type.
+func MinimumKeySize(rsaBits, ecdsaBits int) KeyPolicy {
+	return func(pub crypto.PublicKey) error {
+		switch pub := pub.(type) {
+		case *rsa.PublicKey:
+			if size := pub.N.BitLen(); size < rsaBits {
+				return fmt.Errorf("rsa key size %d is less than %d", size, rsaBits)
+			}
+		case *ecdsa.PublicKey:
+			if size := pub.Curve.Params().BitSize; size < ecdsaBits {
+				return fmt.Errorf("ecdsa curve %s size %d is less than %d", pub.Curve.Params().Name, size, ecdsaBits)
+			}
+		default:
+			return fmt.Errorf("unsupported key type %T", pub)
+		}
+		return nil
+	}
+}
+
+// GenerateKey generates a new ECDSA P-256 private key, suitable for an account or certificate, using the random source
+// set with WithRand. The key is checked with the policy set with WithKeyPolicy.
+func (c Client) GenerateKey() (crypto.Signer, error) {
+	return c.generateKey()
+}
+
+// Helper function to generate an ECDSA P-256 private key, returning the concrete type for callers which encode it.
+func (c Client) generateKey() (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), c.random())
+	if err != nil {
+		return nil, fmt.Errorf("acme: error generating key: %v", err)
+	}
+	if err := c.checkKey(key.Public()); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Helper function to get the random source of a client, crypto/rand unless set with WithRand.
+func (c Client) random() io.Reader {
+	if c.rand == nil {
+		return rand.Reader
+	}
+	return c.rand
+}
+
+// Helper function to check a key against the policy of a client, if any.
+func (c Client) checkKey(pub crypto.PublicKey) error {
+	if c.keyPolicy == nil {
+		return nil
+	}
+	if err := c.keyPolicy(pub); err != nil {
+		return fmt.Errorf("acme: key rejected by policy: %v", err)
+	}
+	return nil
+}
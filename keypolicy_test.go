@@ -0,0 +1,67 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMinimumKeySize(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ecdsa key: %v", err)
+	}
+
+	policy := MinimumKeySize(2048, 256)
+	tests := []struct {
+		pub         crypto.PublicKey
+		errorString string
+	}{
+		{makePrivateKey(t).Public(), ""},
+		{&rsaKey.PublicKey, "rsa key size 1024"},
+		{&p224Key.PublicKey, "ecdsa curve P-224"},
+		{"not a key", "unsupported key type"},
+	}
+	for i, currentTest := range tests {
+		err := policy(currentTest.pub)
+		if currentTest.errorString == "" {
+			if err != nil {
+				t.Errorf("MinimumKeySize test %d expected no error, got: %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), currentTest.errorString) {
+			t.Errorf("MinimumKeySize test %d expected error containing %q, got: %v", i, currentTest.errorString, err)
+		}
+	}
+}
+
+func TestClient_GenerateKey(t *testing.T) {
+	key, err := (Client{}).GenerateKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := key.Public().(*ecdsa.PublicKey); !ok {
+		t.Fatalf("expected ecdsa key, got: %T", key.Public())
+	}
+
+	c := Client{keyPolicy: func(crypto.PublicKey) error { return errors.New("no keys allowed") }}
+	if _, err := c.GenerateKey(); err == nil || !strings.Contains(err.Error(), "no keys allowed") {
+		t.Fatalf("expected policy error, got: %v", err)
+	}
+	if _, err := c.NewAccountOptions(key); err == nil || !strings.Contains(err.Error(), "rejected by policy") {
+		t.Fatalf("expected policy error creating account, got: %v", err)
+	}
+	if _, err := c.NewOrderCSR(key, Order{Identifiers: []Identifier{{Type: "dns", Value: "example.com"}}}); err == nil {
+		t.Fatal("expected policy error creating csr, got none")
+	}
+}
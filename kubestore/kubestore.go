@@ -0,0 +1,305 @@
+// Package kubestore provides an acme.Store backed by Kubernetes Secrets.
+//
+// Requests are made directly to the Kubernetes api server, so no Kubernetes client library is required.
+// See https://kubernetes.io/docs/reference/kubernetes-api/config-and-storage-resources/secret-v1/
+package kubestore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+// Location of the service account credentials mounted in to pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Key of the secret data holding the stored data.
+const dataKey = "data"
+
+// Annotation of a secret holding the store key it was written for.
+const keyAnnotation = "acme.eggsampler.com/key"
+
+// Number of bytes of the sha-256 hash of a store key included in its secret name.
+const keyHashSize = 16
+
+// Secret names must be dns subdomains.
+var regSecretName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// Store is an acme.Store which keeps each key as a Secret in a Kubernetes namespace.
+// Secret names are the store key with slashes replaced by dots, prefixed with Prefix and followed by a hash of the
+// key so that different keys never share a secret, eg "a/b" and "a.b". Keys must only contain lowercase alphanumeric
+// characters, '-', '.' and '/'. Each secret is annotated with its key, which is checked when it is read.
+type Store struct {
+	// Url of the Kubernetes api server, eg "https://kubernetes.default.svc".
+	APIServer string
+
+	// Bearer token used to authenticate with the api server.
+	Token string
+
+	// Namespace the secrets are stored in.
+	Namespace string
+
+	// Prefix of all secret names, optional, eg "acme".
+	Prefix string
+
+	// Client used to make requests. Default http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+var _ acme.AtomicStore = Store{}
+
+// InCluster returns a Store using the service account credentials and namespace of the pod it is running in.
+func InCluster(prefix string) (Store, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return Store{}, errors.New("kubestore: not running in a cluster, KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT not set")
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return Store{}, fmt.Errorf("kubestore: error reading service account token: %v", err)
+	}
+	namespace, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return Store{}, fmt.Errorf("kubestore: error reading service account namespace: %v", err)
+	}
+	caCert, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return Store{}, fmt.Errorf("kubestore: error reading service account ca: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return Store{}, errors.New("kubestore: no certificates in service account ca")
+	}
+
+	return Store{
+		APIServer: "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(namespace)),
+		Prefix:    prefix,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// Get implements acme.Store.Get
+func (s Store) Get(key string) ([]byte, error) {
+	name, err := s.secretName(key)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, acme.ErrStoreNotFound
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("kubestore: error parsing secret %q: %v", name, err)
+	}
+	if stored := secret.Metadata.Annotations[keyAnnotation]; stored != key {
+		return nil, fmt.Errorf("kubestore: secret %q holds key %q, not %q", name, stored, key)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(secret.Data[dataKey])
+	if err != nil {
+		return nil, fmt.Errorf("kubestore: error decoding secret %q: %v", name, err)
+	}
+
+	return b, nil
+}
+
+// Put implements acme.Store.Put
+// The secret is replaced if it exists, otherwise it is created.
+func (s Store) Put(key string, data []byte) error {
+	name, body, err := s.secret(key, data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPut, name, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		return checkResponse(resp, http.StatusOK, http.StatusCreated)
+	}
+
+	// secret doesn't exist yet, create it
+	createResp, err := s.do(http.MethodPost, "", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer createResp.Body.Close()
+
+	return checkResponse(createResp, http.StatusOK, http.StatusCreated)
+}
+
+// Create implements acme.AtomicStore.Create
+// The api server rejects creating a secret which already exists, so only one of several concurrent calls succeeds.
+func (s Store) Create(key string, data []byte) error {
+	_, body, err := s.secret(key, data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPost, "", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return acme.ErrStoreExists
+	}
+
+	return checkResponse(resp, http.StatusOK, http.StatusCreated)
+}
+
+// Delete implements acme.Store.Delete
+func (s Store) Delete(key string) error {
+	name, err := s.secretName(key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp, http.StatusOK, http.StatusAccepted, http.StatusNotFound)
+}
+
+// Helper function to get the name and encoded body of the secret storing data for a key.
+func (s Store) secret(key string, data []byte) (string, []byte, error) {
+	name, err := s.secretName(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": s.Namespace,
+			"annotations": map[string]string{
+				keyAnnotation: key,
+			},
+		},
+		"data": map[string]string{
+			dataKey: base64.StdEncoding.EncodeToString(data),
+		},
+	}
+	body, err := json.Marshal(secret)
+	if err != nil {
+		return "", nil, fmt.Errorf("kubestore: error encoding secret %q: %v", name, err)
+	}
+
+	return name, body, nil
+}
+
+// Helper function to convert a store key to a secret name.
+func (s Store) secretName(key string) (string, error) {
+	hash := sha256.Sum256([]byte(key))
+	name := strings.Replace(key, "/", ".", -1) + "." + hex.EncodeToString(hash[:keyHashSize])
+	if s.Prefix != "" {
+		name = s.Prefix + "." + name
+	}
+	if len(name) > 253 || !regSecretName.MatchString(name) {
+		return "", fmt.Errorf("kubestore: invalid key %q, secret name %q is not a valid dns subdomain", key, name)
+	}
+	return name, nil
+}
+
+// Helper function to make a request to the secrets api, for a single secret if name is set.
+func (s Store) do(method, name string, body io.Reader) (*http.Response, error) {
+	if s.APIServer == "" || s.Namespace == "" {
+		return nil, errors.New("kubestore: no api server or namespace")
+	}
+
+	u := strings.TrimSuffix(s.APIServer, "/") + "/api/v1/namespaces/" + s.Namespace + "/secrets"
+	if name != "" {
+		u += "/" + name
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("kubestore: error creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kubestore: error sending request: %v", err)
+	}
+
+	return resp, nil
+}
+
+// Helper function to check a response has an expected status code, otherwise returning the api status message.
+func checkResponse(resp *http.Response, expectedStatus ...int) error {
+	for _, status := range expectedStatus {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+
+	var status struct {
+		Message string `json:"message"`
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = json.Unmarshal(body, &status)
+
+	return fmt.Errorf("kubestore: unexpected status code %d: %s", resp.StatusCode, status.Message)
+}
@@ -0,0 +1,204 @@
+package kubestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+// Fake api server holding secrets in the "acme" namespace
+func fakeAPIServer(t *testing.T, token string) *httptest.Server {
+	var lock sync.Mutex
+	secrets := map[string][]byte{}
+	const base = "/api/v1/namespaces/acme/secrets"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Unauthorized"}`))
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, base) {
+			http.NotFound(w, r)
+			return
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, base), "/")
+
+		switch r.Method {
+		case http.MethodGet:
+			secret, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(secret)
+		case http.MethodPut:
+			if _, ok := secrets[name]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			secrets[name] = readSecret(t, r)
+		case http.MethodPost:
+			body := readSecret(t, r)
+			var secret struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}
+			_ = json.Unmarshal(body, &secret)
+			if _, ok := secrets[secret.Metadata.Name]; ok {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"message":"secrets \"` + secret.Metadata.Name + `\" already exists"}`))
+				return
+			}
+			secrets[secret.Metadata.Name] = body
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			if _, ok := secrets[name]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(secrets, name)
+		}
+	}))
+}
+
+func readSecret(t *testing.T, r *http.Request) []byte {
+	buf := &bytes.Buffer{}
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		t.Errorf("error reading body: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStore(t *testing.T) {
+	srv := fakeAPIServer(t, "token")
+	defer srv.Close()
+
+	s := Store{APIServer: srv.URL, Token: "token", Namespace: "acme", Prefix: "acme"}
+
+	if _, err := s.Get("accounts/example"); err != acme.ErrStoreNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+
+	for _, data := range [][]byte{[]byte("first"), []byte("second")} {
+		if err := s.Put("accounts/example", data); err != nil {
+			t.Fatalf("unexpected error putting: %v", err)
+		}
+		got, err := s.Get("accounts/example")
+		if err != nil {
+			t.Fatalf("unexpected error getting: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("data mismatch, expected: %s, got: %s", data, got)
+		}
+	}
+
+	if err := s.Delete("accounts/example"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	if err := s.Delete("accounts/example"); err != nil {
+		t.Fatalf("unexpected error deleting missing key: %v", err)
+	}
+	if _, err := s.Get("accounts/example"); err != acme.ErrStoreNotFound {
+		t.Fatalf("expected not found after delete, got: %v", err)
+	}
+}
+
+func TestStore_Create(t *testing.T) {
+	srv := fakeAPIServer(t, "token")
+	defer srv.Close()
+
+	s := Store{APIServer: srv.URL, Token: "token", Namespace: "acme"}
+
+	if err := s.Create("accounts/example/key", []byte("first")); err != nil {
+		t.Fatalf("unexpected error creating: %v", err)
+	}
+	if err := s.Create("accounts/example/key", []byte("second")); err != acme.ErrStoreExists {
+		t.Fatalf("expected exists error, got: %v", err)
+	}
+	got, err := s.Get("accounts/example/key")
+	if err != nil {
+		t.Fatalf("unexpected error getting: %v", err)
+	}
+	if string(got) != "first" {
+		t.Fatalf("expected first data to be kept, got: %s", got)
+	}
+}
+
+func TestStore_keys(t *testing.T) {
+	srv := fakeAPIServer(t, "token")
+	defer srv.Close()
+
+	s := Store{APIServer: srv.URL, Token: "token", Namespace: "acme"}
+
+	// keys which would have the same name if only slashes were replaced
+	if err := s.Put("a/b", []byte("slash")); err != nil {
+		t.Fatalf("unexpected error putting: %v", err)
+	}
+	if err := s.Put("a.b", []byte("dot")); err != nil {
+		t.Fatalf("unexpected error putting: %v", err)
+	}
+	for key, expected := range map[string]string{"a/b": "slash", "a.b": "dot"} {
+		got, err := s.Get(key)
+		if err != nil {
+			t.Fatalf("unexpected error getting %q: %v", key, err)
+		}
+		if string(got) != expected {
+			t.Fatalf("data mismatch for %q, expected: %s, got: %s", key, expected, got)
+		}
+	}
+
+	// a secret annotated with another key is not read
+	name, err := s.secretName("c")
+	if err != nil {
+		t.Fatalf("unexpected error getting secret name: %v", err)
+	}
+	_, body, err := s.secret("d", []byte("other"))
+	if err != nil {
+		t.Fatalf("unexpected error encoding secret: %v", err)
+	}
+	var secret map[string]interface{}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		t.Fatalf("unexpected error parsing secret: %v", err)
+	}
+	secret["metadata"].(map[string]interface{})["name"] = name
+	body, _ = json.Marshal(secret)
+	resp, err := s.do(http.MethodPost, "", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error creating secret: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := s.Get("c"); err == nil || !strings.Contains(err.Error(), `holds key "d"`) {
+		t.Fatalf("expected error for secret of another key, got: %v", err)
+	}
+}
+
+func TestStore_errors(t *testing.T) {
+	srv := fakeAPIServer(t, "token")
+	defer srv.Close()
+
+	s := Store{APIServer: srv.URL, Token: "wrong", Namespace: "acme"}
+	if err := s.Put("key", []byte("data")); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Fatalf("expected unauthorized error, got: %v", err)
+	}
+
+	for _, key := range []string{"", "Upper", "under_score", "/abs", "a//b"} {
+		if _, err := s.Get(key); err == nil {
+			t.Errorf("expected error for key %q, got none", key)
+		}
+	}
+
+	if _, err := (Store{}).Get("key"); err == nil {
+		t.Error("expected error for no api server, got none")
+	}
+}
@@ -0,0 +1,28 @@
+package acme
+
+import "context"
+
+// Metadata holds user defined values describing an issuance flow, eg a tenant id or ticket number, which are passed
+// to request hooks, solvers and issuance reports so each interaction with the acme server can be attributed.
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+// ContextWithMetadata returns a context carrying metadata, for use with Issuer.Issue.
+// The metadata is passed to solvers in their context, included in RequestInfo passed to request hooks and recorded in
+// the issuance Report.
+func ContextWithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext returns the metadata of a context set with ContextWithMetadata, or nil if none.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// WithMetadata returns a copy of the client which includes metadata in the RequestInfo passed to the request hook.
+func (c Client) WithMetadata(md Metadata) Client {
+	c.metadata = md
+	return c
+}
@@ -0,0 +1,52 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextWithMetadata(t *testing.T) {
+	if md := MetadataFromContext(context.Background()); md != nil {
+		t.Fatalf("expected no metadata, got: %v", md)
+	}
+
+	ctx := ContextWithMetadata(context.Background(), Metadata{"tenant": "example"})
+	if md := MetadataFromContext(ctx); md["tenant"] != "example" {
+		t.Fatalf("unexpected metadata: %v", md)
+	}
+}
+
+func TestClient_WithMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var infos []RequestInfo
+	c, err := NewClient(srv.URL, WithRequestHook(func(info RequestInfo) {
+		infos = append(infos, info)
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mc := c.WithMetadata(Metadata{"ticket": "123"})
+	if _, err := mc.get(srv.URL, nil, http.StatusOK); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.get(srv.URL, nil, http.StatusOK); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 requests, got: %d", len(infos))
+	}
+	if infos[1].Metadata["ticket"] != "123" {
+		t.Errorf("expected metadata in request info, got: %v", infos[1].Metadata)
+	}
+	if infos[2].Metadata != nil {
+		t.Errorf("expected original client to have no metadata, got: %v", infos[2].Metadata)
+	}
+}
@@ -0,0 +1,363 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Registration resource of an account, as stored by certbot in regr.json and lego in account.json.
+type migrateRegistration struct {
+	Body struct {
+		Status  string   `json:"status,omitempty"`
+		Contact []string `json:"contact,omitempty"`
+		Orders  string   `json:"orders,omitempty"`
+	} `json:"body"`
+	URI string `json:"uri"`
+}
+
+// Account metadata stored by certbot in meta.json.
+type certbotMeta struct {
+	CreationDate  string `json:"creation_dt"`
+	CreationHost  string `json:"creation_host"`
+	RegisterToEFF *bool  `json:"register_to_eff"`
+}
+
+// Account stored by lego in account.json, the private key is stored separately.
+type legoAccount struct {
+	Email        string              `json:"email"`
+	Registration migrateRegistration `json:"registration"`
+}
+
+// ImportCertbotAccounts imports all accounts registered with an acme directory from a certbot accounts directory,
+// eg /etc/letsencrypt/accounts, so they can be used without registering new accounts.
+func ImportCertbotAccounts(accountsDir, directoryURL string) ([]Account, error) {
+	serverDir, err := certbotServerDir(accountsDir, directoryURL)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(serverDir)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error reading certbot accounts: %v", err)
+	}
+
+	var accounts []Account
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		account, err := ImportCertbotAccount(filepath.Join(serverDir, entry.Name()))
+		if err != nil {
+			return accounts, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// ImportCertbotAccount imports a single account from its certbot account directory, containing regr.json and
+// private_key.json, eg /etc/letsencrypt/accounts/acme-v02.api.letsencrypt.org/directory/<id>.
+func ImportCertbotAccount(dir string) (Account, error) {
+	var regr migrateRegistration
+	if err := readJSONFile(filepath.Join(dir, "regr.json"), &regr); err != nil {
+		return Account{}, err
+	}
+	keyData, err := ioutil.ReadFile(filepath.Join(dir, "private_key.json"))
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error reading certbot account key: %v", err)
+	}
+	key, err := decodePrivateJWK(keyData)
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error decoding certbot account key: %v", err)
+	}
+	return migratedAccount(regr, key)
+}
+
+// ExportCertbotAccount writes an account to a certbot accounts directory, eg /etc/letsencrypt/accounts, under the
+// acme directory it is registered with, returning the directory of the account.
+func ExportCertbotAccount(accountsDir, directoryURL string, account Account) (string, error) {
+	if account.PrivateKey == nil {
+		return "", errors.New("acme: account has no private key")
+	}
+	serverDir, err := certbotServerDir(accountsDir, directoryURL)
+	if err != nil {
+		return "", err
+	}
+	id, err := certbotAccountID(account.PrivateKey.Public())
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(serverDir, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("acme: error creating certbot account directory: %v", err)
+	}
+
+	keyData, err := encodePrivateJWK(account.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("acme: error encoding certbot account key: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "private_key.json"), keyData, 0400); err != nil {
+		return "", err
+	}
+
+	host, _ := os.Hostname()
+	meta := certbotMeta{
+		CreationDate: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		CreationHost: host,
+	}
+	if err := writeJSONFile(filepath.Join(dir, "meta.json"), meta, 0644); err != nil {
+		return "", err
+	}
+	if err := writeJSONFile(filepath.Join(dir, "regr.json"), registrationOf(account), 0644); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// ImportLegoAccount imports the account of an email address registered with an acme directory from a lego accounts
+// directory, eg .lego/accounts, so it can be used without registering a new account.
+func ImportLegoAccount(accountsDir, directoryURL, email string) (Account, error) {
+	dir, err := legoAccountDir(accountsDir, directoryURL, email)
+	if err != nil {
+		return Account{}, err
+	}
+	var la legoAccount
+	if err := readJSONFile(filepath.Join(dir, "account.json"), &la); err != nil {
+		return Account{}, err
+	}
+	keyData, err := ioutil.ReadFile(filepath.Join(dir, "keys", email+".key"))
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error reading lego account key: %v", err)
+	}
+	key, err := decodePrivateKey(string(keyData))
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error decoding lego account key: %v", err)
+	}
+	return migratedAccount(la.Registration, key)
+}
+
+// ExportLegoAccount writes an account to a lego accounts directory, eg .lego/accounts, under the acme directory it is
+// registered with and the email address lego identifies it by, returning the directory of the account.
+func ExportLegoAccount(accountsDir, directoryURL, email string, account Account) (string, error) {
+	if account.PrivateKey == nil {
+		return "", errors.New("acme: account has no private key")
+	}
+	dir, err := legoAccountDir(accountsDir, directoryURL, email)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "keys"), 0700); err != nil {
+		return "", fmt.Errorf("acme: error creating lego account directory: %v", err)
+	}
+
+	var block *pem.Block
+	switch key := account.PrivateKey.(type) {
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return "", fmt.Errorf("acme: error encoding lego account key: %v", err)
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	default:
+		return "", errUnsupportedKey
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "keys", email+".key"), pem.EncodeToMemory(block), 0600); err != nil {
+		return "", err
+	}
+
+	la := legoAccount{Email: email, Registration: registrationOf(account)}
+	if err := writeJSONFile(filepath.Join(dir, "account.json"), la, 0600); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Helper function to get the directory certbot stores accounts of an acme directory in, ie the host and path.
+func certbotServerDir(accountsDir, directoryURL string) (string, error) {
+	u, err := url.Parse(directoryURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("acme: invalid directory url %q", directoryURL)
+	}
+	return filepath.Join(accountsDir, u.Host, filepath.FromSlash(u.Path)), nil
+}
+
+// Helper function to get the directory lego stores an account of an acme directory in, ie the host and email.
+func legoAccountDir(accountsDir, directoryURL, email string) (string, error) {
+	u, err := url.Parse(directoryURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("acme: invalid directory url %q", directoryURL)
+	}
+	if email == "" || strings.ContainsAny(email, `/\`) {
+		return "", fmt.Errorf("acme: invalid lego account email %q", email)
+	}
+	return filepath.Join(accountsDir, strings.Replace(u.Host, ":", "_", -1), email), nil
+}
+
+// Helper function to compute the id certbot names an account directory by, the md5 of its pem encoded public key.
+func certbotAccountID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("acme: error encoding account public key: %v", err)
+	}
+	sum := md5.Sum(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Helper function to create the registration resource of an account.
+func registrationOf(account Account) migrateRegistration {
+	var regr migrateRegistration
+	regr.URI = account.URL
+	regr.Body.Status = account.Status
+	regr.Body.Contact = account.Contact
+	regr.Body.Orders = account.Orders
+	return regr
+}
+
+// Helper function to create an account from an imported registration resource and key.
+func migratedAccount(regr migrateRegistration, key crypto.Signer) (Account, error) {
+	if regr.URI == "" {
+		return Account{}, errors.New("acme: imported account has no url")
+	}
+	thumbprint, err := JWKThumbprint(key.Public())
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error computing account thumbprint: %v", err)
+	}
+	status := regr.Body.Status
+	if status == "" {
+		// certbot doesn't keep the account body, only registered accounts are stored
+		status = "valid"
+	}
+	return Account{
+		Status:     status,
+		Contact:    regr.Body.Contact,
+		Orders:     regr.Body.Orders,
+		URL:        regr.URI,
+		PrivateKey: key,
+		Thumbprint: thumbprint,
+	}, nil
+}
+
+// Helper function to read a json file.
+func readJSONFile(name string, v interface{}) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("acme: error reading %s: %v", name, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("acme: error parsing %s: %v", name, err)
+	}
+	return nil
+}
+
+// Helper function to write a json file.
+func writeJSONFile(name string, v interface{}, perm os.FileMode) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("acme: error encoding %s: %v", name, err)
+	}
+	return writeFileAtomic(name, b, perm)
+}
+
+// Helper function to encode an rsa or ecdsa private key as a jwk.
+func encodePrivateJWK(key crypto.Signer) ([]byte, error) {
+	pub, err := jwkEncode(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	jwk := map[string]string{}
+	if err := json.Unmarshal([]byte(pub), &jwk); err != nil {
+		return nil, err
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		d := key.D.Bytes()
+		jwk["d"] = enc(append(make([]byte, size-len(d)), d...))
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, errors.New("rsa keys with more than 2 primes are not supported")
+		}
+		key.Precompute()
+		jwk["d"] = enc(key.D.Bytes())
+		jwk["p"] = enc(key.Primes[0].Bytes())
+		jwk["q"] = enc(key.Primes[1].Bytes())
+		jwk["dp"] = enc(key.Precomputed.Dp.Bytes())
+		jwk["dq"] = enc(key.Precomputed.Dq.Bytes())
+		jwk["qi"] = enc(key.Precomputed.Qinv.Bytes())
+	default:
+		return nil, errUnsupportedKey
+	}
+	return json.Marshal(jwk)
+}
+
+// Helper function to decode an rsa or ecdsa private jwk.
+func decodePrivateJWK(data []byte) (crypto.Signer, error) {
+	pub, err := parseJWK(data)
+	if err != nil {
+		return nil, err
+	}
+	var jwk struct {
+		D string `json:"d"`
+		P string `json:"p"`
+		Q string `json:"q"`
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid jwk: %v", err)
+	}
+	decode := func(name, s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid jwk %s", name)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	d, err := decode("d", jwk.D)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		key := &ecdsa.PrivateKey{PublicKey: *pub, D: d}
+		if x, y := pub.Curve.ScalarBaseMult(d.Bytes()); x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+			return nil, errors.New("jwk private key does not match public key")
+		}
+		return key, nil
+	case *rsa.PublicKey:
+		p, err := decode("p", jwk.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decode("q", jwk.Q)
+		if err != nil {
+			return nil, err
+		}
+		key := &rsa.PrivateKey{PublicKey: *pub, D: d, Primes: []*big.Int{p, q}}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid jwk rsa key: %v", err)
+		}
+		key.Precompute()
+		return key, nil
+	default:
+		return nil, errUnsupportedKey
+	}
+}
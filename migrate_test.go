@@ -0,0 +1,131 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestCertbotAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certbot")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	directoryURL := "https://acme-v02.api.letsencrypt.org/directory"
+	var exported []Account
+	for i, key := range []crypto.Signer{makePrivateKey(t), rsaKey} {
+		account := Account{
+			Status:     "valid",
+			Contact:    []string{"mailto:certbot@example.com"},
+			URL:        "https://acme-v02.api.letsencrypt.org/acme/acct/" + strconv.Itoa(i+1),
+			PrivateKey: key,
+		}
+		account.Thumbprint, _ = JWKThumbprint(account.PrivateKey.Public())
+		accountDir, err := ExportCertbotAccount(dir, directoryURL, account)
+		if err != nil {
+			t.Fatalf("unexpected error exporting account: %v", err)
+		}
+		id, _ := certbotAccountID(account.PrivateKey.Public())
+		if expected := filepath.Join(dir, "acme-v02.api.letsencrypt.org", "directory", id); accountDir != expected {
+			t.Fatalf("expected account directory %s, got: %s", expected, accountDir)
+		}
+		for _, name := range []string{"meta.json", "regr.json", "private_key.json"} {
+			if _, err := os.Stat(filepath.Join(accountDir, name)); err != nil {
+				t.Fatalf("expected certbot account file %s: %v", name, err)
+			}
+		}
+		exported = append(exported, account)
+	}
+
+	imported, err := ImportCertbotAccounts(dir, directoryURL)
+	if err != nil {
+		t.Fatalf("unexpected error importing accounts: %v", err)
+	}
+	sort.Slice(imported, func(i, j int) bool { return imported[i].URL < imported[j].URL })
+	for i := range exported {
+		exported[i].PrivateKey, imported[i].PrivateKey = nil, nil
+	}
+	if !reflect.DeepEqual(imported, exported) {
+		t.Fatalf("expected imported accounts %+v, got: %+v", exported, imported)
+	}
+
+	// certbot doesn't keep the account body
+	accountDir := filepath.Join(dir, "acme-v02.api.letsencrypt.org", "directory")
+	entries, _ := ioutil.ReadDir(accountDir)
+	regr := filepath.Join(accountDir, entries[0].Name(), "regr.json")
+	if err := ioutil.WriteFile(regr, []byte(`{"body": {}, "uri": "https://acme-v02.api.letsencrypt.org/acme/acct/3"}`), 0644); err != nil {
+		t.Fatalf("error writing regr.json: %v", err)
+	}
+	account, err := ImportCertbotAccount(filepath.Join(accountDir, entries[0].Name()))
+	if err != nil {
+		t.Fatalf("unexpected error importing account: %v", err)
+	}
+	if account.Status != "valid" || account.URL != "https://acme-v02.api.letsencrypt.org/acme/acct/3" {
+		t.Fatalf("unexpected imported account: %+v", account)
+	}
+
+	if _, err := ImportCertbotAccounts(dir, "https://acme-staging-v02.api.letsencrypt.org/directory"); err == nil {
+		t.Fatal("expected error importing accounts of another directory, got none")
+	}
+}
+
+func TestLegoAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := makePrivateKey(t)
+	thumbprint, _ := JWKThumbprint(key.Public())
+	account := Account{
+		Status:     "valid",
+		Contact:    []string{"mailto:lego@example.com"},
+		Orders:     "https://localhost:14000/list-orderz/1",
+		URL:        "https://localhost:14000/my-account/1",
+		PrivateKey: key,
+		Thumbprint: thumbprint,
+	}
+	accountDir, err := ExportLegoAccount(dir, "https://localhost:14000/dir", "lego@example.com", account)
+	if err != nil {
+		t.Fatalf("unexpected error exporting account: %v", err)
+	}
+	if expected := filepath.Join(dir, "localhost_14000", "lego@example.com"); accountDir != expected {
+		t.Fatalf("expected account directory %s, got: %s", expected, accountDir)
+	}
+	if _, err := os.Stat(filepath.Join(accountDir, "keys", "lego@example.com.key")); err != nil {
+		t.Fatalf("expected lego account key: %v", err)
+	}
+
+	imported, err := ImportLegoAccount(dir, "https://localhost:14000/dir", "lego@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error importing account: %v", err)
+	}
+	if imported.Thumbprint != thumbprint {
+		t.Fatal("expected imported account key to match")
+	}
+	imported.PrivateKey, account.PrivateKey = nil, nil
+	if !reflect.DeepEqual(imported, account) {
+		t.Fatalf("expected imported account %+v, got: %+v", account, imported)
+	}
+
+	if _, err := ImportLegoAccount(dir, "https://localhost:14000/dir", "other@example.com"); err == nil {
+		t.Fatal("expected error importing missing account, got none")
+	}
+	if _, err := ExportLegoAccount(dir, "https://localhost:14000/dir", "../lego@example.com", account); err == nil {
+		t.Fatal("expected error exporting with invalid email, got none")
+	}
+}
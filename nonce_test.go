@@ -1,6 +1,12 @@
 package acme
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -25,3 +31,96 @@ func TestNonceStack(t *testing.T) {
 		t.Fatal("expected empty stack")
 	}
 }
+
+func TestNonceStack_concurrent(t *testing.T) {
+	ns := nonceStack{}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	seen := map[string]bool{}
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ns.push(strconv.Itoa(i))
+			nonce := ns.pop()
+			if nonce == "" {
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if seen[nonce] {
+				t.Errorf("nonce %s popped more than once", nonce)
+			}
+			seen[nonce] = true
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClient_nonce_fallback(t *testing.T) {
+	var srv *httptest.Server
+	var heads []string
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads = append(heads, r.URL.Path)
+			if r.URL.Path == "/new-order" {
+				w.Header().Set("Replay-Nonce", "order-nonce")
+			}
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = w.Write([]byte(`{"newAccount":"` + srv.URL + `/new-acct","newOrder":"` + srv.URL + `/new-order"}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	nonce, err := c.nonce()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nonce != "order-nonce" {
+		t.Fatalf("expected nonce from new order endpoint, got: %q", nonce)
+	}
+	if expected := []string{"/dir", "/new-acct", "/new-order"}; !reflect.DeepEqual(heads, expected) {
+		t.Fatalf("expected nonce sources %v, got: %v", expected, heads)
+	}
+
+	c = Client{httpClient: http.DefaultClient, nonces: &nonceStack{}, dir: newDirectoryCache(Directory{URL: srv.URL + "/dir"})}
+	if _, err := c.nonce(); err == nil || !strings.Contains(err.Error(), "no Replay-Nonce header") {
+		t.Fatalf("expected error with no nonce source, got: %v", err)
+	}
+
+	if _, err := (Client{nonces: &nonceStack{}}).nonce(); err == nil {
+		t.Fatal("expected error without directory, got none")
+	}
+}
+
+func TestClient_nonce_newNonceError(t *testing.T) {
+	var heads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads = append(heads, r.URL.Path)
+		if r.URL.Path != "/new-nonce" {
+			w.Header().Set("Replay-Nonce", "other-nonce")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := Client{httpClient: http.DefaultClient, nonces: &nonceStack{}, dir: newDirectoryCache(Directory{
+		URL:        srv.URL + "/dir",
+		NewNonce:   srv.URL + "/new-nonce",
+		NewAccount: srv.URL + "/new-acct",
+	})}
+	if _, err := c.nonce(); err == nil || !strings.Contains(err.Error(), "/new-nonce") {
+		t.Fatalf("expected error from new nonce endpoint, got: %v", err)
+	}
+	if expected := []string{"/new-nonce"}; !reflect.DeepEqual(heads, expected) {
+		t.Fatalf("expected only the new nonce endpoint, got: %v", heads)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 )
@@ -74,6 +75,161 @@ func WithHTTPClient(httpClient *http.Client) OptionFunc {
 	}
 }
 
+// WithRateLimits enables client side rate limiting of requests, given a mapping of endpoint names (eg EndpointNewOrder)
+// to rate limits. Requests which would exceed a limit block until they are permitted, so bulk tooling can throttle
+// itself rather than receiving rate limit errors from the acme server.
+// LetsEncryptRateLimits provides limits approximating those published by Let's Encrypt.
+func WithRateLimits(limits map[string]RateLimit) OptionFunc {
+	return func(client *Client) error {
+		rl := &rateLimiter{buckets: map[string]*tokenBucket{}}
+		for endpoint, limit := range limits {
+			if limit.Requests < 1 || limit.Period <= 0 || limit.Burst < 0 {
+				return fmt.Errorf("invalid rate limit for endpoint %s: %+v", endpoint, limit)
+			}
+			rl.buckets[endpoint] = newTokenBucket(limit)
+		}
+		client.limiter = rl
+		return nil
+	}
+}
+
+// WithJSONCodec sets the json implementation used to encode request payloads and decode responses.
+// Default: encoding/json
+func WithJSONCodec(codec JSONCodec) OptionFunc {
+	return func(client *Client) error {
+		if codec == nil {
+			return errors.New("codec must not be nil")
+		}
+		client.codec = codec
+		return nil
+	}
+}
+
+// WithRetryAfterClamp sets the minimum and maximum time to wait between polling a challenge or order, overriding any
+// Retry-After http header provided by the server. A zero minimum disables that bound, and a zero maximum uses the
+// default. The time waited never exceeds the remaining PollTimeout.
+// Default: the client PollInterval, or the Retry-After time if later, with a maximum of 1 minute.
+func WithRetryAfterClamp(min, max time.Duration) OptionFunc {
+	return func(client *Client) error {
+		if min < 0 || max < 0 {
+			return errors.New("retry after clamp must not be negative")
+		}
+		if max > 0 && min > max {
+			return errors.New("retry after clamp minimum must not be greater than maximum")
+		}
+		client.retryAfterMin = min
+		client.retryAfterMax = max
+		return nil
+	}
+}
+
+// WithTermsOfServiceAgreement sets a function which is called when a request fails with a userActionRequired error
+// linking to new terms of service. If the function returns true, the account agrees to the new terms and the
+// request is retried, otherwise the error is returned.
+// The function is called during the failed request, so should not block for long or make requests with the client.
+// See https://tools.ietf.org/html/rfc8555#section-7.3.3
+func WithTermsOfServiceAgreement(agree func(accountURL, termsURL string) bool) OptionFunc {
+	return func(client *Client) error {
+		if agree == nil {
+			return errors.New("terms of service agreement function must not be nil")
+		}
+		client.termsAgreement = agree
+		return nil
+	}
+}
+
+// WithQuirks enables workarounds for an acme server which deviates from RFC8555, eg StepCAQuirks.
+func WithQuirks(quirks Quirks) OptionFunc {
+	return func(client *Client) error {
+		client.quirks = quirks
+		return nil
+	}
+}
+
+// WithRequestHook sets a function which is called after every http request the client makes with details of the
+// request, including timings of each stage of the request and any Server-Timing headers, eg for metrics or logging.
+// The function is called synchronously so should return quickly, and may be called concurrently if the client is used
+// concurrently.
+func WithRequestHook(hook func(info RequestInfo)) OptionFunc {
+	return func(client *Client) error {
+		if hook == nil {
+			return errors.New("request hook must not be nil")
+		}
+		client.requestHook = hook
+		return nil
+	}
+}
+
+// WithDirectoryChangeHook sets a function which is called when the directory fetched by Client.RefreshDirectory
+// differs from the previous directory, eg to alert operators of new endpoints, terms of service or profiles.
+func WithDirectoryChangeHook(hook func(change DirectoryChange)) OptionFunc {
+	return func(client *Client) error {
+		if hook == nil {
+			return errors.New("directory change hook must not be nil")
+		}
+		client.directoryHook = hook
+		return nil
+	}
+}
+
+// WithRand sets the random source used to generate keys and csrs and to sign requests, eg a reader backed by a DRBG
+// service to meet entropy requirements, or a deterministic reader in tests.
+// Go 1.26 and later ignore custom random sources when generating keys and signing unless GODEBUG=cryptocustomrand=1
+// is set.
+// Default: crypto/rand.Reader
+func WithRand(random io.Reader) OptionFunc {
+	return func(client *Client) error {
+		if random == nil {
+			return errors.New("random source must not be nil")
+		}
+		client.rand = random
+		return nil
+	}
+}
+
+// WithKeyPolicy sets a function which is called to check each account key and certificate key used by the client,
+// rejecting the request if it returns an error, eg MinimumKeySize to veto weak keys.
+func WithKeyPolicy(policy KeyPolicy) OptionFunc {
+	return func(client *Client) error {
+		if policy == nil {
+			return errors.New("key policy must not be nil")
+		}
+		client.keyPolicy = policy
+		return nil
+	}
+}
+
+// WithIdentifierPolicy sets a function which is called to check the identifiers of each new order and
+// pre-authorization created by the client, rejecting the request if it returns an error, eg DenyIdentifiers or
+// RequireSuffixes, combined with IdentifierPolicies, to enforce issuance policy in one place.
+func WithIdentifierPolicy(policy IdentifierPolicy) OptionFunc {
+	return func(client *Client) error {
+		if policy == nil {
+			return errors.New("identifier policy must not be nil")
+		}
+		client.identifierPolicy = policy
+		return nil
+	}
+}
+
+// WithTLSPolicy sets the minimum tls version, permitted cipher suites and ocsp stapling requirement for connections to
+// the acme server. The policy is applied to a copy of the http client and its transport, leaving a client passed to
+// WithHTTPClient unchanged, so this should be passed after WithHTTPClient or WithInsecureSkipVerify if they are used.
+func WithTLSPolicy(policy TLSPolicy) OptionFunc {
+	return func(client *Client) error {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("invalid tls policy: %v", err)
+		}
+		httpClient, err := policy.apply(client.httpClient)
+		if err != nil {
+			return err
+		}
+		client.httpClient = httpClient
+		client.requireStapling = policy.RequireOCSPStapling
+		return nil
+	}
+}
+
 // NewAccountOptionFunc function prototype for passing options to NewClient
 type NewAccountOptionFunc func(crypto.Signer, *Account, *NewAccountRequest, Client) error
 
@@ -158,3 +314,84 @@ func NewAcctOptExternalAccountBinding(binding ExternalAccountBinding) NewAccount
 		return nil
 	}
 }
+
+// NewOrderOptionFunc function prototype for passing options to NewOrderOptions
+type NewOrderOptionFunc func(request *NewOrderRequest) error
+
+// NewOrderOptReplaces indicates the new order replaces an existing certificate, given the ARI unique identifier of
+// the certificate, see ARICertID. If the server rejects the replaces field, eg because the certificate has already
+// been replaced, the order is retried without it and the rejection is provided in the Order ReplacesError field.
+func NewOrderOptReplaces(certID string) NewOrderOptionFunc {
+	return func(request *NewOrderRequest) error {
+		if certID == "" {
+			return errors.New("acme: NewOrderOptReplaces has no certificate identifier")
+		}
+		request.Replaces = certID
+		return nil
+	}
+}
+
+// NewOrderOptStrictReplaces disables retrying a new order without the replaces field, instead returning the error
+// provided by the server.
+func NewOrderOptStrictReplaces() NewOrderOptionFunc {
+	return func(request *NewOrderRequest) error {
+		request.StrictReplaces = true
+		return nil
+	}
+}
+
+// NewOrderOptDropRejected retries a new order rejected by the server with subproblems for some of its identifiers,
+// eg due to a CAA record, with only the remaining identifiers. The rejection is provided in the Order RejectedError
+// field. If all identifiers are rejected the error is returned.
+func NewOrderOptDropRejected() NewOrderOptionFunc {
+	return func(request *NewOrderRequest) error {
+		request.DropRejected = true
+		return nil
+	}
+}
+
+// NewOrderOptProfile requests a certificate profile advertised by the server in the directory meta profiles.
+// See https://datatracker.ietf.org/doc/draft-aaron-acme-profiles/
+func NewOrderOptProfile(profile string) NewOrderOptionFunc {
+	return func(request *NewOrderRequest) error {
+		if profile == "" {
+			return errors.New("acme: NewOrderOptProfile has no profile")
+		}
+		request.Profile = profile
+		return nil
+	}
+}
+
+// UpdateAccountOptionFunc function prototype for passing options to UpdateAccountOptions
+type UpdateAccountOptionFunc func(request *UpdateAccountRequest) error
+
+// UpdateAcctOptContacts replaces the contacts of the account, no contacts removes all existing contacts.
+func UpdateAcctOptContacts(contacts ...string) UpdateAccountOptionFunc {
+	return func(request *UpdateAccountRequest) error {
+		request.Contact = contacts
+		request.UpdateContact = true
+		return nil
+	}
+}
+
+// RevokeCertificateOptionFunc function prototype for passing options to RevokeCertificateOptions
+type RevokeCertificateOptionFunc func(request *RevokeCertificateRequest) error
+
+// RevokeOptKey signs the revocation request with the given key, either the account key or the certificate key.
+func RevokeOptKey(key crypto.Signer) RevokeCertificateOptionFunc {
+	return func(request *RevokeCertificateRequest) error {
+		if key == nil {
+			return errors.New("acme: RevokeOptKey has no key")
+		}
+		request.Key = key
+		return nil
+	}
+}
+
+// RevokeOptReason sets the revocation reason code, eg ReasonKeyCompromise.
+func RevokeOptReason(reason int) RevokeCertificateOptionFunc {
+	return func(request *RevokeCertificateRequest) error {
+		request.Reason = reason
+		return nil
+	}
+}
@@ -2,7 +2,11 @@ package acme
 
 import (
 	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -221,3 +225,294 @@ func TestNewAcctOptExternalAccountBinding(t *testing.T) {
 		}
 	}
 }
+
+func TestNewOrderOptReplaces(t *testing.T) {
+	r := NewOrderRequest{}
+	if err := NewOrderOptReplaces("")(&r); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if err := NewOrderOptReplaces("aaa.bbb")(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if r.Replaces != "aaa.bbb" {
+		t.Fatalf("Replaces not set, got: %q", r.Replaces)
+	}
+}
+
+func TestNewOrderOptStrictReplaces(t *testing.T) {
+	r := NewOrderRequest{}
+	if err := NewOrderOptStrictReplaces()(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !r.StrictReplaces {
+		t.Fatal("StrictReplaces not set")
+	}
+}
+
+func TestNewOrderOptDropRejected(t *testing.T) {
+	r := NewOrderRequest{}
+	if err := NewOrderOptDropRejected()(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !r.DropRejected {
+		t.Fatal("DropRejected not set")
+	}
+}
+
+func TestNewOrderOptProfile(t *testing.T) {
+	r := NewOrderRequest{}
+	if err := NewOrderOptProfile("")(&r); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if err := NewOrderOptProfile("shortlived")(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if r.Profile != "shortlived" {
+		t.Fatalf("Profile not set, got: %q", r.Profile)
+	}
+}
+
+func TestUpdateAcctOptContacts(t *testing.T) {
+	r := UpdateAccountRequest{}
+	if err := UpdateAcctOptContacts()(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !r.UpdateContact || len(r.Contact) != 0 {
+		t.Fatalf("expected contacts to be cleared, got: %+v", r)
+	}
+	if err := UpdateAcctOptContacts("mailto:hello@example.com")(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(r.Contact) != 1 || r.Contact[0] != "mailto:hello@example.com" {
+		t.Fatalf("Contact not set, got: %v", r.Contact)
+	}
+}
+
+func TestRevokeOptKey(t *testing.T) {
+	r := RevokeCertificateRequest{}
+	if err := RevokeOptKey(nil)(&r); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	key := makePrivateKey(t)
+	if err := RevokeOptKey(key)(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if r.Key != key {
+		t.Fatal("Key not set")
+	}
+}
+
+func TestRevokeOptReason(t *testing.T) {
+	r := RevokeCertificateRequest{}
+	if err := RevokeOptReason(ReasonKeyCompromise)(&r); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if r.Reason != ReasonKeyCompromise {
+		t.Fatalf("Reason not set, got: %d", r.Reason)
+	}
+}
+
+func TestWithRateLimits(t *testing.T) {
+	acmeClient := Client{httpClient: http.DefaultClient}
+	opt := WithRateLimits(LetsEncryptRateLimits)
+	if err := opt(&acmeClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(acmeClient.limiter.buckets) != len(LetsEncryptRateLimits) {
+		t.Fatalf("expected %d rate limits, got: %d", len(LetsEncryptRateLimits), len(acmeClient.limiter.buckets))
+	}
+
+	opt2 := WithRateLimits(map[string]RateLimit{EndpointNewOrder: {Requests: 10}})
+	if err := opt2(&acmeClient); err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
+
+type countingCodec struct {
+	marshals, unmarshals int
+}
+
+func (cc *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	cc.marshals++
+	return json.Marshal(v)
+}
+
+func (cc *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	cc.unmarshals++
+	return json.Unmarshal(data, v)
+}
+
+func TestWithJSONCodec(t *testing.T) {
+	acmeClient := Client{httpClient: http.DefaultClient}
+	if err := WithJSONCodec(nil)(&acmeClient); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if _, ok := acmeClient.jsonCodec().(stdJSONCodec); !ok {
+		t.Fatalf("expected default codec, got: %T", acmeClient.jsonCodec())
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"newNonce":"nonce-url"}`))
+	}))
+	defer srv.Close()
+
+	codec := &countingCodec{}
+	c, err := NewClient(srv.URL, WithJSONCodec(codec))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if codec.unmarshals != 1 {
+		t.Fatalf("expected directory decoded with codec, got %d unmarshals", codec.unmarshals)
+	}
+	if c.Directory().NewNonce != "nonce-url" {
+		t.Fatalf("unexpected directory: %+v", c.Directory())
+	}
+}
+
+func TestWithRetryAfterClamp(t *testing.T) {
+	tests := []struct {
+		name         string
+		min, max     time.Duration
+		expectsError bool
+	}{
+		{name: "ok", min: time.Second, max: time.Minute},
+		{name: "min only", min: time.Second},
+		{name: "negative", min: -time.Second, expectsError: true},
+		{name: "min above max", min: time.Minute, max: time.Second, expectsError: true},
+	}
+
+	for i, ct := range tests {
+		acmeClient := Client{}
+		err := WithRetryAfterClamp(ct.min, ct.max)(&acmeClient)
+		if ct.expectsError && err == nil {
+			t.Errorf("retry after clamp test %d %q expected error, got none", i, ct.name)
+		}
+		if !ct.expectsError && err != nil {
+			t.Errorf("retry after clamp test %d %q expected no error, got: %v", i, ct.name, err)
+		}
+		if !ct.expectsError && (acmeClient.retryAfterMin != ct.min || acmeClient.retryAfterMax != ct.max) {
+			t.Errorf("retry after clamp test %d %q values not set", i, ct.name)
+		}
+	}
+}
+
+func TestWithTermsOfServiceAgreement(t *testing.T) {
+	if err := WithTermsOfServiceAgreement(nil)(&Client{}); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	var srv *httptest.Server
+	agreed := false
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce"}`))
+		case "/nonce":
+		case "/acct":
+			body, _ := ioutil.ReadAll(r.Body)
+			var jws struct {
+				Payload string `json:"payload"`
+			}
+			_ = json.Unmarshal(body, &jws)
+			payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+			agreed = strings.Contains(string(payload), `"termsOfServiceAgreed":true`)
+			_, _ = w.Write([]byte(`{"status":"valid"}`))
+		case "/resource":
+			if !agreed {
+				w.Header().Set("Link", `<`+srv.URL+`/terms>;rel="terms-of-service"`)
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"type":"urn:ietf:params:acme:error:userActionRequired","status":403}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	account := Account{URL: srv.URL + "/acct", PrivateKey: makePrivateKey(t)}
+
+	refuse, err := NewClient(srv.URL+"/dir", WithTermsOfServiceAgreement(func(accountURL, termsURL string) bool {
+		return false
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if err := refuse.Fetch(account, srv.URL+"/resource", nil); err == nil {
+		t.Fatal("expected error when refusing terms, got none")
+	}
+
+	var gotAccount, gotTerms string
+	c, err := NewClient(srv.URL+"/dir", WithTermsOfServiceAgreement(func(accountURL, termsURL string) bool {
+		gotAccount, gotTerms = accountURL, termsURL
+		return true
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	if err := c.Fetch(account, srv.URL+"/resource", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !agreed {
+		t.Fatal("expected terms to be agreed")
+	}
+	if gotAccount != account.URL || gotTerms != srv.URL+"/terms" {
+		t.Fatalf("unexpected callback arguments: %s %s", gotAccount, gotTerms)
+	}
+}
+
+func TestWithDirectoryChangeHook(t *testing.T) {
+	acmeClient := Client{}
+	if err := WithDirectoryChangeHook(nil)(&acmeClient); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if err := WithDirectoryChangeHook(func(DirectoryChange) {})(&acmeClient); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if acmeClient.directoryHook == nil {
+		t.Fatal("directory change hook not set")
+	}
+}
+
+func TestWithRand(t *testing.T) {
+	acmeClient := Client{}
+	if err := WithRand(nil)(&acmeClient); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	random := strings.NewReader("random")
+	if err := WithRand(random)(&acmeClient); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if acmeClient.random() != random {
+		t.Fatal("random source not set")
+	}
+}
+
+func TestWithKeyPolicy(t *testing.T) {
+	acmeClient := Client{}
+	if err := WithKeyPolicy(nil)(&acmeClient); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if err := WithKeyPolicy(MinimumKeySize(2048, 256))(&acmeClient); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if acmeClient.keyPolicy == nil {
+		t.Fatal("key policy not set")
+	}
+}
+
+func TestWithIdentifierPolicy(t *testing.T) {
+	acmeClient := Client{}
+	if err := WithIdentifierPolicy(nil)(&acmeClient); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if err := WithIdentifierPolicy(MaxWildcardDepth(2))(&acmeClient); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if acmeClient.identifierPolicy == nil {
+		t.Fatal("identifier policy not set")
+	}
+}
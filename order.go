@@ -6,27 +6,90 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
 // NewOrder initiates a new order for a new certificate.
 func (c Client) NewOrder(account Account, identifiers []Identifier) (Order, error) {
-	newOrderReq := struct {
-		Identifiers []Identifier `json:"identifiers"`
-	}{
+	return c.NewOrderOptions(account, identifiers)
+}
+
+// NewOrderOptions initiates a new order for a new certificate with the provided options.
+func (c Client) NewOrderOptions(account Account, identifiers []Identifier, options ...NewOrderOptionFunc) (Order, error) {
+	newOrderReq := NewOrderRequest{
 		Identifiers: identifiers,
 	}
+
+	for _, opt := range options {
+		if err := opt(&newOrderReq); err != nil {
+			return Order{}, err
+		}
+	}
+	if err := c.checkIdentifiers(newOrderReq.Identifiers); err != nil {
+		return Order{}, err
+	}
+
+	order, err := c.postNewOrder(account, newOrderReq)
+
+	var replacesErr Problem
+	if prob, ok := err.(Problem); ok && newOrderReq.Replaces != "" && !newOrderReq.StrictReplaces && isReplacesConflict(prob) {
+		// the server refused the replaces field, so try again without it
+		newOrderReq.Replaces = ""
+		replacesErr = prob
+		order, err = c.postNewOrder(account, newOrderReq)
+	}
+
+	var rejectedErr Problem
+	if prob, ok := err.(Problem); ok && newOrderReq.DropRejected {
+		// the server refused some of the identifiers, so try again with only the issuable identifiers
+		issuable := prob.IssuableIdentifiers(newOrderReq.Identifiers)
+		if len(issuable) > 0 && len(issuable) < len(newOrderReq.Identifiers) {
+			newOrderReq.Identifiers = issuable
+			rejectedErr = prob
+			order, err = c.postNewOrder(account, newOrderReq)
+		}
+	}
+
+	if err != nil {
+		return order, err
+	}
+	order.ReplacesError = replacesErr
+	order.RejectedError = rejectedErr
+
+	return order, nil
+}
+
+// Helper function to submit a new order request.
+func (c Client) postNewOrder(account Account, newOrderReq NewOrderRequest) (Order, error) {
 	newOrderResp := Order{}
-	resp, err := c.post(c.dir.NewOrder, account.URL, account.PrivateKey, newOrderReq, &newOrderResp, http.StatusCreated)
+	var wireResp wireOrder
+	resp, err := c.post(c.Directory().NewOrder, account.URL, account.PrivateKey, newOrderReq, &wireResp, http.StatusCreated)
 	if err != nil {
 		return newOrderResp, err
 	}
+	if err := wireResp.apply(&newOrderResp); err != nil {
+		return newOrderResp, err
+	}
 
 	newOrderResp.URL = resp.Header.Get("Location")
+	if newOrderResp.URL == "" {
+		return newOrderResp, errors.New("acme: no order url provided in Location header")
+	}
 
 	return newOrderResp, nil
 }
 
+// Helper function to determine whether a problem is due to the server rejecting the replaces field of a new order.
+// Servers may respond with an alreadyReplaced error, or a conflict whose detail mentions the replaces field. Other
+// conflicts, eg with an existing order, are not caused by the replaces field so retrying without it won't help.
+func isReplacesConflict(prob Problem) bool {
+	if prob.Type == "urn:ietf:params:acme:error:alreadyReplaced" {
+		return true
+	}
+	return prob.Status == http.StatusConflict && strings.Contains(strings.ToLower(prob.Detail), "replaces")
+}
+
 // NewOrderDomains is a wrapper for NewOrder(AcmeAccount, []AcmeIdentifiers)
 // Creates a dns identifier for each provided domain
 func (c Client) NewOrderDomains(account Account, domains ...string) (Order, error) {
@@ -47,7 +110,13 @@ func (c Client) FetchOrder(account Account, orderURL string) (Order, error) {
 	orderResp := Order{
 		URL: orderURL, // boulder response doesn't seem to contain location header for this request
 	}
-	_, err := c.post(orderURL, account.URL, account.PrivateKey, "", &orderResp, http.StatusOK)
+	var wireResp wireOrder
+	resp, err := c.post(orderURL, account.URL, account.PrivateKey, "", &wireResp, http.StatusOK)
+	if err != nil {
+		return orderResp, err
+	}
+	err = wireResp.apply(&orderResp)
+	orderResp.RetryAfter = fetchRetryAfter(resp, time.Now())
 
 	return orderResp, err
 }
@@ -95,20 +164,38 @@ func checkFinalizedOrderStatus(order Order) (bool, error) {
 // FinalizeOrder indicates to the acme server that the client considers an order complete and "finalizes" it.
 // If the server believes the authorizations have been filled successfully, a certificate should then be available.
 // This function assumes that the order status is "ready".
+// If the csr is rejected with a badCSR problem, DiagnoseFinalizeError explains what is wrong with it, as Issuer.Issue
+// does.
 func (c Client) FinalizeOrder(account Account, order Order, csr *x509.CertificateRequest) (Order, error) {
+	if err := c.checkKey(csr.PublicKey); err != nil {
+		return order, err
+	}
+
 	finaliseReq := struct {
 		Csr string `json:"csr"`
 	}{
 		Csr: base64.RawURLEncoding.EncodeToString(csr.Raw),
 	}
 
-	resp, err := c.post(order.Finalize, account.URL, account.PrivateKey, finaliseReq, &order, http.StatusOK)
+	var wireResp wireOrder
+	resp, err := c.post(order.Finalize, account.URL, account.PrivateKey, finaliseReq, &wireResp, http.StatusOK)
 	if err != nil {
 		return order, err
 	}
+	if err := wireResp.apply(&order); err != nil {
+		return order, err
+	}
 
-	order.URL = resp.Header.Get("Location")
+	if loc := resp.Header.Get("Location"); loc != "" {
+		order.URL = loc
+	}
+	order.RetryAfter = fetchRetryAfter(resp, time.Now())
+
+	return c.waitFinalizedOrder(account, order)
+}
 
+// Helper function to poll an order until it is no longer processing, or the poll timeout is reached.
+func (c Client) waitFinalizedOrder(account Account, order Order) (Order, error) {
 	if finished, err := checkFinalizedOrderStatus(order); finished {
 		return order, err
 	}
@@ -119,15 +206,21 @@ func (c Client) FinalizeOrder(account Account, order Order, csr *x509.Certificat
 		if time.Now().After(end) {
 			return order, errors.New("acme: finalized order timeout")
 		}
-		time.Sleep(pollInterval)
+		if err := c.pollWait(c.pollDelay(pollInterval, order.RetryAfter, end)); err != nil {
+			return order, err
+		}
 
-		if _, err := c.post(order.URL, account.URL, account.PrivateKey, "", &order, http.StatusOK); err != nil {
+		var wireResp wireOrder
+		resp, err := c.post(order.URL, account.URL, account.PrivateKey, "", &wireResp, http.StatusOK)
+		if err != nil {
 			// i dont think it's worth exiting the loop on this error
 			// it could just be connectivity issue thats resolved before the timeout duration
 			continue
 		}
-
-		order.URL = resp.Header.Get("Location")
+		if err := wireResp.apply(&order); err != nil {
+			return order, err
+		}
+		order.RetryAfter = fetchRetryAfter(resp, time.Now())
 
 		if finished, err := checkFinalizedOrderStatus(order); finished {
 			return order, err
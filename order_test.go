@@ -1,6 +1,11 @@
 package acme
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -133,3 +138,105 @@ func Test_checkFinalizedOrderStatus(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_NewOrderOptions(t *testing.T) {
+	account := makeAccount(t)
+	identifiers := []Identifier{{"dns", randString() + ".com"}}
+
+	_, err := testClient.NewOrderOptions(account, identifiers, NewOrderOptReplaces(""))
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	order, err := testClient.NewOrderOptions(account, identifiers)
+	if err != nil {
+		t.Fatalf("unexpected error making order: %v", err)
+	}
+	if order.Replaces != "" {
+		t.Fatalf("expected no replaces, got: %s", order.Replaces)
+	}
+}
+
+func Test_isReplacesConflict(t *testing.T) {
+	tests := []struct {
+		prob     Problem
+		expected bool
+	}{
+		{Problem{Type: "urn:ietf:params:acme:error:alreadyReplaced", Status: 400}, true},
+		{Problem{Type: "urn:ietf:params:acme:error:malformed", Status: 409, Detail: "Order Replaces a certificate which was already replaced"}, true},
+		{Problem{Type: "urn:ietf:params:acme:error:malformed", Status: 409, Detail: "order already exists"}, false},
+		{Problem{Type: "urn:ietf:params:acme:error:malformed", Status: 409}, false},
+		{Problem{Type: "urn:ietf:params:acme:error:malformed", Status: 400, Detail: "invalid replaces field"}, false},
+		{Problem{Type: "urn:example:alreadyReplaced", Status: 400}, false},
+	}
+	for _, ct := range tests {
+		if got := isReplacesConflict(ct.prob); got != ct.expected {
+			t.Errorf("problem %+v expected %t, got %t", ct.prob, ct.expected, got)
+		}
+	}
+}
+
+func TestClient_NewOrderOptions_dropRejected(t *testing.T) {
+	var srv *httptest.Server
+	var requested [][]Identifier
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		switch r.URL.Path {
+		case "/dir":
+			_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce","newOrder":"` + srv.URL + `/new-order"}`))
+		case "/nonce":
+		case "/new-order":
+			body, _ := ioutil.ReadAll(r.Body)
+			var jws struct {
+				Payload string `json:"payload"`
+			}
+			_ = json.Unmarshal(body, &jws)
+			payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+			var req NewOrderRequest
+			_ = json.Unmarshal(payload, &req)
+			requested = append(requested, req.Identifiers)
+			for _, id := range req.Identifiers {
+				if id.Value == "caa.example.com" {
+					w.Header().Set("Content-Type", "application/problem+json")
+					w.WriteHeader(http.StatusForbidden)
+					_, _ = w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rejectedIdentifier","status":403,"subproblems":[` +
+						`{"type":"urn:ietf:params:acme:error:caa","identifier":{"type":"dns","value":"caa.example.com"}}]}`))
+					return
+				}
+			}
+			w.Header().Set("Location", srv.URL+"/order")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"status":"pending","finalize":"` + srv.URL + `/finalize"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL + "/dir")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	account := Account{URL: srv.URL + "/acct", PrivateKey: makePrivateKey(t)}
+	ids := []Identifier{{Type: "dns", Value: "ok.example.com"}, {Type: "dns", Value: "caa.example.com"}}
+
+	if _, err := c.NewOrderOptions(account, ids); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	requested = nil
+	order, err := c.NewOrderOptions(account, ids, NewOrderOptDropRejected())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requested) != 2 || !reflect.DeepEqual(requested[1], ids[:1]) {
+		t.Fatalf("unexpected order requests: %+v", requested)
+	}
+	if rejected := order.RejectedError.RejectedIdentifiers(); !reflect.DeepEqual(rejected, ids[1:]) {
+		t.Fatalf("unexpected rejected identifiers: %+v", rejected)
+	}
+
+	if _, err := c.NewOrderOptions(account, ids[1:], NewOrderOptDropRejected()); err == nil {
+		t.Fatal("expected error when all identifiers rejected, got none")
+	}
+}
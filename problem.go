@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Problem document as defined in,
@@ -17,6 +20,10 @@ type Problem struct {
 	Status      int          `json:"status,omitempty"`
 	Instance    string       `json:"instance,omitempty"`
 	SubProblems []SubProblem `json:"subproblems,omitempty"`
+
+	// RetryAfter is the time provided by the Retry-After http header of the error response, if any.
+	// Typically provided with rateLimited errors.
+	RetryAfter time.Time `json:"-"`
 }
 
 type SubProblem struct {
@@ -39,6 +46,124 @@ func (err Problem) Error() string {
 	return s
 }
 
+// RejectedIdentifiers returns the identifiers of any subproblems, ie the identifiers the server refused.
+func (err Problem) RejectedIdentifiers() []Identifier {
+	var ids []Identifier
+	for _, sp := range err.SubProblems {
+		if sp.Identifier.Value != "" {
+			ids = append(ids, sp.Identifier)
+		}
+	}
+	return ids
+}
+
+// IssuableIdentifiers returns the requested identifiers which have no subproblem, ie those which could be ordered
+// again without the rejected identifiers.
+// If the problem has no subproblems with identifiers, no identifiers are issuable as the cause is unknown.
+func (err Problem) IssuableIdentifiers(requested []Identifier) []Identifier {
+	rejected := err.RejectedIdentifiers()
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	var ids []Identifier
+	for _, id := range requested {
+		ok := true
+		for _, r := range rejected {
+			if strings.EqualFold(id.Type, r.Type) && strings.EqualFold(id.Value, r.Value) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// HTTP status codes of acme error types, as given in the examples of RFC 8555, used when a problem has no status.
+var problemStatuses = map[string]int{
+	"accountDoesNotExist":     http.StatusBadRequest,
+	"alreadyRevoked":          http.StatusBadRequest,
+	"badCSR":                  http.StatusBadRequest,
+	"badNonce":                http.StatusBadRequest,
+	"badPublicKey":            http.StatusBadRequest,
+	"badRevocationReason":     http.StatusBadRequest,
+	"badSignatureAlgorithm":   http.StatusBadRequest,
+	"caa":                     http.StatusForbidden,
+	"externalAccountRequired": http.StatusUnauthorized,
+	"invalidContact":          http.StatusBadRequest,
+	"malformed":               http.StatusBadRequest,
+	"orderNotReady":           http.StatusForbidden,
+	"rateLimited":             http.StatusTooManyRequests,
+	"rejectedIdentifier":      http.StatusBadRequest,
+	"serverInternal":          http.StatusInternalServerError,
+	"unauthorized":            http.StatusForbidden,
+	"unsupportedContact":      http.StatusBadRequest,
+	"unsupportedIdentifier":   http.StatusBadRequest,
+	"userActionRequired":      http.StatusForbidden,
+}
+
+// HTTPStatus returns the http status code of the problem, or if it has none, the status code typical of its type.
+// Problems of an unknown type default to 400 Bad Request.
+func (err Problem) HTTPStatus() int {
+	if err.Status >= 400 && err.Status < 600 {
+		return err.Status
+	}
+	if status, ok := problemStatuses[strings.TrimPrefix(err.Type, "urn:ietf:params:acme:error:")]; ok {
+		return status
+	}
+	return http.StatusBadRequest
+}
+
+// ErrorProblem converts an error to a Problem, eg to relay the error of a Client to callers of a service embedding it.
+// Problems are returned unchanged, a CSRError is converted to its problem with the findings as detail, and other
+// errors are converted to a serverInternal problem with the error as detail.
+func ErrorProblem(err error) Problem {
+	switch err := err.(type) {
+	case Problem:
+		return err
+	case CSRError:
+		prob := err.Problem
+		if len(err.Findings) > 0 {
+			prob.Detail = err.diagnosis()
+		}
+		return prob
+	}
+	detail := ""
+	if err != nil {
+		detail = err.Error()
+	}
+	return Problem{
+		Type:   "urn:ietf:params:acme:error:serverInternal",
+		Detail: detail,
+		Status: http.StatusInternalServerError,
+	}
+}
+
+// WriteProblem writes an error as an RFC 7807 problem document response, converted with ErrorProblem, including any
+// subproblems. The response status is the HTTPStatus of the problem, with a Retry-After header if the problem has one.
+func WriteProblem(w http.ResponseWriter, err error) {
+	prob := ErrorProblem(err)
+	prob.Status = prob.HTTPStatus()
+
+	if !prob.RetryAfter.IsZero() {
+		seconds := int(time.Until(prob.RetryAfter).Seconds() + 0.5)
+		if seconds < 0 {
+			seconds = 0
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	// a problem only contains strings and ints, so always marshals
+	b, _ := json.Marshal(prob)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(prob.Status)
+	_, _ = w.Write(b)
+}
+
 // Helper function to determine if a response contains an expected status code, or otherwise an error object.
 func checkError(resp *http.Response, expectedStatuses ...int) error {
 	for _, statusCode := range expectedStatuses {
@@ -60,6 +185,7 @@ func checkError(resp *http.Response, expectedStatuses ...int) error {
 	if err := json.Unmarshal(body, &acmeError); err != nil {
 		return fmt.Errorf("acme: parsing error body: %v - %s", err, string(body))
 	}
+	acmeError.RetryAfter = fetchRetryAfter(resp, time.Now())
 
 	return acmeError
 }
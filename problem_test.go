@@ -1,9 +1,13 @@
 package acme
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCheckError(t *testing.T) {
@@ -66,3 +70,88 @@ func TestProblem_Error(t *testing.T) {
 		t.Fatalf("unexpected acme error: %v", err)
 	}
 }
+
+func TestProblem_IssuableIdentifiers(t *testing.T) {
+	requested := []Identifier{{"dns", "a.example.com"}, {"dns", "b.example.com"}, {"dns", "c.example.com"}}
+	prob := Problem{
+		Type: "urn:ietf:params:acme:error:rejectedIdentifier",
+		SubProblems: []SubProblem{
+			{Type: "urn:ietf:params:acme:error:caa", Identifier: Identifier{"dns", "B.example.com"}},
+		},
+	}
+
+	if rejected := prob.RejectedIdentifiers(); len(rejected) != 1 || rejected[0].Value != "B.example.com" {
+		t.Fatalf("unexpected rejected identifiers: %+v", rejected)
+	}
+	issuable := prob.IssuableIdentifiers(requested)
+	if !reflect.DeepEqual(issuable, []Identifier{requested[0], requested[2]}) {
+		t.Fatalf("unexpected issuable identifiers: %+v", issuable)
+	}
+
+	if issuable := (Problem{Type: "urn:ietf:params:acme:error:malformed"}).IssuableIdentifiers(requested); issuable != nil {
+		t.Fatalf("expected no issuable identifiers without subproblems, got: %+v", issuable)
+	}
+}
+
+func TestProblem_HTTPStatus(t *testing.T) {
+	tests := []struct {
+		prob     Problem
+		expected int
+	}{
+		{Problem{Type: "urn:ietf:params:acme:error:rateLimited"}, http.StatusTooManyRequests},
+		{Problem{Type: "urn:ietf:params:acme:error:unauthorized"}, http.StatusForbidden},
+		{Problem{Type: "urn:ietf:params:acme:error:malformed", Status: http.StatusNotFound}, http.StatusNotFound},
+		{Problem{Type: "urn:ietf:params:acme:error:malformed", Status: 123}, http.StatusBadRequest},
+		{Problem{Type: "about:blank"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if status := test.prob.HTTPStatus(); status != test.expected {
+			t.Errorf("expected status %d for %+v, got: %d", test.expected, test.prob, status)
+		}
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	prob := Problem{
+		Type:       "urn:ietf:params:acme:error:rateLimited",
+		Detail:     "too many orders",
+		RetryAfter: time.Now().Add(time.Minute),
+		SubProblems: []SubProblem{
+			{Type: "urn:ietf:params:acme:error:caa", Detail: "caa forbids", Identifier: Identifier{"dns", "example.com"}},
+		},
+	}
+	w := httptest.NewRecorder()
+	WriteProblem(w, prob)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got: %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected problem content type, got: %q", ct)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "60" {
+		t.Fatalf("expected retry after 60 seconds, got: %q", ra)
+	}
+
+	// written problems are read back the same by a client
+	relayed, ok := checkError(w.Result(), http.StatusOK).(Problem)
+	if !ok {
+		t.Fatal("expected relayed response to be a problem")
+	}
+	prob.Status = http.StatusTooManyRequests
+	if relayed.RetryAfter.IsZero() {
+		t.Fatal("expected retry after on relayed problem")
+	}
+	relayed.RetryAfter = prob.RetryAfter
+	if !reflect.DeepEqual(relayed, prob) {
+		t.Fatalf("expected relayed problem %+v, got: %+v", prob, relayed)
+	}
+
+	w = httptest.NewRecorder()
+	WriteProblem(w, errors.New("acme: error fetching response: connection refused"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500 for internal error, got: %d", w.Code)
+	}
+	if prob := ErrorProblem(errors.New("boom")); prob.Type != "urn:ietf:params:acme:error:serverInternal" || prob.Detail != "boom" {
+		t.Fatalf("unexpected problem for internal error: %+v", prob)
+	}
+}
@@ -0,0 +1,75 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Quirks describes deviations of an acme server from RFC8555 which a Client works around, set with WithQuirks.
+type Quirks struct {
+	// DropEmptyContacts removes empty contacts from new account and update account requests, for servers which
+	// reject an empty contact rather than ignoring it.
+	DropEmptyContacts bool
+
+	// NoKeyChange is set for servers which advertise a keyChange url but do not implement account key rollover.
+	// AccountKeyChange returns an error without making a request.
+	NoKeyChange bool
+
+	// IdentifierTypes lists the identifier types the server issues certificates for, eg IdentifierTypeDNS.
+	// If empty any identifier type is allowed. Checked by Client.NewOrderCSR.
+	IdentifierTypes []string
+
+	// NoMixedIdentifiers is set for servers which do not issue a certificate for identifiers of more than one type,
+	// eg both dns names and ip addresses. Checked by Client.NewOrderCSR.
+	NoMixedIdentifiers bool
+}
+
+// StepCAQuirks works around the deviations of smallstep step-ca.
+// See https://smallstep.com/docs/step-ca/acme-basics/
+var StepCAQuirks = Quirks{
+	DropEmptyContacts: true,
+	NoKeyChange:       true,
+}
+
+// StepCADirectory returns the acme directory url of a step-ca provisioner, eg
+// StepCADirectory("https://ca.example.com:9000", "acme") returns "https://ca.example.com:9000/acme/acme/directory".
+// step-ca serves a separate directory for each acme provisioner, rather than a single directory at a fixed path.
+func StepCADirectory(caURL, provisioner string) string {
+	return strings.TrimSuffix(caURL, "/") + "/acme/" + provisioner + "/directory"
+}
+
+var errNoKeyChange = errors.New("acme: server does not support account key change")
+
+// Helper function to apply the DropEmptyContacts quirk to a list of contacts.
+func (q Quirks) contacts(contacts []string) []string {
+	if !q.DropEmptyContacts || contacts == nil {
+		return contacts
+	}
+	filtered := []string{}
+	for _, c := range contacts {
+		if strings.TrimSpace(c) != "" {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// Helper function to check a list of identifiers is allowed by the IdentifierTypes and NoMixedIdentifiers quirks.
+func (q Quirks) checkIdentifiers(identifiers []Identifier) error {
+	for _, id := range identifiers {
+		supported := len(q.IdentifierTypes) == 0
+		for _, t := range q.IdentifierTypes {
+			if strings.EqualFold(t, id.Type) {
+				supported = true
+			}
+		}
+		if !supported {
+			return fmt.Errorf("acme: server does not support %s identifiers", id.Type)
+		}
+		if q.NoMixedIdentifiers && id.Type != identifiers[0].Type {
+			return fmt.Errorf("acme: server does not support mixing %s and %s identifiers", identifiers[0].Type, id.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package acme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuirks_contacts(t *testing.T) {
+	contacts := []string{"mailto:a@example.com", "", " "}
+
+	if got := (Quirks{}).contacts(contacts); !reflect.DeepEqual(got, contacts) {
+		t.Errorf("expected contacts unchanged without quirk, got: %v", got)
+	}
+
+	expected := []string{"mailto:a@example.com"}
+	if got := StepCAQuirks.contacts(contacts); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got: %v", expected, got)
+	}
+
+	if got := StepCAQuirks.contacts(nil); got != nil {
+		t.Errorf("expected nil contacts to stay nil, got: %v", got)
+	}
+}
+
+func TestStepCADirectory(t *testing.T) {
+	expected := "https://ca.example.com:9000/acme/acme/directory"
+	for _, caURL := range []string{"https://ca.example.com:9000", "https://ca.example.com:9000/"} {
+		if got := StepCADirectory(caURL, "acme"); got != expected {
+			t.Errorf("expected %s, got: %s", expected, got)
+		}
+	}
+}
+
+func TestClient_AccountKeyChange_noKeyChange(t *testing.T) {
+	c := Client{quirks: Quirks{NoKeyChange: true}}
+	if _, err := c.AccountKeyChange(Account{}, nil); err != errNoKeyChange {
+		t.Fatalf("expected no key change error, got: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Names of endpoints used to configure client side rate limits with WithRateLimits.
+// Directory endpoints use the same name as their field in the directory object.
+const (
+	EndpointDirectory  = "directory"
+	EndpointNewNonce   = "newNonce"
+	EndpointNewAccount = "newAccount"
+	EndpointNewOrder   = "newOrder"
+	EndpointNewAuthz   = "newAuthz"
+	EndpointRevokeCert = "revokeCert"
+	EndpointKeyChange  = "keyChange"
+
+	// EndpointOther applies to all other requests, eg fetching orders, authorizations, challenges and certificates.
+	EndpointOther = "other"
+)
+
+// RateLimit describes a token bucket budget for requests to an endpoint.
+// Requests are permitted at an average rate of Requests per Period, with bursts of up to Burst requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+
+	// Maximum number of requests permitted at once.
+	// Defaults to Requests if not set or if set to 0.
+	Burst int
+}
+
+// LetsEncryptRateLimits approximates the published Let's Encrypt rate limits for use with WithRateLimits.
+// Note that limits enforced per IP address or per account by the CA apply across all clients sharing that IP
+// address or account, whereas client side limits only apply to a single Client.
+// See https://letsencrypt.org/docs/rate-limits/
+var LetsEncryptRateLimits = map[string]RateLimit{
+	EndpointDirectory:  {Requests: 40, Period: time.Second},
+	EndpointNewNonce:   {Requests: 20, Period: time.Second, Burst: 10},
+	EndpointNewAccount: {Requests: 10, Period: 3 * time.Hour},
+	EndpointNewOrder:   {Requests: 300, Period: 3 * time.Hour},
+	EndpointRevokeCert: {Requests: 10, Period: time.Second, Burst: 100},
+	EndpointOther:      {Requests: 250, Period: time.Second, Burst: 125},
+}
+
+// Collection of token buckets, one per endpoint.
+type rateLimiter struct {
+	buckets map[string]*tokenBucket
+}
+
+// Returned when waiting for a rate limit stops early as the done channel of a client is closed.
+var errRateLimitCancelled = errors.New("acme: request cancelled waiting for rate limit")
+
+// Blocks until a request to the given endpoint is permitted, returning early with the error of ctx if it is done, or
+// errRateLimitCancelled if done is closed, eg when an Issuer context is cancelled.
+// Endpoints without a configured limit are not limited.
+func (rl *rateLimiter) wait(ctx context.Context, done <-chan struct{}, endpoint string) error {
+	if rl == nil {
+		return nil
+	}
+	tb, ok := rl.buckets[endpoint]
+	if !ok {
+		return nil
+	}
+	d := tb.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		tb.release()
+		return ctx.Err()
+	case <-done:
+		tb.release()
+		return errRateLimitCancelled
+	}
+}
+
+// Simple thread-safe token bucket impl
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := limit.Burst
+	if burst == 0 {
+		burst = limit.Requests
+	}
+	return &tokenBucket{
+		rate:   float64(limit.Requests) / limit.Period.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Reserves a token from the bucket, returning how long the caller must wait before using it.
+// The token count may go negative so concurrent callers queue up in order.
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// Returns a token reserved by a caller which gave up waiting for it.
+func (tb *tokenBucket) release() {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	tb.tokens++
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+}
+
+// Helper function to map a request url to the name of the endpoint it is for.
+func (c Client) endpoint(requestURL string) string {
+	dir := c.Directory()
+	switch requestURL {
+	case dir.URL:
+		return EndpointDirectory
+	case dir.NewNonce:
+		return EndpointNewNonce
+	case dir.NewAccount:
+		return EndpointNewAccount
+	case dir.NewOrder:
+		return EndpointNewOrder
+	case dir.NewAuthz:
+		return EndpointNewAuthz
+	case dir.RevokeCert:
+		return EndpointRevokeCert
+	case dir.KeyChange:
+		return EndpointKeyChange
+	default:
+		return EndpointOther
+	}
+}
@@ -0,0 +1,108 @@
+package acme
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_tokenBucket(t *testing.T) {
+	tb := newTokenBucket(RateLimit{Requests: 2, Period: time.Second})
+	now := time.Now()
+
+	// burst defaults to number of requests
+	for i := 0; i < 2; i++ {
+		if d := tb.reserve(now); d != 0 {
+			t.Fatalf("request %d expected no wait, got: %v", i, d)
+		}
+	}
+
+	if d := tb.reserve(now); d != 500*time.Millisecond {
+		t.Fatalf("expected wait of 500ms, got: %v", d)
+	}
+	if d := tb.reserve(now); d != time.Second {
+		t.Fatalf("expected wait of 1s, got: %v", d)
+	}
+
+	// refills no more than the burst size
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if d := tb.reserve(now); d != 0 {
+			t.Fatalf("request %d expected no wait after refill, got: %v", i, d)
+		}
+	}
+	if d := tb.reserve(now); d == 0 {
+		t.Fatal("expected wait after burst, got none")
+	}
+}
+
+func TestClient_endpoint(t *testing.T) {
+	c := Client{dir: newDirectoryCache(Directory{
+		URL:      "https://example.com/directory",
+		NewNonce: "https://example.com/new-nonce",
+		NewOrder: "https://example.com/new-order",
+	})}
+
+	tests := map[string]string{
+		"https://example.com/directory":  EndpointDirectory,
+		"https://example.com/new-nonce":  EndpointNewNonce,
+		"https://example.com/new-order":  EndpointNewOrder,
+		"https://example.com/order/1234": EndpointOther,
+	}
+	for u, expected := range tests {
+		if got := c.endpoint(u); got != expected {
+			t.Errorf("url %s expected endpoint %s, got: %s", u, expected, got)
+		}
+	}
+}
+
+func Test_rateLimiter_wait(t *testing.T) {
+	ctx := context.Background()
+	var rl *rateLimiter
+	if err := rl.wait(ctx, nil, EndpointNewOrder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rl = &rateLimiter{buckets: map[string]*tokenBucket{
+		EndpointNewOrder: newTokenBucket(RateLimit{Requests: 1, Period: 50 * time.Millisecond}),
+	}}
+	start := time.Now()
+	for _, endpoint := range []string{EndpointNewOrder, EndpointNewOrder, EndpointOther} {
+		if err := rl.wait(ctx, nil, endpoint); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected second request to be delayed, elapsed: %v", elapsed)
+	}
+}
+
+func Test_rateLimiter_waitCancel(t *testing.T) {
+	rl := &rateLimiter{buckets: map[string]*tokenBucket{
+		EndpointNewOrder: newTokenBucket(RateLimit{Requests: 1, Period: time.Hour}),
+	}}
+	if err := rl.wait(context.Background(), nil, EndpointNewOrder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := rl.wait(ctx, nil, EndpointNewOrder); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected wait to stop with the context, elapsed: %v", elapsed)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	if err := rl.wait(context.Background(), done, EndpointNewOrder); err != errRateLimitCancelled {
+		t.Fatalf("expected cancelled error, got: %v", err)
+	}
+
+	// cancelled waits give back their token, so the next request waits for one period rather than three
+	if d := rl.buckets[EndpointNewOrder].reserve(time.Now()); d > time.Hour {
+		t.Fatalf("expected cancelled reservations to be released, got wait: %v", d)
+	}
+}
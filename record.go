@@ -0,0 +1,388 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RecordVersion is the schema version of records written by EncodeAccount, EncodeOrder and EncodeCertificate.
+// Records written with an older version are migrated forward when decoded. Records written with a newer version
+// cause an error rather than being silently misread.
+const RecordVersion = 1
+
+// Different kinds of records which may be encoded.
+const (
+	RecordKindAccount     = "account"
+	RecordKindOrder       = "order"
+	RecordKindCertificate = "certificate"
+)
+
+// Envelope written around all record data.
+type record struct {
+	Version int             `json:"version"`
+	Kind    string          `json:"kind"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// recordMigration upgrades the data of a record of the given kind by a single version.
+type recordMigration func(kind string, data json.RawMessage) (json.RawMessage, error)
+
+// recordMigrations maps a record version to the migration which upgrades it to the next version.
+// When changing the layout of a record, increment RecordVersion and add a migration from the previous version here.
+var recordMigrations = map[int]recordMigration{}
+
+type accountRecord struct {
+	URL        string   `json:"url"`
+	PrivateKey string   `json:"privateKey"`
+	Status     string   `json:"status"`
+	Contact    []string `json:"contact,omitempty"`
+	Orders     string   `json:"orders,omitempty"`
+}
+
+// Layout of an order record, kept separate from Order so that changes to how orders are sent and received from an
+// acme server don't change how they are persisted.
+type orderRecord struct {
+	URL            string             `json:"url"`
+	Status         string             `json:"status"`
+	Expires        time.Time          `json:"expires"`
+	Identifiers    []identifierRecord `json:"identifiers"`
+	NotBefore      time.Time          `json:"notBefore"`
+	NotAfter       time.Time          `json:"notAfter"`
+	Error          *problemRecord     `json:"error,omitempty"`
+	Authorizations []string           `json:"authorizations"`
+	Finalize       string             `json:"finalize"`
+	Certificate    string             `json:"certificate"`
+	Replaces       string             `json:"replaces,omitempty"`
+	Profile        string             `json:"profile,omitempty"`
+}
+
+type identifierRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type problemRecord struct {
+	Type        string             `json:"type"`
+	Detail      string             `json:"detail,omitempty"`
+	Status      int                `json:"status,omitempty"`
+	Instance    string             `json:"instance,omitempty"`
+	SubProblems []subProblemRecord `json:"subproblems,omitempty"`
+}
+
+type subProblemRecord struct {
+	Type       string           `json:"type"`
+	Detail     string           `json:"detail"`
+	Identifier identifierRecord `json:"identifier"`
+}
+
+type certificateRecord struct {
+	Certificates string `json:"certificates"`
+	PrivateKey   string `json:"privateKey,omitempty"`
+}
+
+// Helper function to wrap record data in a versioned envelope.
+func encodeRecord(kind string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error encoding %s record: %v", kind, err)
+	}
+
+	return json.Marshal(record{
+		Version: RecordVersion,
+		Kind:    kind,
+		Data:    data,
+	})
+}
+
+// Helper function to unwrap record data from a versioned envelope, applying any migrations required.
+func decodeRecord(b []byte, kind string, v interface{}) error {
+	var rec record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return fmt.Errorf("acme: error parsing %s record: %v", kind, err)
+	}
+
+	if rec.Kind != kind {
+		return fmt.Errorf("acme: expected %s record, got: %q", kind, rec.Kind)
+	}
+	if rec.Version < 1 {
+		return fmt.Errorf("acme: %s record has no version", kind)
+	}
+	if rec.Version > RecordVersion {
+		return fmt.Errorf("acme: %s record version %d is newer than supported version %d", kind, rec.Version, RecordVersion)
+	}
+
+	if err := migrateRecord(&rec, RecordVersion); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(rec.Data, v); err != nil {
+		return fmt.Errorf("acme: error parsing %s record data: %v", kind, err)
+	}
+
+	return nil
+}
+
+// Helper function to apply migrations to a record until it reaches the target version.
+func migrateRecord(rec *record, target int) error {
+	for rec.Version < target {
+		migrate, ok := recordMigrations[rec.Version]
+		if !ok {
+			return fmt.Errorf("acme: no migration for %s record version %d", rec.Kind, rec.Version)
+		}
+		data, err := migrate(rec.Kind, rec.Data)
+		if err != nil {
+			return fmt.Errorf("acme: error migrating %s record from version %d: %v", rec.Kind, rec.Version, err)
+		}
+		rec.Data = data
+		rec.Version++
+	}
+	return nil
+}
+
+// Helper function to pem encode a private key in PKCS#8 format.
+func encodePrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// Helper function to decode a pem encoded private key in PKCS#8, PKCS#1 or EC format.
+func decodePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no pem data")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errUnsupportedKey
+	}
+	return signer, nil
+}
+
+// EncodeAccount encodes an account, including its private key, as a versioned record suitable for persisting in a
+// Store.
+func EncodeAccount(account Account) ([]byte, error) {
+	if account.PrivateKey == nil {
+		return nil, errors.New("acme: account has no private key")
+	}
+
+	key, err := encodePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error encoding account private key: %v", err)
+	}
+
+	return encodeRecord(RecordKindAccount, accountRecord{
+		URL:        account.URL,
+		PrivateKey: key,
+		Status:     account.Status,
+		Contact:    account.Contact,
+		Orders:     account.Orders,
+	})
+}
+
+// DecodeAccount decodes an account record previously encoded with EncodeAccount.
+func DecodeAccount(b []byte) (Account, error) {
+	var rec accountRecord
+	if err := decodeRecord(b, RecordKindAccount, &rec); err != nil {
+		return Account{}, err
+	}
+
+	key, err := decodePrivateKey(rec.PrivateKey)
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error decoding account private key: %v", err)
+	}
+
+	thumbprint, err := JWKThumbprint(key.Public())
+	if err != nil {
+		return Account{}, fmt.Errorf("acme: error computing account thumbprint: %v", err)
+	}
+
+	return Account{
+		Status:     rec.Status,
+		Contact:    rec.Contact,
+		Orders:     rec.Orders,
+		URL:        rec.URL,
+		PrivateKey: key,
+		Thumbprint: thumbprint,
+	}, nil
+}
+
+// EncodeOrder encodes an order as a versioned record suitable for persisting in a Store.
+func EncodeOrder(order Order) ([]byte, error) {
+	rec := orderRecord{
+		URL:            order.URL,
+		Status:         order.Status,
+		Expires:        order.Expires,
+		Identifiers:    encodeIdentifierRecords(order.Identifiers),
+		NotBefore:      order.NotBefore,
+		NotAfter:       order.NotAfter,
+		Authorizations: order.Authorizations,
+		Finalize:       order.Finalize,
+		Certificate:    order.Certificate,
+		Replaces:       order.Replaces,
+		Profile:        order.Profile,
+	}
+	if order.Error.Type != "" {
+		rec.Error = &problemRecord{
+			Type:     order.Error.Type,
+			Detail:   order.Error.Detail,
+			Status:   order.Error.Status,
+			Instance: order.Error.Instance,
+		}
+		for _, sub := range order.Error.SubProblems {
+			rec.Error.SubProblems = append(rec.Error.SubProblems, subProblemRecord{
+				Type:       sub.Type,
+				Detail:     sub.Detail,
+				Identifier: identifierRecord{Type: sub.Identifier.Type, Value: sub.Identifier.Value},
+			})
+		}
+	}
+
+	return encodeRecord(RecordKindOrder, rec)
+}
+
+// DecodeOrder decodes an order record previously encoded with EncodeOrder.
+func DecodeOrder(b []byte) (Order, error) {
+	var rec orderRecord
+	if err := decodeRecord(b, RecordKindOrder, &rec); err != nil {
+		return Order{}, err
+	}
+
+	order := Order{
+		URL:            rec.URL,
+		Status:         rec.Status,
+		Expires:        rec.Expires,
+		Identifiers:    decodeIdentifierRecords(rec.Identifiers),
+		NotBefore:      rec.NotBefore,
+		NotAfter:       rec.NotAfter,
+		Authorizations: rec.Authorizations,
+		Finalize:       rec.Finalize,
+		Certificate:    rec.Certificate,
+		Replaces:       rec.Replaces,
+		Profile:        rec.Profile,
+	}
+	if rec.Error != nil {
+		order.Error = Problem{
+			Type:     rec.Error.Type,
+			Detail:   rec.Error.Detail,
+			Status:   rec.Error.Status,
+			Instance: rec.Error.Instance,
+		}
+		for _, sub := range rec.Error.SubProblems {
+			order.Error.SubProblems = append(order.Error.SubProblems, SubProblem{
+				Type:       sub.Type,
+				Detail:     sub.Detail,
+				Identifier: Identifier{Type: sub.Identifier.Type, Value: sub.Identifier.Value},
+			})
+		}
+	}
+
+	return order, nil
+}
+
+// Helper function to convert identifiers to their record layout.
+func encodeIdentifierRecords(identifiers []Identifier) []identifierRecord {
+	if identifiers == nil {
+		return nil
+	}
+	recs := make([]identifierRecord, len(identifiers))
+	for i, id := range identifiers {
+		recs[i] = identifierRecord{Type: id.Type, Value: id.Value}
+	}
+	return recs
+}
+
+// Helper function to convert identifiers from their record layout.
+func decodeIdentifierRecords(recs []identifierRecord) []Identifier {
+	if recs == nil {
+		return nil
+	}
+	identifiers := make([]Identifier, len(recs))
+	for i, rec := range recs {
+		identifiers[i] = Identifier{Type: rec.Type, Value: rec.Value}
+	}
+	return identifiers
+}
+
+// EncodeCertificate encodes a certificate chain, and optionally the certificate private key, as a versioned record
+// suitable for persisting in a Store.
+func EncodeCertificate(certs []*x509.Certificate, key crypto.Signer) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("acme: no certificates to encode")
+	}
+
+	var rec certificateRecord
+	for _, c := range certs {
+		rec.Certificates += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+
+	if key != nil {
+		var err error
+		rec.PrivateKey, err = encodePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("acme: error encoding certificate private key: %v", err)
+		}
+	}
+
+	return encodeRecord(RecordKindCertificate, rec)
+}
+
+// DecodeCertificate decodes a certificate record previously encoded with EncodeCertificate.
+// The returned private key is nil if no key was encoded.
+func DecodeCertificate(b []byte) ([]*x509.Certificate, crypto.Signer, error) {
+	var rec certificateRecord
+	if err := decodeRecord(b, RecordKindCertificate, &rec); err != nil {
+		return nil, nil, err
+	}
+
+	var certs []*x509.Certificate
+	data := []byte(rec.Certificates)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("acme: error parsing certificate record: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, nil, errors.New("acme: certificate record contains no certificates")
+	}
+
+	if rec.PrivateKey == "" {
+		return certs, nil, nil
+	}
+
+	key, err := decodePrivateKey(rec.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acme: error decoding certificate private key: %v", err)
+	}
+
+	return certs, key, nil
+}
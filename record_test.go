@@ -0,0 +1,221 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeAccount(t *testing.T) {
+	if _, err := EncodeAccount(Account{}); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	key := makePrivateKey(t)
+	thumbprint, err := JWKThumbprint(key.Public())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	account := Account{
+		Status:     "valid",
+		Contact:    []string{"mailto:test@test.com"},
+		Orders:     "https://example.com/orders",
+		URL:        "https://example.com/acct/1",
+		PrivateKey: key,
+		Thumbprint: thumbprint,
+	}
+
+	b, err := EncodeAccount(account)
+	if err != nil {
+		t.Fatalf("unexpected error encoding account: %v", err)
+	}
+
+	decoded, err := DecodeAccount(b)
+	if err != nil {
+		t.Fatalf("unexpected error decoding account: %v", err)
+	}
+	if !reflect.DeepEqual(account, decoded) {
+		t.Fatalf("account mismatch, expected: %+v, got: %+v", account, decoded)
+	}
+
+	if _, err := DecodeOrder(b); err == nil || !strings.Contains(err.Error(), "expected order record") {
+		t.Fatalf("expected kind error, got: %v", err)
+	}
+}
+
+func TestEncodeOrder(t *testing.T) {
+	order := Order{
+		Status:         "pending",
+		Expires:        time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		Identifiers:    []Identifier{{Type: "dns", Value: "example.com"}},
+		Authorizations: []string{"https://example.com/authz/1"},
+		Finalize:       "https://example.com/finalize/1",
+		URL:            "https://example.com/order/1",
+	}
+
+	b, err := EncodeOrder(order)
+	if err != nil {
+		t.Fatalf("unexpected error encoding order: %v", err)
+	}
+
+	decoded, err := DecodeOrder(b)
+	if err != nil {
+		t.Fatalf("unexpected error decoding order: %v", err)
+	}
+	if !reflect.DeepEqual(order, decoded) {
+		t.Fatalf("order mismatch, expected: %+v, got: %+v", order, decoded)
+	}
+
+	order.Error = Problem{
+		Type:        "urn:ietf:params:acme:error:rejectedIdentifier",
+		Detail:      "rejected",
+		Status:      400,
+		SubProblems: []SubProblem{{Type: "urn:ietf:params:acme:error:rejectedIdentifier", Detail: "no", Identifier: order.Identifiers[0]}},
+	}
+	order.Replaces = "aaa.bbb"
+	order.Profile = "shortlived"
+	b, err = EncodeOrder(order)
+	if err != nil {
+		t.Fatalf("unexpected error encoding order: %v", err)
+	}
+	decoded, err = DecodeOrder(b)
+	if err != nil {
+		t.Fatalf("unexpected error decoding order: %v", err)
+	}
+	if !reflect.DeepEqual(order, decoded) {
+		t.Fatalf("order mismatch, expected: %+v, got: %+v", order, decoded)
+	}
+}
+
+func TestDecodeOrder_version1(t *testing.T) {
+	// the layout of version 1 order records, which must keep decoding regardless of changes to Order
+	b := []byte(`{"version":1,"kind":"order","data":{"url":"https://example.com/order/1","status":"invalid",` +
+		`"expires":"2020-01-02T03:04:05Z","identifiers":[{"type":"dns","value":"example.com"}],` +
+		`"notBefore":"0001-01-01T00:00:00Z","notAfter":"0001-01-01T00:00:00Z",` +
+		`"error":{"type":"urn:ietf:params:acme:error:unauthorized","detail":"denied","status":403},` +
+		`"authorizations":["https://example.com/authz/1"],"finalize":"https://example.com/finalize/1",` +
+		`"certificate":"","replaces":"aaa.bbb"}}`)
+	expected := Order{
+		URL:            "https://example.com/order/1",
+		Status:         "invalid",
+		Expires:        time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Identifiers:    []Identifier{{Type: "dns", Value: "example.com"}},
+		Error:          Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "denied", Status: 403},
+		Authorizations: []string{"https://example.com/authz/1"},
+		Finalize:       "https://example.com/finalize/1",
+		Replaces:       "aaa.bbb",
+	}
+	decoded, err := DecodeOrder(b)
+	if err != nil {
+		t.Fatalf("unexpected error decoding order: %v", err)
+	}
+	if !reflect.DeepEqual(expected, decoded) {
+		t.Fatalf("order mismatch, expected: %+v, got: %+v", expected, decoded)
+	}
+}
+
+func TestEncodeCertificate(t *testing.T) {
+	if _, err := EncodeCertificate(nil, nil); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	cert, key := makeSelfSigned(t, "example.com")
+
+	b, err := EncodeCertificate([]*x509.Certificate{cert}, key)
+	if err != nil {
+		t.Fatalf("unexpected error encoding certificate: %v", err)
+	}
+	certs, decodedKey, err := DecodeCertificate(b)
+	if err != nil {
+		t.Fatalf("unexpected error decoding certificate: %v", err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Fatalf("certificate mismatch, got: %+v", certs)
+	}
+	if !reflect.DeepEqual(key.Public(), decodedKey.Public()) {
+		t.Fatal("private key mismatch")
+	}
+
+	b, err = EncodeCertificate([]*x509.Certificate{cert}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error encoding certificate: %v", err)
+	}
+	if _, decodedKey, err = DecodeCertificate(b); err != nil || decodedKey != nil {
+		t.Fatalf("expected no key and no error, got: %v %v", decodedKey, err)
+	}
+}
+
+func Test_decodeRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   string
+		errorStr string
+		expected string
+	}{
+		{
+			name:     "bad json",
+			record:   `{`,
+			errorStr: "error parsing",
+		},
+		{
+			name:     "wrong kind",
+			record:   `{"version":1,"kind":"other","data":{}}`,
+			errorStr: "expected test record",
+		},
+		{
+			name:     "no version",
+			record:   `{"kind":"test","data":{}}`,
+			errorStr: "no version",
+		},
+		{
+			name:     "newer version",
+			record:   `{"version":1000,"kind":"test","data":{}}`,
+			errorStr: "newer than supported",
+		},
+		{
+			name:     "current version",
+			record:   `{"version":1,"kind":"test","data":{"value":"current"}}`,
+			expected: "current",
+		},
+	}
+
+	for _, ct := range tests {
+		var v struct {
+			Value string `json:"value"`
+		}
+		err := decodeRecord([]byte(ct.record), "test", &v)
+		if ct.errorStr != "" && (err == nil || !strings.Contains(err.Error(), ct.errorStr)) {
+			t.Errorf("%s: expected error containing %q, got: %v", ct.name, ct.errorStr, err)
+		}
+		if ct.errorStr == "" && err != nil {
+			t.Errorf("%s: expected no error, got: %v", ct.name, err)
+		}
+		if v.Value != ct.expected {
+			t.Errorf("%s: expected value %q, got %q", ct.name, ct.expected, v.Value)
+		}
+	}
+}
+
+func Test_migrateRecord(t *testing.T) {
+	defer func(m map[int]recordMigration) { recordMigrations = m }(recordMigrations)
+	recordMigrations = map[int]recordMigration{
+		1: func(kind string, data json.RawMessage) (json.RawMessage, error) {
+			return json.RawMessage(`{"value":"migrated"}`), nil
+		},
+	}
+
+	rec := record{Version: 1, Kind: "test", Data: json.RawMessage(`{"value":"old"}`)}
+	if err := migrateRecord(&rec, 2); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if rec.Version != 2 || string(rec.Data) != `{"value":"migrated"}` {
+		t.Fatalf("record not migrated: %+v", rec)
+	}
+
+	if err := migrateRecord(&rec, 3); err == nil || !strings.Contains(err.Error(), "no migration") {
+		t.Fatalf("expected missing migration error, got: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package acme
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Http headers which may hold an identifier of a request assigned by the acme server, collected in a Report.
+var requestIDHeaders = []string{"X-Request-Id", "Request-Id", "X-Correlation-Id"}
+
+// Report describes a single run of Issuer.Issue, intended for logging and comparing issuance runs.
+// It can be encoded as json.
+type Report struct {
+	Identifiers []Identifier `json:"identifiers"`
+	OrderURL    string       `json:"orderUrl,omitempty"`
+	Started     time.Time    `json:"started"`
+	Seconds     float64      `json:"seconds"`
+
+	// Time taken by each phase of issuance, in order.
+	Phases []ReportPhase `json:"phases"`
+
+	// Outcome of each authorization of the order.
+	Authorizations []ReportAuthorization `json:"authorizations,omitempty"`
+
+	// The issued certificate chain, leaf certificate first.
+	Chain []ReportCertificate `json:"chain,omitempty"`
+
+	// Request identifiers provided by the acme server in response headers, if any.
+	RequestIDs []string `json:"requestIds,omitempty"`
+
+	// The error which stopped issuance, if any.
+	Error string `json:"error,omitempty"`
+
+	// Metadata of the issuance flow, see ContextWithMetadata.
+	Metadata Metadata `json:"metadata,omitempty"`
+}
+
+// ReportPhase is the time taken by a phase of issuance, eg "order", "authorize", "finalize", "certificate" or "deploy".
+type ReportPhase struct {
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+	Seconds float64   `json:"seconds"`
+}
+
+// ReportAuthorization describes how an authorization of an order was fulfilled.
+type ReportAuthorization struct {
+	Identifier    Identifier `json:"identifier"`
+	URL           string     `json:"url"`
+	Status        string     `json:"status"`
+	ChallengeType string     `json:"challengeType,omitempty"`
+	Seconds       float64    `json:"seconds"`
+
+	// Whether the authorization was already valid, so no challenge was attempted.
+	Reused bool `json:"reused,omitempty"`
+
+	// Expiry of the authorization when it was fetched, before any challenge was solved. Servers usually extend the
+	// expiry of an authorization once it is valid.
+	Expires time.Time `json:"expires"`
+
+	// Details of how the server validated the challenge, if provided.
+	ValidationRecord []ValidationRecord `json:"validationRecord,omitempty"`
+
+	// The time the server validated the challenge, if provided.
+	Validated time.Time `json:"validated"`
+
+	// Each change of challenge status observed while waiting for validation.
+	StatusHistory []ObservedStatus `json:"statusHistory,omitempty"`
+}
+
+// ReportCertificate summarises a certificate in an issued chain.
+type ReportCertificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+
+	// Hex encoded SHA-256 digest of the DER encoded certificate.
+	SHA256 string `json:"sha256"`
+}
+
+// Collects a Report during issuance. Safe for concurrent use.
+type reportRecorder struct {
+	lock   sync.Mutex
+	report Report
+}
+
+func newReportRecorder(identifiers []Identifier, md Metadata) *reportRecorder {
+	return &reportRecorder{
+		report: Report{
+			Identifiers: identifiers,
+			Started:     time.Now(),
+			Metadata:    md,
+		},
+	}
+}
+
+// Starts timing a phase, returning a function to be called when the phase ends.
+func (rr *reportRecorder) phase(name string) func() {
+	started := time.Now()
+	return func() {
+		rr.lock.Lock()
+		defer rr.lock.Unlock()
+		rr.report.Phases = append(rr.report.Phases, ReportPhase{
+			Name:    name,
+			Started: started,
+			Seconds: time.Since(started).Seconds(),
+		})
+	}
+}
+
+func (rr *reportRecorder) addAuthorization(ra ReportAuthorization) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	rr.report.Authorizations = append(rr.report.Authorizations, ra)
+}
+
+// Records any request ids of a response, used as a Client onResponse callback.
+func (rr *reportRecorder) response(resp *http.Response) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	for _, h := range requestIDHeaders {
+		if id := resp.Header.Get(h); id != "" {
+			rr.report.RequestIDs = append(rr.report.RequestIDs, id)
+		}
+	}
+}
+
+// Completes the report with the outcome of issuance.
+func (rr *reportRecorder) finish(result IssueResult, err error) Report {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	r := rr.report
+	r.OrderURL = result.Order.URL
+	r.Seconds = time.Since(r.Started).Seconds()
+	for _, cert := range result.Certificates {
+		r.Chain = append(r.Chain, reportCertificate(cert))
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+// Helper function to summarise a certificate for a report.
+func reportCertificate(cert *x509.Certificate) ReportCertificate {
+	sum := sha256.Sum256(cert.Raw)
+	return ReportCertificate{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		SHA256:       hex.EncodeToString(sum[:]),
+	}
+}
@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReportRecorder(t *testing.T) {
+	ids := []Identifier{{Type: "dns", Value: "example.com"}}
+	rec := newReportRecorder(ids, Metadata{"tenant": "example"})
+
+	done := rec.phase("order")
+	done()
+	rec.addAuthorization(ReportAuthorization{URL: "https://example.com/authz", ChallengeType: ChallengeTypeDNS01})
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("X-Request-Id", "abc123")
+	rec.response(resp)
+	rec.response(&http.Response{Header: http.Header{}})
+
+	cert, _ := makeSelfSigned(t, "example.com")
+	result := IssueResult{
+		Order:        Order{URL: "https://example.com/order"},
+		Certificates: []*x509.Certificate{cert},
+	}
+	report := rec.finish(result, errors.New("failed"))
+
+	if len(report.Phases) != 1 || report.Phases[0].Name != "order" {
+		t.Errorf("unexpected phases: %+v", report.Phases)
+	}
+	if len(report.Authorizations) != 1 {
+		t.Errorf("unexpected authorizations: %+v", report.Authorizations)
+	}
+	if len(report.RequestIDs) != 1 || report.RequestIDs[0] != "abc123" {
+		t.Errorf("unexpected request ids: %v", report.RequestIDs)
+	}
+	if report.OrderURL != result.Order.URL {
+		t.Errorf("expected order url %s, got: %s", result.Order.URL, report.OrderURL)
+	}
+	if report.Metadata["tenant"] != "example" {
+		t.Errorf("unexpected metadata: %v", report.Metadata)
+	}
+	if report.Error != "failed" {
+		t.Errorf("expected error, got: %q", report.Error)
+	}
+	if len(report.Chain) != 1 || len(report.Chain[0].SHA256) != 64 || report.Chain[0].SerialNumber == "" {
+		t.Errorf("unexpected chain: %+v", report.Chain)
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("error encoding report: %v", err)
+	}
+}
@@ -0,0 +1,406 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRevocationUnknown is returned by RevocationChecker.Check when the revocation status of a certificate could not
+// be determined, eg because it has no CRL distribution points and no OCSP check is configured.
+var ErrRevocationUnknown = errors.New("acme: revocation status unknown")
+
+// Object identifier of the CRL entry reason code extension.
+// See https://tools.ietf.org/html/rfc5280#section-5.3.1
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// RevocationStatus is the revocation status of a certificate, as returned by RevocationChecker.Check.
+type RevocationStatus struct {
+	Revoked bool
+
+	// The time the certificate was revoked and the revocation reason code, eg ReasonKeyCompromise, if revoked.
+	RevokedAt time.Time
+	Reason    int
+
+	// Where the status was found, either "ocsp" or the url of the CRL.
+	Source string
+}
+
+// RevocationChecker checks whether a certificate has been revoked, eg out of band by the CA or by the holder of the
+// certificate key, so that it can be reissued immediately rather than at its usual renewal time.
+// The CRLs listed in the CRL distribution points of a certificate are fetched, verified against the issuer and cached
+// until their next update, and the status of each certificate is cached, with failures cached for a short time so an
+// unavailable CRL isn't fetched on every check. An OCSP check can also be provided, in which case a certificate is
+// considered revoked if either source says so.
+// The zero value is usable. A RevocationChecker is safe for concurrent use and must not be copied after first use.
+type RevocationChecker struct {
+	// Http client used to fetch CRLs.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// OCSP optionally checks the revocation status of a certificate with the OCSP responder of its issuer,
+	// eg using golang.org/x/crypto/ocsp. An error is treated as unknown status, and CRLs are still consulted.
+	OCSP func(ctx context.Context, cert, issuer *x509.Certificate) (RevocationStatus, error)
+
+	// Maximum amount of time a CRL or the revocation status of a certificate is cached, as some CRLs have a next update
+	// time far in the future.
+	// Default 1 hour if duration is not set or if set to 0.
+	MaxCacheAge time.Duration
+
+	// Maximum amount of time a check may take, including the OCSP check and fetching CRLs.
+	// Default 10 seconds if duration is not set or if set to 0.
+	Timeout time.Duration
+
+	lock     sync.Mutex
+	crls     map[string]*cachedCRL
+	statuses map[string]*cachedStatus
+	calls    map[string]*revocationCall
+}
+
+// Amount of time a failure to determine the revocation status of a certificate, or to fetch a CRL, is cached so it
+// isn't retried on every check.
+const revocationFailureCacheAge = 5 * time.Minute
+
+// A fetched and verified CRL, or the error fetching it.
+type cachedCRL struct {
+	expires time.Time
+	revoked map[string]pkix.RevokedCertificate
+	err     error
+}
+
+// The revocation status of a certificate, or the error checking it.
+type cachedStatus struct {
+	expires time.Time
+	status  RevocationStatus
+	err     error
+}
+
+// An in flight check or CRL fetch, shared by concurrent callers.
+type revocationCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Check returns the revocation status of a certificate issued by issuer.
+// Returns ErrRevocationUnknown if no source could provide a status.
+// The status is cached, as are failures for a short time, and concurrent checks of the same certificate share a single
+// check.
+func (rc *RevocationChecker) Check(ctx context.Context, cert, issuer *x509.Certificate) (RevocationStatus, error) {
+	if cert == nil || issuer == nil {
+		return RevocationStatus{}, errors.New("acme: revocation check requires a certificate and its issuer")
+	}
+
+	key := CertificateFingerprint(issuer) + "/" + cert.SerialNumber.String()
+	rc.lock.Lock()
+	cached, ok := rc.statuses[key]
+	rc.lock.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.status, cached.err
+	}
+
+	timeout := rc.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	v, err := rc.do(ctx, "status/"+key, func() (interface{}, error) {
+		status, err := rc.check(ctx, cert, issuer)
+		if ctx.Err() == nil || err == nil {
+			expires := time.Now().Add(rc.maxCacheAge())
+			if err != nil {
+				expires = time.Now().Add(revocationFailureCacheAge)
+			}
+			rc.lock.Lock()
+			if rc.statuses == nil {
+				rc.statuses = map[string]*cachedStatus{}
+			}
+			rc.statuses[key] = &cachedStatus{expires: expires, status: status, err: err}
+			rc.lock.Unlock()
+		}
+		return status, err
+	})
+	status, _ := v.(RevocationStatus)
+	return status, err
+}
+
+// Helper function to get the last revocation status of a certificate without checking it, eg during a tls handshake,
+// returning false if it is not known. If there is no current status, a check is started in the background, so the
+// status is known on a later call.
+func (rc *RevocationChecker) cached(cert, issuer *x509.Certificate) (RevocationStatus, bool) {
+	key := CertificateFingerprint(issuer) + "/" + cert.SerialNumber.String()
+	rc.lock.Lock()
+	cached, ok := rc.statuses[key]
+	_, checking := rc.calls["status/"+key]
+	rc.lock.Unlock()
+
+	if (!ok || !time.Now().Before(cached.expires)) && !checking {
+		go func() {
+			_, _ = rc.Check(context.Background(), cert, issuer)
+		}()
+	}
+	if !ok || cached.err != nil {
+		return RevocationStatus{}, false
+	}
+	return cached.status, true
+}
+
+// Helper function to check the revocation status of a certificate with each source.
+func (rc *RevocationChecker) check(ctx context.Context, cert, issuer *x509.Certificate) (RevocationStatus, error) {
+	var errs []string
+	known := false
+
+	if rc.OCSP != nil {
+		status, err := rc.OCSP(ctx, cert, issuer)
+		if err != nil {
+			errs = append(errs, "ocsp: "+err.Error())
+		} else if status.Revoked {
+			if status.Source == "" {
+				status.Source = "ocsp"
+			}
+			return status, nil
+		} else {
+			known = true
+		}
+	}
+
+	for _, crlURL := range cert.CRLDistributionPoints {
+		if !strings.HasPrefix(crlURL, "http://") && !strings.HasPrefix(crlURL, "https://") {
+			continue
+		}
+		crl, err := rc.crl(ctx, crlURL, issuer)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		known = true
+		if entry, ok := crl.revoked[cert.SerialNumber.String()]; ok {
+			return RevocationStatus{
+				Revoked:   true,
+				RevokedAt: entry.RevocationTime,
+				Reason:    revocationReason(entry),
+				Source:    crlURL,
+			}, nil
+		}
+	}
+
+	if !known {
+		if len(errs) > 0 {
+			return RevocationStatus{}, fmt.Errorf("%v: %s", ErrRevocationUnknown, strings.Join(errs, "; "))
+		}
+		return RevocationStatus{}, ErrRevocationUnknown
+	}
+
+	return RevocationStatus{}, nil
+}
+
+// Helper function to get a CRL from the cache, fetching it if missing or expired. Failed fetches are cached for a
+// short time.
+func (rc *RevocationChecker) crl(ctx context.Context, crlURL string, issuer *x509.Certificate) (*cachedCRL, error) {
+	key := CertificateFingerprint(issuer) + "/" + crlURL
+	rc.lock.Lock()
+	cached, ok := rc.crls[key]
+	rc.lock.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached, cached.err
+	}
+
+	v, err := rc.do(ctx, "crl/"+key, func() (interface{}, error) {
+		cached, err := rc.fetchCRL(ctx, crlURL, issuer)
+		if err != nil {
+			if ctx.Err() != nil {
+				// the check timed out or was cancelled, so the crl may be fine
+				return nil, err
+			}
+			cached = &cachedCRL{expires: time.Now().Add(revocationFailureCacheAge), err: err}
+		}
+		rc.lock.Lock()
+		if rc.crls == nil {
+			rc.crls = map[string]*cachedCRL{}
+		}
+		rc.crls[key] = cached
+		rc.lock.Unlock()
+		return cached, err
+	})
+	cached, _ = v.(*cachedCRL)
+	return cached, err
+}
+
+// Helper function to call fn once for concurrent callers with the same key, sharing its result. Callers waiting on
+// another call return early if their context is done.
+func (rc *RevocationChecker) do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	rc.lock.Lock()
+	if call, ok := rc.calls[key]; ok {
+		rc.lock.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &revocationCall{done: make(chan struct{})}
+	if rc.calls == nil {
+		rc.calls = map[string]*revocationCall{}
+	}
+	rc.calls[key] = call
+	rc.lock.Unlock()
+
+	call.value, call.err = fn()
+
+	rc.lock.Lock()
+	delete(rc.calls, key)
+	rc.lock.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// Helper function to get the maximum cache age of CRLs and statuses, default 1 hour.
+func (rc *RevocationChecker) maxCacheAge() time.Duration {
+	if rc.MaxCacheAge == 0 {
+		return time.Hour
+	}
+	return rc.MaxCacheAge
+}
+
+// Helper function to fetch, parse and verify a CRL.
+func (rc *RevocationChecker) fetchCRL(ctx context.Context, crlURL string, issuer *x509.Certificate) (*cachedCRL, error) {
+	req, err := http.NewRequest(http.MethodGet, crlURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error creating crl request %s: %v", crlURL, err)
+	}
+
+	httpClient := rc.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("acme: error fetching crl %s: %v", crlURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("acme: error fetching crl %s: unexpected status %s", crlURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error reading crl %s: %v", crlURL, err)
+	}
+
+	crl, err := parseCRL(body)
+	if err != nil {
+		return nil, fmt.Errorf("acme: error parsing crl %s: %v", crlURL, err)
+	}
+	if err := crl.checkSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("acme: error verifying crl %s: %v", crlURL, err)
+	}
+
+	now := time.Now()
+	if next := crl.TBSCertList.NextUpdate; !next.IsZero() && next.Before(now) {
+		return nil, fmt.Errorf("acme: crl %s expired at %s", crlURL, next.Format(time.RFC3339))
+	}
+
+	expires := now.Add(rc.maxCacheAge())
+	if next := crl.TBSCertList.NextUpdate; !next.IsZero() && next.Before(expires) {
+		expires = next
+	}
+
+	cached := &cachedCRL{
+		expires: expires,
+		revoked: map[string]pkix.RevokedCertificate{},
+	}
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		cached.revoked[entry.SerialNumber.String()] = entry
+	}
+
+	return cached, nil
+}
+
+// The asn.1 structure of a CRL, see https://tools.ietf.org/html/rfc5280#section-5.1
+// Parsed here as x509.ParseCRL is deprecated, and its replacement x509.ParseRevocationList doesn't exist before
+// go 1.19.
+type certificateList struct {
+	TBSCertList        tbsCertificateList
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateList struct {
+	Raw                 asn1.RawContent
+	Version             int `asn1:"optional,default:0"`
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time                 `asn1:"optional"`
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
+// Signature algorithms of CRLs and OCSP responses, by object identifier.
+var signatureAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	algo x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+}
+
+// Helper function to parse a der encoded CRL.
+func parseCRL(der []byte) (*certificateList, error) {
+	crl := &certificateList{}
+	rest, err := asn1.Unmarshal(der, crl)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after crl")
+	}
+	return crl, nil
+}
+
+// Helper function to check the signature of a CRL is from issuer.
+func (crl *certificateList) checkSignatureFrom(issuer *x509.Certificate) error {
+	return checkSignature(issuer, crl.SignatureAlgorithm, crl.TBSCertList.Raw, crl.SignatureValue.RightAlign())
+}
+
+// Helper function to check signature is a signature of signed by cert, with the given signature algorithm.
+func checkSignature(cert *x509.Certificate, algorithm pkix.AlgorithmIdentifier, signed, signature []byte) error {
+	for _, sa := range signatureAlgorithms {
+		if sa.oid.Equal(algorithm.Algorithm) {
+			return cert.CheckSignature(sa.algo, signed, signature)
+		}
+	}
+	return fmt.Errorf("unsupported signature algorithm %v", algorithm.Algorithm)
+}
+
+// Helper function to get the reason code of a CRL entry, ReasonUnspecified if none is provided.
+func revocationReason(entry pkix.RevokedCertificate) int {
+	for _, ext := range entry.Extensions {
+		if !ext.Id.Equal(oidExtensionReasonCode) {
+			continue
+		}
+		var reason asn1.Enumerated
+		if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil {
+			return int(reason)
+		}
+	}
+	return ReasonUnspecified
+}
@@ -0,0 +1,264 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRevocationChecker_Check(t *testing.T) {
+	ca, caKey := makeSelfSigned(t, "ca.example.com")
+
+	reasonExt, err := asn1.Marshal(asn1.Enumerated(ReasonKeyCompromise))
+	if err != nil {
+		t.Fatalf("error marshalling reason: %v", err)
+	}
+	revokedAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	crl, err := ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{{
+		SerialNumber:   big.NewInt(2),
+		RevocationTime: revokedAt,
+		Extensions:     []pkix.Extension{{Id: oidExtensionReasonCode, Value: reasonExt}},
+	}}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating crl: %v", err)
+	}
+
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = w.Write(crl)
+	}))
+	defer ts.Close()
+
+	makeLeaf := func(serial int64, crlURLs ...string) *x509.Certificate {
+		key := makePrivateKey(t)
+		tpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "leaf.example.com"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			CRLDistributionPoints: crlURLs,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, ca, key.Public(), caKey)
+		if err != nil {
+			t.Fatalf("error creating certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("error parsing certificate: %v", err)
+		}
+		return cert
+	}
+
+	rc := &RevocationChecker{}
+
+	status, err := rc.Check(context.Background(), makeLeaf(1, ts.URL), ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Revoked {
+		t.Fatalf("expected certificate not revoked, got: %+v", status)
+	}
+
+	status, err = rc.Check(context.Background(), makeLeaf(2, ts.URL), ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Revoked || status.Reason != ReasonKeyCompromise || !status.RevokedAt.Equal(revokedAt) || status.Source != ts.URL {
+		t.Fatalf("unexpected revocation status: %+v", status)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("expected crl to be fetched once, got: %d", n)
+	}
+
+	// crl signed by another issuer
+	other, _ := makeSelfSigned(t, "other.example.com")
+	if _, err := (&RevocationChecker{}).Check(context.Background(), makeLeaf(2, ts.URL), other); err == nil || !strings.HasPrefix(err.Error(), ErrRevocationUnknown.Error()) {
+		t.Fatalf("expected unknown revocation status, got: %v", err)
+	}
+
+	if _, err := rc.Check(context.Background(), makeLeaf(3), ca); err != ErrRevocationUnknown {
+		t.Fatalf("expected unknown revocation status, got: %v", err)
+	}
+
+	// ocsp revoked takes precedence, with new checkers as statuses are cached
+	rc = &RevocationChecker{}
+	rc.OCSP = func(ctx context.Context, cert, issuer *x509.Certificate) (RevocationStatus, error) {
+		return RevocationStatus{Revoked: true, Reason: ReasonSuperseded}, nil
+	}
+	status, err = rc.Check(context.Background(), makeLeaf(3), ca)
+	if err != nil || !status.Revoked || status.Source != "ocsp" {
+		t.Fatalf("unexpected ocsp revocation status: %+v, %v", status, err)
+	}
+
+	// ocsp errors fall back to crls
+	rc = &RevocationChecker{}
+	rc.OCSP = func(ctx context.Context, cert, issuer *x509.Certificate) (RevocationStatus, error) {
+		return RevocationStatus{}, errors.New("responder unavailable")
+	}
+	status, err = rc.Check(context.Background(), makeLeaf(2, ts.URL), ca)
+	if err != nil || !status.Revoked {
+		t.Fatalf("expected revoked status from crl, got: %+v, %v", status, err)
+	}
+}
+
+func TestRevocationChecker_cache(t *testing.T) {
+	ca, caKey := makeSelfSigned(t, "ca.example.com")
+	crl, err := ca.CreateCRL(rand.Reader, caKey, nil, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating crl: %v", err)
+	}
+
+	var fetches, failures int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			_, _ = w.Write(crl)
+		case "/hang":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		default:
+			atomic.AddInt32(&failures, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	makeLeaf := func(serial int64, crlURL string) *x509.Certificate {
+		tpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "leaf.example.com"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			CRLDistributionPoints: []string{crlURL},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, ca, makePrivateKey(t).Public(), caKey)
+		if err != nil {
+			t.Fatalf("error creating certificate: %v", err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return cert
+	}
+
+	// concurrent checks share a single fetch, and the status is cached
+	rc := &RevocationChecker{}
+	leaf := makeLeaf(1, ts.URL+"/slow")
+	errs := make(chan error, 5)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := rc.Check(context.Background(), leaf, ca)
+			errs <- err
+		}()
+	}
+	for start := time.Now(); atomic.LoadInt32(&fetches) == 0 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	release <- struct{}{}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := rc.Check(context.Background(), leaf, ca); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("expected crl to be fetched once, got: %d", n)
+	}
+
+	// failures are cached too
+	failing := makeLeaf(2, ts.URL+"/fail")
+	for i := 0; i < 2; i++ {
+		if _, err := rc.Check(context.Background(), failing, ca); err == nil {
+			t.Fatal("expected error checking with unavailable crl, got none")
+		}
+	}
+	if n := atomic.LoadInt32(&failures); n != 1 {
+		t.Fatalf("expected failed crl fetch to be cached, got: %d fetches", n)
+	}
+
+	// a hung crl server doesn't block the check
+	rc = &RevocationChecker{Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if _, err := rc.Check(context.Background(), makeLeaf(3, ts.URL+"/hang"), ca); err == nil {
+		t.Fatal("expected error checking with hung crl server, got none")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected check to time out, took: %v", elapsed)
+	}
+}
+
+func TestAutoCert_RevocationChecker(t *testing.T) {
+	release := make(chan struct{})
+	var checks int32
+	m := &AutoCert{
+		DevMode:   true,
+		HostCheck: WhitelistHosts("localhost"),
+		RevocationChecker: &RevocationChecker{
+			OCSP: func(ctx context.Context, cert, issuer *x509.Certificate) (RevocationStatus, error) {
+				atomic.AddInt32(&checks, 1)
+				<-release
+				return RevocationStatus{Revoked: true}, nil
+			},
+		},
+	}
+	hello := &tls.ClientHelloInfo{ServerName: "localhost"}
+
+	first, err := m.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("unexpected error getting certificate: %v", err)
+	}
+
+	// the revocation check doesn't block the handshake
+	done := make(chan *tls.Certificate)
+	go func() {
+		cert, _ := m.GetCertificate(hello)
+		done <- cert
+	}()
+	select {
+	case cert := <-done:
+		if cert == nil || !cert.Leaf.Equal(first.Leaf) {
+			t.Fatal("expected existing certificate while revocation is checked")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected handshake not to wait for the revocation check")
+	}
+
+	// once the check finds the certificate revoked a new one is issued
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := m.GetCertificate(hello)
+		if err != nil {
+			t.Fatalf("unexpected error getting certificate: %v", err)
+		}
+		if !cert.Leaf.Equal(first.Leaf) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected revoked certificate to be replaced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&checks); n != 1 {
+		t.Fatalf("expected a single revocation check of the first certificate, got: %d", n)
+	}
+}
@@ -0,0 +1,344 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SelfCheck performs local checks that a challenge response can be reached in a similar way to how an acme server
+// would attempt to validate it. This allows a client to detect problems before asking the server to validate a
+// challenge, which would otherwise count towards failed validation limits.
+//
+// LocalAddr and PreferIPv6 only apply to the connections made by the self check. The challenge responder, such as
+// AutoCert.HTTPHandler, is served from a listener owned by the caller, so it is up to the caller to listen on the
+// addresses the acme server will connect to, eg ":80" to accept both IPv4 and IPv6 connections on a dual-stack host.
+type SelfCheck struct {
+	// LocalAddr is the source address used for outgoing http and dns connections.
+	// If nil, the operating system chooses the source address.
+	LocalAddr net.IP
+
+	// PreferIPv6 attempts to connect over IPv6 first when a host has both AAAA and A records, falling back to IPv4 on
+	// failure. This mirrors the behaviour of the Let's Encrypt validation servers on dual-stack hosts.
+	PreferIPv6 bool
+
+	// Nameserver is the "host:port" address of a dns server used for lookups.
+	// If empty, the system configured nameservers are used.
+	Nameserver string
+
+	// The amount of time a single check may take.
+	// Default 10 seconds if duration is not set or if set to 0.
+	Timeout time.Duration
+}
+
+// Check performs a self check of the given challenge for an authorization, dispatching on the challenge type.
+// Only http-01 and dns-01 challenges are supported.
+func (sc SelfCheck) Check(auth Authorization, chal Challenge) error {
+	switch chal.Type {
+	case ChallengeTypeHTTP01:
+		return sc.CheckHTTP01(auth.Identifier.Value, chal)
+	case ChallengeTypeDNS01:
+		return sc.CheckDNS01(auth.Identifier.Value, chal)
+	default:
+		return fmt.Errorf("acme: self check unsupported for challenge type: %s", chal.Type)
+	}
+}
+
+// CheckHTTP01 fetches the http-01 challenge token from the domain and compares it to the challenge key authorization.
+func (sc SelfCheck) CheckHTTP01(domain string, chal Challenge) error {
+	return sc.checkHTTP01URL(http01TokenURL(domain, chal.Token), chal.KeyAuthorization)
+}
+
+// Helper function to build the url an acme server fetches a http-01 challenge token from.
+// IPv6 identifiers are enclosed in brackets so they aren't confused with a port.
+func http01TokenURL(domain, token string) string {
+	host := domain
+	if ip := net.ParseIP(domain); ip != nil && ip.To4() == nil {
+		host = "[" + domain + "]"
+	}
+	return "http://" + host + "/.well-known/acme-challenge/" + token
+}
+
+func (sc SelfCheck) checkHTTP01URL(tokenURL, keyAuth string) error {
+	httpClient := &http.Client{
+		Timeout: sc.getTimeout(),
+		// a new transport is created for each check, so don't keep idle connections open afterwards
+		Transport: &http.Transport{
+			DialContext:       sc.dialContext,
+			DisableKeepAlives: true,
+		},
+	}
+
+	resp, err := httpClient.Get(tokenURL)
+	if err != nil {
+		return fmt.Errorf("acme: self check error fetching %s: %v", tokenURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("acme: self check unexpected status fetching %s: %s", tokenURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return fmt.Errorf("acme: self check error reading %s: %v", tokenURL, err)
+	}
+
+	if got := strings.TrimSpace(string(body)); got != keyAuth {
+		return fmt.Errorf("acme: self check key authorization mismatch at %s, expected %q got %q", tokenURL, keyAuth, got)
+	}
+
+	return nil
+}
+
+// CheckDNS01 looks up the _acme-challenge TXT record for the domain and checks it contains the encoded challenge
+// key authorization.
+func (sc SelfCheck) CheckDNS01(domain string, chal Challenge) error {
+	host := "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+	expected := EncodeDNS01KeyAuthorization(chal.KeyAuthorization)
+
+	ctx, cancel := context.WithTimeout(context.Background(), sc.getTimeout())
+	defer cancel()
+
+	records, err := sc.resolver().LookupTXT(ctx, host)
+	if err != nil {
+		return fmt.Errorf("acme: self check error looking up TXT %s: %v", host, err)
+	}
+
+	for _, r := range records {
+		if r == expected {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("acme: self check TXT %s does not contain %q, found: %v", host, expected, records)
+}
+
+func (sc SelfCheck) getTimeout() time.Duration {
+	if sc.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return sc.Timeout
+}
+
+// Helper function to create a resolver which uses the configured source address and nameserver.
+func (sc SelfCheck) resolver() *net.Resolver {
+	if sc.LocalAddr == nil && sc.Nameserver == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			if sc.LocalAddr != nil {
+				if strings.HasPrefix(network, "tcp") {
+					d.LocalAddr = &net.TCPAddr{IP: sc.LocalAddr}
+				} else {
+					d.LocalAddr = &net.UDPAddr{IP: sc.LocalAddr}
+				}
+			}
+			if sc.Nameserver != "" {
+				address = sc.Nameserver
+			}
+			return d.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// Helper function to dial a host, binding to the configured source address and ordering addresses by the preferred
+// address family.
+func (sc SelfCheck) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &net.Dialer{}
+	if sc.LocalAddr != nil {
+		d.LocalAddr = &net.TCPAddr{IP: sc.LocalAddr}
+	}
+
+	addrs, err := sc.resolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := sortIPAddrs(addrs, sc.PreferIPv6, sc.LocalAddr)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("acme: no usable addresses for host %s", host)
+	}
+
+	lastErr := errors.New("acme: no addresses dialed")
+	for _, ip := range ips {
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Orders addresses by address family, IPv6 first if preferred, otherwise IPv4 first.
+// If a local address is provided, only addresses of the same family are returned.
+func sortIPAddrs(addrs []net.IPAddr, preferIPv6 bool, localAddr net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a.IP)
+		} else {
+			v6 = append(v6, a.IP)
+		}
+	}
+
+	if localAddr != nil {
+		if localAddr.To4() != nil {
+			return v4
+		}
+		return v6
+	}
+
+	if preferIPv6 {
+		return append(v6, v4...)
+	}
+	return append(v4, v6...)
+}
+
+// Maximum number of redirects followed when validating a http-01 challenge, as per Let's Encrypt.
+const http01MaxRedirects = 10
+
+// HTTP01Hop is a single request made while auditing a http-01 challenge.
+type HTTP01Hop struct {
+	URL        string
+	StatusCode int
+	Location   string
+	Error      string
+}
+
+// HTTP01Audit is the result of AuditHTTP01.
+type HTTP01Audit struct {
+	// Each request made, in order
+	Hops []HTTP01Hop
+
+	// The trimmed response body of the final request
+	Body string
+
+	// Reasons why validation would fail, empty if no problems were found
+	Problems []string
+}
+
+// OK returns whether no problems were found by the audit.
+func (a HTTP01Audit) OK() bool {
+	return len(a.Problems) == 0
+}
+
+// AuditHTTP01 simulates how the Let's Encrypt validation servers fetch a http-01 challenge token from a domain and
+// reports each request made and why validation would fail. This can be used to debug CDN or redirect setups before
+// attempting validation.
+//
+// As per Let's Encrypt, the initial request is made to port 80, up to 10 redirects are followed, redirects must be to
+// http or https urls on ports 80 or 443, must not be to an IP address, and https certificates are not verified.
+// If the challenge has a key authorization, the final response body is compared against it.
+func (sc SelfCheck) AuditHTTP01(domain string, chal Challenge) HTTP01Audit {
+	return sc.auditHTTP01URL(http01TokenURL(domain, chal.Token), chal.KeyAuthorization)
+}
+
+func (sc SelfCheck) auditHTTP01URL(tokenURL, keyAuth string) HTTP01Audit {
+	audit := HTTP01Audit{}
+
+	httpClient := &http.Client{
+		Timeout: sc.getTimeout(),
+		Transport: &http.Transport{
+			DialContext:       sc.dialContext,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	current, err := url.Parse(tokenURL)
+	if err != nil {
+		audit.Problems = append(audit.Problems, fmt.Sprintf("invalid url %q: %v", tokenURL, err))
+		return audit
+	}
+
+	for {
+		hop := HTTP01Hop{URL: current.String()}
+
+		resp, err := httpClient.Get(current.String())
+		if err != nil {
+			hop.Error = err.Error()
+			audit.Hops = append(audit.Hops, hop)
+			audit.Problems = append(audit.Problems, fmt.Sprintf("error fetching %s: %v", current, err))
+			return audit
+		}
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		hop.StatusCode = resp.StatusCode
+		hop.Location = resp.Header.Get("Location")
+		audit.Hops = append(audit.Hops, hop)
+
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || hop.Location == "" {
+			audit.Body = strings.TrimSpace(string(body))
+			break
+		}
+
+		if len(audit.Hops) > http01MaxRedirects {
+			audit.Problems = append(audit.Problems, fmt.Sprintf("too many redirects, more than %d", http01MaxRedirects))
+			return audit
+		}
+
+		next, err := current.Parse(hop.Location)
+		if err != nil {
+			audit.Problems = append(audit.Problems, fmt.Sprintf("invalid redirect location %q: %v", hop.Location, err))
+			return audit
+		}
+		if err := checkHTTP01Redirect(next); err != nil {
+			audit.Problems = append(audit.Problems, err.Error())
+			return audit
+		}
+		current = next
+	}
+
+	if last := audit.Hops[len(audit.Hops)-1]; last.StatusCode != http.StatusOK {
+		audit.Problems = append(audit.Problems, fmt.Sprintf("unexpected status code %d fetching %s", last.StatusCode, last.URL))
+	} else if keyAuth != "" && audit.Body != keyAuth {
+		audit.Problems = append(audit.Problems, fmt.Sprintf("key authorization mismatch, expected %q got %q", keyAuth, audit.Body))
+	}
+
+	return audit
+}
+
+// Helper function to check a http-01 redirect target would be followed by an acme server.
+func checkHTTP01Redirect(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("redirect to %s has invalid scheme, only http and https are allowed", u)
+	}
+
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return fmt.Errorf("redirect to %s has invalid port, only 80 and 443 are allowed", u)
+	}
+
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return fmt.Errorf("redirect to %s is to an IP address, only domain names are allowed", u)
+	}
+	if !strings.Contains(strings.TrimSuffix(host, "."), ".") {
+		return fmt.Errorf("redirect to %s is not to a fully qualified domain name", u)
+	}
+
+	return nil
+}
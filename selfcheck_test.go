@@ -0,0 +1,220 @@
+package acme
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelfCheck_checkHTTP01URL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/acme-challenge/token" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("token.thumbprint\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		keyAuth  string
+		errorStr string
+	}{
+		{
+			name:    "ok",
+			url:     srv.URL + "/.well-known/acme-challenge/token",
+			keyAuth: "token.thumbprint",
+		},
+		{
+			name:     "mismatch",
+			url:      srv.URL + "/.well-known/acme-challenge/token",
+			keyAuth:  "token.other",
+			errorStr: "mismatch",
+		},
+		{
+			name:     "not found",
+			url:      srv.URL + "/.well-known/acme-challenge/missing",
+			keyAuth:  "token.thumbprint",
+			errorStr: "unexpected status",
+		},
+	}
+
+	for _, sc := range []SelfCheck{{}, {PreferIPv6: true}, {LocalAddr: net.ParseIP("127.0.0.1")}} {
+		for i, ct := range tests {
+			err := sc.checkHTTP01URL(ct.url, ct.keyAuth)
+			if ct.errorStr == "" && err != nil {
+				t.Errorf("self check test %d %q expected no error, got: %v", i, ct.name, err)
+			}
+			if ct.errorStr != "" && (err == nil || !strings.Contains(err.Error(), ct.errorStr)) {
+				t.Errorf("self check test %d %q expected error containing %q, got: %v", i, ct.name, ct.errorStr, err)
+			}
+		}
+	}
+}
+
+func TestSelfCheck_Check(t *testing.T) {
+	sc := SelfCheck{}
+	if err := sc.Check(Authorization{}, Challenge{Type: ChallengeTypeTLSALPN01}); err == nil {
+		t.Fatal("expected error, got none")
+	}
+}
+
+func Test_sortIPAddrs(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.1")
+	v6 := net.ParseIP("2001:db8::1")
+	addrs := []net.IPAddr{{IP: v4}, {IP: v6}}
+
+	tests := []struct {
+		name       string
+		preferIPv6 bool
+		localAddr  net.IP
+		expected   []net.IP
+	}{
+		{
+			name:     "ipv4 first",
+			expected: []net.IP{v4, v6},
+		},
+		{
+			name:       "ipv6 first",
+			preferIPv6: true,
+			expected:   []net.IP{v6, v4},
+		},
+		{
+			name:       "ipv4 local address",
+			preferIPv6: true,
+			localAddr:  net.ParseIP("192.0.2.100"),
+			expected:   []net.IP{v4},
+		},
+		{
+			name:      "ipv6 local address",
+			localAddr: net.ParseIP("2001:db8::100"),
+			expected:  []net.IP{v6},
+		},
+	}
+
+	for _, ct := range tests {
+		got := sortIPAddrs(addrs, ct.preferIPv6, ct.localAddr)
+		if !reflect.DeepEqual(got, ct.expected) {
+			t.Errorf("%s: expected %v, got %v", ct.name, ct.expected, got)
+		}
+	}
+}
+
+func TestSelfCheck_auditHTTP01URL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/acme-challenge/ok":
+			_, _ = w.Write([]byte("ok.thumbprint"))
+		case "/.well-known/acme-challenge/badport":
+			http.Redirect(w, r, "http://example.com:8080/", http.StatusFound)
+		case "/.well-known/acme-challenge/iplit":
+			http.Redirect(w, r, "https://192.0.2.1/", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		keyAuth  string
+		hops     int
+		problem  string
+		expectOK bool
+	}{
+		{
+			name:     "ok",
+			token:    "ok",
+			keyAuth:  "ok.thumbprint",
+			hops:     1,
+			expectOK: true,
+		},
+		{
+			name:    "mismatch",
+			token:   "ok",
+			keyAuth: "ok.other",
+			hops:    1,
+			problem: "mismatch",
+		},
+		{
+			name:    "not found",
+			token:   "missing",
+			hops:    1,
+			problem: "status code 404",
+		},
+		{
+			name:    "bad port",
+			token:   "badport",
+			hops:    1,
+			problem: "invalid port",
+		},
+		{
+			name:    "ip literal",
+			token:   "iplit",
+			hops:    1,
+			problem: "IP address",
+		},
+	}
+
+	sc := SelfCheck{}
+	for i, ct := range tests {
+		audit := sc.auditHTTP01URL(srv.URL+"/.well-known/acme-challenge/"+ct.token, ct.keyAuth)
+		if audit.OK() != ct.expectOK {
+			t.Errorf("audit test %d %q expected ok %t, got problems: %v", i, ct.name, ct.expectOK, audit.Problems)
+		}
+		if len(audit.Hops) != ct.hops {
+			t.Errorf("audit test %d %q expected %d hops, got: %+v", i, ct.name, ct.hops, audit.Hops)
+		}
+		if ct.problem != "" && (len(audit.Problems) == 0 || !strings.Contains(audit.Problems[0], ct.problem)) {
+			t.Errorf("audit test %d %q expected problem containing %q, got: %v", i, ct.name, ct.problem, audit.Problems)
+		}
+	}
+}
+
+func Test_checkHTTP01Redirect(t *testing.T) {
+	tests := map[string]bool{
+		"http://example.com/path":      true,
+		"https://example.com:443/path": true,
+		"http://example.com:80/path":   true,
+		"ftp://example.com/path":       false,
+		"http://example.com:8080/path": false,
+		"http://192.0.2.1/path":        false,
+		"http://[2001:db8::1]/path":    false,
+		"http://localhost/path":        false,
+	}
+
+	for u, ok := range tests {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			t.Fatalf("error parsing %s: %v", u, err)
+		}
+		if err := checkHTTP01Redirect(parsed); (err == nil) != ok {
+			t.Errorf("redirect to %s expected ok %t, got: %v", u, ok, err)
+		}
+	}
+}
+
+func Test_http01TokenURL(t *testing.T) {
+	tests := map[string]string{
+		"example.com": "http://example.com/.well-known/acme-challenge/token",
+		"192.0.2.1":   "http://192.0.2.1/.well-known/acme-challenge/token",
+		"2001:db8::1": "http://[2001:db8::1]/.well-known/acme-challenge/token",
+	}
+
+	for domain, expected := range tests {
+		got := http01TokenURL(domain, "token")
+		if got != expected {
+			t.Errorf("token url for %s expected %s, got: %s", domain, expected, got)
+		}
+		if _, err := url.Parse(got); err != nil {
+			t.Errorf("token url for %s is invalid: %v", domain, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrStoreNotFound is returned by a Store when no data exists for a given key.
+var ErrStoreNotFound = errors.New("acme: store key not found")
+
+// ErrStoreExists is returned by an AtomicStore when creating a key which already exists.
+var ErrStoreExists = errors.New("acme: store key already exists")
+
+// Store is implemented by types which persist acme state such as accounts, orders and certificates.
+// Keys are slash separated paths, eg "accounts/example".
+type Store interface {
+	// Get returns the data stored for a key, or ErrStoreNotFound if no data exists.
+	Get(key string) ([]byte, error)
+
+	// Put stores data for a key, overwriting any existing data.
+	Put(key string, data []byte) error
+
+	// Delete removes the data for a key. Deleting a key which does not exist is not an error.
+	Delete(key string) error
+}
+
+// AtomicStore is implemented by stores which can create a key only if it does not already exist, so that processes
+// sharing the store can coordinate, eg when creating an account, see Client.GetOrCreateAccount.
+type AtomicStore interface {
+	Store
+
+	// Create stores data for a key, or returns ErrStoreExists if data already exists for the key.
+	Create(key string, data []byte) error
+}
+
+// MemoryStore is a Store which keeps all data in memory. The zero value is ready to use.
+type MemoryStore struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+// Get implements Store.Get
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	b, ok := s.data[key]
+	if !ok {
+		return nil, ErrStoreNotFound
+	}
+
+	return append([]byte(nil), b...), nil
+}
+
+// Put implements Store.Put
+func (s *MemoryStore) Put(key string, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.data == nil {
+		s.data = map[string][]byte{}
+	}
+	s.data[key] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// Create implements AtomicStore.Create
+func (s *MemoryStore) Create(key string, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.data[key]; ok {
+		return ErrStoreExists
+	}
+	if s.data == nil {
+		s.data = map[string][]byte{}
+	}
+	s.data[key] = append([]byte(nil), data...)
+
+	return nil
+}
+
+// Delete implements Store.Delete
+func (s *MemoryStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.data, key)
+
+	return nil
+}
+
+// DirStore is a Store which keeps each key as a file underneath a directory.
+type DirStore string
+
+// Helper function to convert a key to a file path, refusing keys which would escape the directory.
+func (s DirStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("acme: invalid store key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("acme: invalid store key %q", key)
+		}
+	}
+	return filepath.Join(string(s), filepath.FromSlash(key)), nil
+}
+
+// Get implements Store.Get
+func (s DirStore) Get(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrStoreNotFound
+	}
+
+	return b, err
+}
+
+// Put implements Store.Put
+// Data is written to a temporary file first and renamed so a partially written file is never read.
+func (s DirStore) Put(key string, data []byte) error {
+	p, tmp, err := s.writeTemp(key, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return os.Rename(tmp, p)
+}
+
+// Create implements AtomicStore.Create
+// Data is written to a temporary file first and hard linked in to place, which fails if the file already exists.
+func (s DirStore) Create(key string, data []byte) error {
+	p, tmp, err := s.writeTemp(key, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := os.Link(tmp, p); err != nil {
+		if os.IsExist(err) {
+			return ErrStoreExists
+		}
+		return fmt.Errorf("acme: error creating store file: %v", err)
+	}
+
+	return nil
+}
+
+// Helper function to write data for a key to a temporary file in the same directory, returning the path of the key
+// and the temporary file.
+func (s DirStore) writeTemp(key string, data []byte) (string, string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", "", fmt.Errorf("acme: error creating store directory: %v", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return "", "", fmt.Errorf("acme: error creating store file: %v", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", "", fmt.Errorf("acme: error writing store file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", "", fmt.Errorf("acme: error writing store file: %v", err)
+	}
+
+	return p, f.Name(), nil
+}
+
+// Delete implements Store.Delete
+func (s DirStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
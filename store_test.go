@@ -0,0 +1,75 @@
+package acme
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testStore(t *testing.T, s Store) {
+	if _, err := s.Get("missing/key"); err != ErrStoreNotFound {
+		t.Fatalf("expected ErrStoreNotFound, got: %v", err)
+	}
+
+	data := []byte{1, 2, 3}
+	if err := s.Put("some/key", data); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	b, err := s.Get("some/key")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(data, b) {
+		t.Fatalf("expected: %+v, got: %+v", data, b)
+	}
+
+	if err := s.Delete("some/key"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := s.Get("some/key"); err != ErrStoreNotFound {
+		t.Fatalf("expected ErrStoreNotFound after delete, got: %v", err)
+	}
+	if err := s.Delete("some/key"); err != nil {
+		t.Fatalf("expected no error deleting missing key, got: %v", err)
+	}
+
+	as, ok := s.(AtomicStore)
+	if !ok {
+		return
+	}
+	if err := as.Create("some/key", data); err != nil {
+		t.Fatalf("expected no error creating, got: %v", err)
+	}
+	if err := as.Create("some/key", []byte{4, 5, 6}); err != ErrStoreExists {
+		t.Fatalf("expected ErrStoreExists, got: %v", err)
+	}
+	b, err = s.Get("some/key")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(data, b) {
+		t.Fatalf("expected created data to be kept: %+v, got: %+v", data, b)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, &MemoryStore{})
+}
+
+func TestDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme-store")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testStore(t, DirStore(dir))
+
+	for _, key := range []string{"", "/abs", "../escape", "a//b", "a/./b"} {
+		if err := DirStore(dir).Put(key, nil); err == nil {
+			t.Errorf("expected error for key %q, got none", key)
+		}
+	}
+}
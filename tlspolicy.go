@@ -0,0 +1,269 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// TLSPolicy describes the tls settings used for connections to the acme server, eg to satisfy a corporate outbound
+// tls policy, set with WithTLSPolicy.
+type TLSPolicy struct {
+	// Minimum tls version to connect with, eg tls.VersionTLS13 (0x0304).
+	// Default tls.VersionTLS12 if not set.
+	MinVersion uint16
+
+	// Cipher suites permitted for tls 1.2 and earlier connections, eg tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384.
+	// Tls 1.3 cipher suites are not configurable. Default go's cipher suites if not set.
+	CipherSuites []uint16
+
+	// Whether the acme server must staple a valid ocsp response for its own certificate. Responses from servers which
+	// don't are rejected with an error, as are stapled responses which aren't signed by the issuer of the server's
+	// certificate (or a responder it delegated to), are for another certificate, have expired, or don't report the
+	// certificate as good.
+	RequireOCSPStapling bool
+}
+
+// The value of tls.VersionTLS13, which doesn't exist before go 1.12.
+const versionTLS13 = 0x0304
+
+// Helper function to check a tls policy is valid.
+func (p TLSPolicy) validate() error {
+	switch p.MinVersion {
+	case 0, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, versionTLS13:
+	default:
+		return fmt.Errorf("unknown tls version: 0x%04x", p.MinVersion)
+	}
+	if p.MinVersion == versionTLS13 && len(p.CipherSuites) > 0 {
+		return errors.New("cipher suites are not configurable for tls 1.3")
+	}
+	return nil
+}
+
+// Helper function to apply a tls policy to a copy of an http client, with a copy of its transport with an updated tls
+// client config, or a new transport if the client uses the default transport. The http client and its transport are
+// left unchanged, as they may be shared.
+func (p TLSPolicy) apply(httpClient *http.Client) (*http.Client, error) {
+	var tr *http.Transport
+	switch t := httpClient.Transport.(type) {
+	case nil:
+		// mirrors the settings of http.DefaultTransport
+		tr = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+	case *http.Transport:
+		tr = copyTransport(t)
+	default:
+		return nil, fmt.Errorf("unsupported http client transport %T", httpClient.Transport)
+	}
+
+	config := tr.TLSClientConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.MinVersion = p.MinVersion
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if len(p.CipherSuites) > 0 {
+		config.CipherSuites = append([]uint16(nil), p.CipherSuites...)
+	}
+	tr.TLSClientConfig = config
+
+	c := *httpClient
+	c.Transport = tr
+	return &c, nil
+}
+
+// Helper function to copy the settings of a transport, without its idle connections and internal state.
+// Transport.Clone doesn't exist before go 1.13.
+func copyTransport(t *http.Transport) *http.Transport {
+	return &http.Transport{
+		Proxy:                  t.Proxy,
+		DialContext:            t.DialContext,
+		Dial:                   t.Dial,
+		DialTLS:                t.DialTLS,
+		TLSClientConfig:        t.TLSClientConfig,
+		TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+		DisableKeepAlives:      t.DisableKeepAlives,
+		DisableCompression:     t.DisableCompression,
+		MaxIdleConns:           t.MaxIdleConns,
+		MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:        t.MaxConnsPerHost,
+		IdleConnTimeout:        t.IdleConnTimeout,
+		ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  t.ExpectContinueTimeout,
+		TLSNextProto:           t.TLSNextProto,
+		ProxyConnectHeader:     t.ProxyConnectHeader,
+		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+	}
+}
+
+// Helper function to check a response meets the ocsp stapling requirement of a client, if any.
+func (c Client) checkStapling(resp *http.Response) error {
+	if !c.requireStapling {
+		return nil
+	}
+	if resp.TLS == nil {
+		return fmt.Errorf("acme: tls policy requires ocsp stapling, but %s is not a tls connection", resp.Request.URL.Host)
+	}
+	if len(resp.TLS.OCSPResponse) == 0 {
+		return fmt.Errorf("acme: tls policy requires ocsp stapling, but %s did not staple an ocsp response", resp.Request.URL.Host)
+	}
+
+	chain := resp.TLS.PeerCertificates
+	if len(resp.TLS.VerifiedChains) > 0 {
+		chain = resp.TLS.VerifiedChains[0]
+	}
+	if len(chain) < 2 {
+		return fmt.Errorf("acme: tls policy requires ocsp stapling, but %s did not provide an issuer to verify the ocsp response", resp.Request.URL.Host)
+	}
+	if err := verifyOCSPStaple(resp.TLS.OCSPResponse, chain[0], chain[1], time.Now()); err != nil {
+		return fmt.Errorf("acme: tls policy requires ocsp stapling, but %s stapled an invalid ocsp response: %v", resp.Request.URL.Host, err)
+	}
+	return nil
+}
+
+// Object identifier of the basic ocsp response type, id-pkix-ocsp-basic.
+var oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// The ocsp response status of a successful response.
+const ocspStatusSuccessful = 0
+
+// How far the validity period of a stapled ocsp response may be from the local clock.
+const ocspClockSkew = 5 * time.Minute
+
+// The asn.1 structure of an OCSP response, see https://tools.ietf.org/html/rfc6960#section-4.2.1
+// Parsed here as golang.org/x/crypto/ocsp isn't a dependency.
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// Helper function to check a der encoded OCSP response is signed by issuer, or a responder delegated by issuer, and
+// reports cert as good at the time now.
+func verifyOCSPStaple(der []byte, cert, issuer *x509.Certificate, now time.Time) error {
+	resp := ocspResponse{}
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New("trailing data after ocsp response")
+	}
+	if resp.Status != ocspStatusSuccessful {
+		return fmt.Errorf("unsuccessful ocsp response status %d", resp.Status)
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidOCSPBasic) {
+		return fmt.Errorf("unsupported ocsp response type %v", resp.ResponseBytes.ResponseType)
+	}
+
+	basic := ocspBasicResponse{}
+	if rest, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New("trailing data after basic ocsp response")
+	}
+
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return fmt.Errorf("error parsing ocsp responder certificate: %v", err)
+		}
+		if !bytes.Equal(responder.Raw, issuer.Raw) {
+			if err := responder.CheckSignatureFrom(issuer); err != nil {
+				return fmt.Errorf("ocsp responder certificate not issued by issuer: %v", err)
+			}
+			if !hasExtKeyUsage(responder, x509.ExtKeyUsageOCSPSigning) {
+				return errors.New("ocsp responder certificate not authorized for ocsp signing")
+			}
+		}
+		signer = responder
+	}
+	if err := checkSignature(signer, basic.SignatureAlgorithm, basic.TBSResponseData.Raw, basic.Signature.RightAlign()); err != nil {
+		return fmt.Errorf("error verifying ocsp response signature: %v", err)
+	}
+
+	for _, r := range basic.TBSResponseData.Responses {
+		if r.CertID.SerialNumber == nil || r.CertID.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		switch {
+		case bool(r.Good):
+		case bool(r.Unknown):
+			return errors.New("ocsp response reports certificate status unknown")
+		default:
+			return fmt.Errorf("ocsp response reports certificate revoked at %s", r.Revoked.RevocationTime.Format(time.RFC3339))
+		}
+		if r.ThisUpdate.After(now.Add(ocspClockSkew)) {
+			return fmt.Errorf("ocsp response not valid until %s", r.ThisUpdate.Format(time.RFC3339))
+		}
+		if !r.NextUpdate.IsZero() && r.NextUpdate.Before(now.Add(-ocspClockSkew)) {
+			return fmt.Errorf("ocsp response expired at %s", r.NextUpdate.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("ocsp response does not include certificate serial %s", cert.SerialNumber)
+}
+
+// Helper function to check whether a certificate has an extended key usage.
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestWithTLSPolicy(t *testing.T) {
+	acmeClient := Client{httpClient: &http.Client{}}
+	if err := WithTLSPolicy(TLSPolicy{MinVersion: 0x0999})(&acmeClient); err == nil {
+		t.Fatal("expected error for unknown tls version, got none")
+	}
+	if err := WithTLSPolicy(TLSPolicy{MinVersion: versionTLS13, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}})(&acmeClient); err == nil {
+		t.Fatal("expected error for tls 1.3 cipher suites, got none")
+	}
+
+	if err := WithTLSPolicy(TLSPolicy{RequireOCSPStapling: true})(&acmeClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr := acmeClient.httpClient.Transport.(*http.Transport)
+	if tr.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("expected default minimum version tls 1.2, got: 0x%04x", tr.TLSClientConfig.MinVersion)
+	}
+	if tr.Proxy == nil {
+		t.Fatal("expected created transport to use proxy from environment")
+	}
+	if !acmeClient.requireStapling {
+		t.Fatal("ocsp stapling requirement not set")
+	}
+
+	// existing transport settings are kept
+	if err := WithInsecureSkipVerify()(&acmeClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	suites := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	if err := WithTLSPolicy(TLSPolicy{MinVersion: tls.VersionTLS12, CipherSuites: suites})(&acmeClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr = acmeClient.httpClient.Transport.(*http.Transport)
+	if !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("expected existing tls client config to be kept")
+	}
+	if !reflect.DeepEqual(tr.TLSClientConfig.CipherSuites, suites) {
+		t.Fatalf("expected cipher suites %v, got: %v", suites, tr.TLSClientConfig.CipherSuites)
+	}
+
+	// the http client and transport passed in are not changed
+	userTransport := &http.Transport{TLSClientConfig: &tls.Config{ServerName: "acme.example.com"}}
+	userClient := &http.Client{Transport: userTransport}
+	acmeClient.httpClient = userClient
+	if err := WithTLSPolicy(TLSPolicy{MinVersion: versionTLS13})(&acmeClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if acmeClient.httpClient == userClient || userClient.Transport != userTransport || userTransport.TLSClientConfig.MinVersion != 0 {
+		t.Fatal("expected http client passed in to be unchanged")
+	}
+	tr = acmeClient.httpClient.Transport.(*http.Transport)
+	if tr.TLSClientConfig.MinVersion != versionTLS13 || tr.TLSClientConfig.ServerName != "acme.example.com" {
+		t.Fatalf("expected copied transport with policy applied, got: %+v", tr.TLSClientConfig)
+	}
+
+	acmeClient.httpClient.Transport = roundTripperFunc(http.DefaultTransport.RoundTrip)
+	if err := WithTLSPolicy(TLSPolicy{})(&acmeClient); err == nil {
+		t.Fatal("expected error for unsupported transport, got none")
+	}
+}
+
+// Helper function to create a der encoded ocsp response for cert with the given status, signed by signerKey and
+// including any responder certificates.
+func makeOCSPStaple(t *testing.T, cert *x509.Certificate, signerKey crypto.Signer, status string, nextUpdate time.Time, responderCerts ...*x509.Certificate) []byte {
+	keyHash, err := asn1.Marshal([]byte("key hash"))
+	if err != nil {
+		t.Fatalf("error marshalling responder id: %v", err)
+	}
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}},
+			IssuerNameHash: []byte("name hash"),
+			IssuerKeyHash:  []byte("key hash"),
+			SerialNumber:   cert.SerialNumber,
+		},
+		ThisUpdate: time.Now().Add(-time.Hour).UTC().Truncate(time.Second),
+		NextUpdate: nextUpdate.UTC().Truncate(time.Second),
+	}
+	switch status {
+	case "good":
+		single.Good = true
+	case "revoked":
+		single.Revoked.RevocationTime = time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	default:
+		single.Unknown = true
+	}
+	tbs, err := asn1.Marshal(ocspResponseData{
+		RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyHash},
+		ProducedAt:     time.Now().UTC().Truncate(time.Second),
+		Responses:      []ocspSingleResponse{single},
+	})
+	if err != nil {
+		t.Fatalf("error marshalling ocsp response data: %v", err)
+	}
+
+	digest := sha256.Sum256(tbs)
+	signature, err := signerKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("error signing ocsp response: %v", err)
+	}
+	basic := ocspBasicResponse{
+		TBSResponseData:    ocspResponseData{Raw: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	}
+	for _, c := range responderCerts {
+		basic.Certificates = append(basic.Certificates, asn1.RawValue{FullBytes: c.Raw})
+	}
+	basicDER, err := asn1.Marshal(basic)
+	if err != nil {
+		t.Fatalf("error marshalling basic ocsp response: %v", err)
+	}
+
+	der, err := asn1.Marshal(ocspResponse{
+		Status:        ocspStatusSuccessful,
+		ResponseBytes: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basicDER},
+	})
+	if err != nil {
+		t.Fatalf("error marshalling ocsp response: %v", err)
+	}
+	return der
+}
+
+func Test_verifyOCSPStaple(t *testing.T) {
+	ca, caKey := makeSelfSigned(t, "ca.example.test")
+	leaf, _ := makeIssued(t, ca, caKey, "leaf.example.test", false)
+	other, otherKey := makeSelfSigned(t, "other.example.test")
+
+	// a server certificate, not authorized for ocsp signing
+	responder, responderKey := makeIssued(t, ca, caKey, "ocsp.example.test", false)
+
+	delegatedKey := makePrivateKey(t)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "ocsp.example.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, ca, delegatedKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	delegatedCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+
+	nextUpdate := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		staple   []byte
+		errorStr string
+	}{
+		{
+			name:   "good",
+			staple: makeOCSPStaple(t, leaf, caKey, "good", nextUpdate),
+		},
+		{
+			name:   "delegated responder",
+			staple: makeOCSPStaple(t, leaf, delegatedKey, "good", nextUpdate, delegatedCert),
+		},
+		{
+			name:     "revoked",
+			staple:   makeOCSPStaple(t, leaf, caKey, "revoked", nextUpdate),
+			errorStr: "revoked",
+		},
+		{
+			name:     "unknown",
+			staple:   makeOCSPStaple(t, leaf, caKey, "unknown", nextUpdate),
+			errorStr: "unknown",
+		},
+		{
+			name:     "expired",
+			staple:   makeOCSPStaple(t, leaf, caKey, "good", time.Now().Add(-time.Hour)),
+			errorStr: "expired",
+		},
+		{
+			name:     "wrong signer",
+			staple:   makeOCSPStaple(t, leaf, otherKey, "good", nextUpdate),
+			errorStr: "signature",
+		},
+		{
+			name:     "responder not issued by issuer",
+			staple:   makeOCSPStaple(t, leaf, otherKey, "good", nextUpdate, other),
+			errorStr: "not issued by issuer",
+		},
+		{
+			name:     "responder not authorized",
+			staple:   makeOCSPStaple(t, leaf, responderKey, "good", nextUpdate, responder),
+			errorStr: "not authorized",
+		},
+		{
+			name:     "other certificate",
+			staple:   makeOCSPStaple(t, ca, caKey, "good", nextUpdate),
+			errorStr: "does not include",
+		},
+		{
+			name:     "garbage",
+			staple:   []byte("staple"),
+			errorStr: "asn1",
+		},
+	}
+
+	for i, ct := range tests {
+		err := verifyOCSPStaple(ct.staple, leaf, ca, time.Now())
+		if ct.errorStr == "" && err != nil {
+			t.Errorf("ocsp staple test %d %q expected no error, got: %v", i, ct.name, err)
+		}
+		if ct.errorStr != "" && (err == nil || !strings.Contains(err.Error(), ct.errorStr)) {
+			t.Errorf("ocsp staple test %d %q expected error containing %q, got: %v", i, ct.name, ct.errorStr, err)
+		}
+	}
+}
+
+func TestClient_TLSPolicy(t *testing.T) {
+	ca, caKey := makeSelfSigned(t, "ca.example.test")
+	leaf, leafKey := makeIssued(t, ca, caKey, "acme.example.test", false)
+
+	var srv *httptest.Server
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", randString())
+		_, _ = w.Write([]byte(`{"newNonce":"` + srv.URL + `/nonce"}`))
+	}))
+	srv.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, ca.Raw}, PrivateKey: leafKey}},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	newHTTPClient := func() *http.Client {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "acme.example.test"}}}
+	}
+
+	if _, err := NewClient(srv.URL, WithHTTPClient(newHTTPClient()), WithTLSPolicy(TLSPolicy{MinVersion: versionTLS13})); err == nil {
+		t.Fatal("expected error connecting to tls 1.2 server with minimum version tls 1.3, got none")
+	}
+
+	stapling := WithTLSPolicy(TLSPolicy{RequireOCSPStapling: true})
+	if _, err := NewClient(srv.URL, WithHTTPClient(newHTTPClient()), stapling); err == nil || !strings.Contains(err.Error(), "did not staple") {
+		t.Fatalf("expected ocsp stapling error, got: %v", err)
+	}
+
+	srv.TLS.Certificates[0].OCSPStaple = []byte("staple")
+	if _, err := NewClient(srv.URL, WithHTTPClient(newHTTPClient()), stapling); err == nil || !strings.Contains(err.Error(), "invalid ocsp response") {
+		t.Fatalf("expected invalid ocsp response error, got: %v", err)
+	}
+
+	srv.TLS.Certificates[0].OCSPStaple = makeOCSPStaple(t, leaf, caKey, "revoked", time.Now().Add(time.Hour))
+	if _, err := NewClient(srv.URL, WithHTTPClient(newHTTPClient()), stapling); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Fatalf("expected revoked ocsp response error, got: %v", err)
+	}
+
+	srv.TLS.Certificates[0].OCSPStaple = makeOCSPStaple(t, leaf, caKey, "good", time.Now().Add(time.Hour))
+	if _, err := NewClient(srv.URL, WithHTTPClient(newHTTPClient()), stapling); err != nil {
+		t.Fatalf("unexpected error with stapled response: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestInfo describes a single http request made by a Client, passed to the hook set with WithRequestHook.
+// Timings are zero if that step didn't occur, eg the dns lookup, connection and tls handshake when a connection is
+// reused.
+type RequestInfo struct {
+	Method string
+	URL    string
+
+	// Name of the endpoint the request was made to, as used by WithRateLimits, eg EndpointNewOrder.
+	Endpoint string
+
+	// Status code of the response, or 0 if the request failed.
+	StatusCode int
+
+	// Error sending the request, if any. Error responses from the server are not included.
+	Error error
+
+	// Total time from sending the request until the response headers were received.
+	Duration time.Duration
+
+	// Time taken to resolve the host, connect, complete the tls handshake, and receive the first response byte
+	// after the request was written.
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	ServerWait   time.Duration
+
+	// Whether an existing connection was reused.
+	ReusedConnection bool
+
+	// Values of any Server-Timing http headers in the response, describing time spent by the server.
+	// See https://www.w3.org/TR/server-timing/
+	ServerTiming []string
+
+	// Metadata of the client or issuance flow which made the request, see Client.WithMetadata.
+	Metadata Metadata
+}
+
+// Collects timings of a request with httptrace.
+// Guarded by a lock, as callbacks may be called concurrently, eg when dialling several addresses at once, and after
+// the response is received.
+type requestTrace struct {
+	lock sync.Mutex
+	info RequestInfo
+
+	start, dnsStart, tlsStart, wrote time.Time
+
+	// Start of each dial by address, as several may be in progress at once.
+	connectStarts map[string]time.Time
+}
+
+// Helper function to start tracing a request, returning the request with the trace attached.
+func newRequestTrace(req *http.Request, endpoint string, md Metadata) (*http.Request, *requestTrace) {
+	rt := &requestTrace{
+		info: RequestInfo{
+			Method:   req.Method,
+			URL:      req.URL.String(),
+			Endpoint: endpoint,
+			Metadata: md,
+		},
+		start:         time.Now(),
+		connectStarts: map[string]time.Time{},
+	}
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			rt.update(func() { rt.info.ReusedConnection = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			rt.update(func() { rt.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			rt.update(func() { rt.info.DNS = time.Since(rt.dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			rt.update(func() { rt.connectStarts[network+"/"+addr] = time.Now() })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			rt.update(func() {
+				// only the dial which succeeded is used
+				if start, ok := rt.connectStarts[network+"/"+addr]; ok && err == nil {
+					rt.info.Connect = time.Since(start)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			rt.update(func() { rt.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			rt.update(func() { rt.info.TLSHandshake = time.Since(rt.tlsStart) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			rt.update(func() { rt.wrote = time.Now() })
+		},
+		GotFirstResponseByte: func() {
+			rt.update(func() {
+				if !rt.wrote.IsZero() {
+					rt.info.ServerWait = time.Since(rt.wrote)
+				}
+			})
+		},
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), rt
+}
+
+// Helper function to update a trace with the lock held.
+func (rt *requestTrace) update(f func()) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	f()
+}
+
+// Helper function to complete the trace of a request once the response, or error, is received.
+// Returns a copy of the info, so callbacks after the response is received don't change it.
+func (rt *requestTrace) finish(resp *http.Response, err error) RequestInfo {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	rt.info.Duration = time.Since(rt.start)
+	rt.info.Error = err
+	if resp != nil {
+		rt.info.StatusCode = resp.StatusCode
+		rt.info.ServerTiming = resp.Header["Server-Timing"]
+	}
+	return rt.info
+}
@@ -0,0 +1,90 @@
+package acme
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+)
+
+func TestWithRequestHook(t *testing.T) {
+	if err := WithRequestHook(nil)(&Client{}); err == nil {
+		t.Fatal("expected error, got none")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server-Timing", "db;dur=53")
+		_, _ = w.Write([]byte(`{"newNonce":"nonce-url"}`))
+	}))
+	defer srv.Close()
+
+	var infos []RequestInfo
+	if _, err := NewClient(srv.URL, WithRequestHook(func(info RequestInfo) {
+		infos = append(infos, info)
+	})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 request, got: %d", len(infos))
+	}
+	info := infos[0]
+	if info.Method != http.MethodGet || info.URL != srv.URL || info.Endpoint != EndpointDirectory {
+		t.Errorf("unexpected request: %+v", info)
+	}
+	if info.StatusCode != http.StatusOK || info.Error != nil {
+		t.Errorf("unexpected response: %d %v", info.StatusCode, info.Error)
+	}
+	if info.Duration <= 0 || info.Connect <= 0 || info.ReusedConnection {
+		t.Errorf("unexpected timings: %+v", info)
+	}
+	if len(info.ServerTiming) != 1 || info.ServerTiming[0] != "db;dur=53" {
+		t.Errorf("unexpected server timing: %v", info.ServerTiming)
+	}
+}
+
+func TestWithRequestHook_error(t *testing.T) {
+	var infos []RequestInfo
+	if _, err := NewClient("http://127.0.0.1:1/dir", WithRequestHook(func(info RequestInfo) {
+		infos = append(infos, info)
+	})); err == nil {
+		t.Fatal("expected error, got none")
+	}
+	if len(infos) != 1 || infos[0].Error == nil || infos[0].StatusCode != 0 {
+		t.Fatalf("expected failed request info, got: %+v", infos)
+	}
+}
+
+func TestRequestTrace_concurrent(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, rt := newRequestTrace(req, "", nil)
+	trace := httptrace.ContextClientTrace(req.Context())
+
+	// dual stack dials happen concurrently, and callbacks may fire after the response is received
+	var wg sync.WaitGroup
+	for _, addr := range []string{"[::1]:443", "127.0.0.1:443"} {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			trace.ConnectStart("tcp", addr)
+			var err error
+			if addr == "[::1]:443" {
+				err = errors.New("connection refused")
+			}
+			trace.ConnectDone("tcp", addr, err)
+			trace.GotConn(httptrace.GotConnInfo{})
+			trace.WroteRequest(httptrace.WroteRequestInfo{})
+		}(addr)
+	}
+	info := rt.finish(nil, nil)
+	wg.Wait()
+
+	if info.Duration <= 0 {
+		t.Fatalf("expected duration, got: %v", info.Duration)
+	}
+}
@@ -3,6 +3,7 @@ package acme
 import (
 	"crypto"
 	"encoding/json"
+	"io"
 	"net/http"
 	"time"
 )
@@ -19,6 +20,15 @@ const (
 	ChallengeTypeTLSSNI01 = "tls-sni-01"
 )
 
+// Different possible identifier types of an order.
+// See https://tools.ietf.org/html/rfc8555#section-9.7.7, https://tools.ietf.org/html/rfc8738 and
+// https://tools.ietf.org/html/rfc8823
+const (
+	IdentifierTypeDNS   = "dns"
+	IdentifierTypeIP    = "ip"
+	IdentifierTypeEmail = "email"
+)
+
 // Constants used for certificate revocation, used for RevokeCertificate
 // See https://tools.ietf.org/html/rfc5280#section-5.3.1
 const (
@@ -45,12 +55,18 @@ type Directory struct {
 	RevokeCert string `json:"revokeCert"` // url to revoke cert endpoint
 	KeyChange  string `json:"keyChange"`  // url to key change endpoint
 
+	// url to renewal info endpoint, see https://datatracker.ietf.org/doc/draft-ietf-acme-ari/
+	RenewalInfo string `json:"renewalInfo,omitempty"`
+
 	// meta object containing directory metadata
 	Meta struct {
 		TermsOfService          string   `json:"termsOfService"`
 		Website                 string   `json:"website"`
 		CaaIdentities           []string `json:"caaIdentities"`
 		ExternalAccountRequired bool     `json:"externalAccountRequired"`
+
+		// Certificate profiles offered by the server, mapping profile names to descriptions.
+		Profiles map[string]string `json:"profiles,omitempty"`
 	} `json:"meta"`
 
 	// Directory url provided when creating a new acme client.
@@ -59,13 +75,45 @@ type Directory struct {
 
 // Client structure to interact with an ACME server.
 // This is typically how most, if not all, of the communication between the client and server occurs.
+//
+// A Client is safe for concurrent use by multiple goroutines, including concurrent requests using the same Account.
+// Copies of a Client share the same directory, nonces, rate limits, http client and calls to GetOrCreateAccount. Options which take functions, eg
+// WithRequestHook and WithJSONCodec, must also be safe for concurrent use if the Client is used concurrently.
 type Client struct {
 	httpClient      *http.Client
 	nonces          *nonceStack
-	dir             Directory
+	dir             *directoryCache
 	userAgentSuffix string
 	acceptLanguage  string
 	retryCount      int
+	limiter         *rateLimiter
+	codec           JSONCodec
+	retryAfterMin   time.Duration
+	retryAfterMax   time.Duration
+	quirks          Quirks
+	metadata        Metadata
+	accounts        *accountFlights
+	rand            io.Reader
+	keyPolicy       KeyPolicy
+	requireStapling bool
+
+	// Called when a request fails as the account must agree to new terms of service.
+	termsAgreement func(accountURL, termsURL string) bool
+
+	// Called when a refreshed directory differs from the previous one, set with WithDirectoryChangeHook.
+	directoryHook func(change DirectoryChange)
+
+	// Called with the identifiers of each new order and pre-authorization, set with WithIdentifierPolicy.
+	identifierPolicy IdentifierPolicy
+
+	// Called after each request with timing information, set with WithRequestHook.
+	requestHook func(info RequestInfo)
+
+	// Called with each response received, used by Issuer to collect request ids for a Report.
+	onResponse func(resp *http.Response)
+
+	// Closed to stop polling early, set by Issuer from its context.
+	done <-chan struct{}
 
 	// The amount of total time the Client will wait at most for a challenge to be updated or a certificate to be issued.
 	// Default 30 seconds if duration is not set or if set to 0.
@@ -79,6 +127,10 @@ type Client struct {
 // Account structure representing fields in an account object.
 // See https://tools.ietf.org/html/rfc8555#section-7.1.2
 // See also https://tools.ietf.org/html/rfc8555#section-9.7.1
+//
+// An Account is a value which is never modified by a Client, methods which update an account return a new Account,
+// so it's safe to use the same Account in concurrent requests provided the PrivateKey is safe for concurrent use, as
+// the standard library RSA and ECDSA keys are.
 type Account struct {
 	Status  string   `json:"status"`
 	Contact []string `json:"contact"`
@@ -98,6 +150,15 @@ type Account struct {
 	// ExternalAccountBinding is populated when using the NewAcctOptExternalAccountBinding option for NewAccountOption
 	// and is otherwise empty. Not populated when account is fetched or created otherwise.
 	ExternalAccountBinding ExternalAccountBinding `json:"-"`
+
+	// CreatedAt is the time the account was created and InitialIP the address it was created from, if provided.
+	// Not defined by RFC8555, but provided by some servers, eg boulder.
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	InitialIP string    `json:"initialIp,omitempty"`
+
+	// StatusHistory is each change of status observed since the account was created or first fetched, eg when it is
+	// deactivated, as returned by methods which update an account. Not fetched from server.
+	StatusHistory []ObservedStatus `json:"-"`
 }
 
 // ExternalAccountBinding holds the key identifier and mac key provided for use in servers that support/require
@@ -135,9 +196,29 @@ type Order struct {
 	Finalize       string       `json:"finalize"`
 	Certificate    string       `json:"certificate"`
 
+	// The ARI unique identifier of the certificate this order replaces, if any.
+	// See https://datatracker.ietf.org/doc/draft-ietf-acme-ari/
+	Replaces string `json:"replaces,omitempty"`
+
+	// The name of the certificate profile requested by the order, if any.
+	// See https://datatracker.ietf.org/doc/draft-aaron-acme-profiles/
+	Profile string `json:"profile,omitempty"`
+
 	// URL for the order object.
 	// Provided by the rel="Location" Link http header
 	URL string `json:"-"`
+
+	// RetryAfter is the time provided by the Retry-After http header when fetching or finalizing the order, if any.
+	// Not fetched from server.
+	RetryAfter time.Time `json:"-"`
+
+	// ReplacesError is populated when the server rejected the replaces field of a new order request, and the order
+	// was then created without it. Not fetched from server.
+	ReplacesError Problem `json:"-"`
+
+	// RejectedError is populated when the server rejected some identifiers of a new order request made with
+	// NewOrderOptDropRejected, and the order was then created without them. Not fetched from server.
+	RejectedError Problem `json:"-"`
 }
 
 // Authorization object returned when fetching an authorization in an order.
@@ -169,8 +250,37 @@ type Challenge struct {
 	Token            string `json:"token"`
 	KeyAuthorization string `json:"keyAuthorization"`
 
+	// Details of how the server validated the challenge, if provided.
+	ValidationRecord []ValidationRecord `json:"validationRecord,omitempty"`
+
 	// Authorization url provided by the rel="up" Link http header
 	AuthorizationURL string `json:"-"`
+
+	// RetryAfter is the time provided by the Retry-After http header when updating or fetching the challenge, if any.
+	RetryAfter time.Time `json:"-"`
+
+	// ValidatedTime is the parsed Validated timestamp, the time the server validated the challenge, if provided.
+	ValidatedTime time.Time `json:"-"`
+
+	// StatusHistory is each change of status observed while updating the challenge, including the status in response
+	// to the update and when polling. Not fetched from server.
+	StatusHistory []ObservedStatus `json:"-"`
+}
+
+// ObservedStatus is a status of a resource, eg a challenge or account, and the time it was first observed.
+type ObservedStatus struct {
+	Status   string    `json:"status"`
+	Observed time.Time `json:"observed"`
+}
+
+// ValidationRecord describes a request made by the server when validating a challenge.
+// Not defined by RFC8555, but provided by boulder and pebble.
+type ValidationRecord struct {
+	URL               string   `json:"url,omitempty"`
+	Hostname          string   `json:"hostname,omitempty"`
+	Port              string   `json:"port,omitempty"`
+	AddressesResolved []string `json:"addressesResolved,omitempty"`
+	AddressUsed       string   `json:"addressUsed,omitempty"`
 }
 
 // OrderList of challenge objects.
@@ -190,3 +300,37 @@ type NewAccountRequest struct {
 	Contact                []string        `json:"contact,omitempty"`
 	ExternalAccountBinding json.RawMessage `json:"externalAccountBinding"`
 }
+
+// NewOrderRequest object used for submitting a request for a new order.
+// Primarily used with NewOrderOptionFunc
+type NewOrderRequest struct {
+	Identifiers []Identifier `json:"identifiers"`
+	Replaces    string       `json:"replaces,omitempty"`
+	Profile     string       `json:"profile,omitempty"`
+
+	// StrictReplaces disables retrying a new order without the replaces field if the server rejects it.
+	StrictReplaces bool `json:"-"`
+
+	// DropRejected retries a new order without any identifiers rejected by the server.
+	DropRejected bool `json:"-"`
+}
+
+// UpdateAccountRequest object used for submitting a request to update an account.
+// Primarily used with UpdateAccountOptionFunc
+type UpdateAccountRequest struct {
+	Contact []string `json:"contact,omitempty"`
+
+	// UpdateContact indicates the contacts of the account are to be replaced with Contact.
+	UpdateContact bool `json:"-"`
+}
+
+// RevokeCertificateRequest object used for submitting a request to revoke a certificate.
+// Primarily used with RevokeCertificateOptionFunc
+type RevokeCertificateRequest struct {
+	Certificate string `json:"certificate"`
+	Reason      int    `json:"reason"`
+
+	// The key used to sign the request, either the account key or the key of the certificate.
+	// Default is the account key.
+	Key crypto.Signer `json:"-"`
+}
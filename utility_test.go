@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/big"
 	mrand "math/rand"
 	"net/http"
 	"os"
@@ -27,6 +28,7 @@ type clientMeta struct {
 const (
 	clientBoulder = "boulder"
 	clientPebble  = "pebble"
+	clientStepCA  = "step-ca"
 )
 
 var (
@@ -66,6 +68,10 @@ func init() {
 		"http://localhost:4001/directory": {
 			Software: clientBoulder,
 		},
+		StepCADirectory("https://localhost:9000", "acme"): {
+			Software: clientStepCA,
+			Options:  []OptionFunc{WithInsecureSkipVerify(), WithQuirks(StepCAQuirks)},
+		},
 	}
 
 	for k, v := range directories {
@@ -234,6 +240,34 @@ func makeCSR(t *testing.T, domains []string) (*x509.CertificateRequest, crypto.S
 	return csr, privKey
 }
 
+func makeSelfSigned(t *testing.T, domains ...string) (*x509.Certificate, crypto.Signer) {
+	privKey := makePrivateKey(t)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(mrand.Int63()),
+		Subject:               pkix.Name{CommonName: domains[0]},
+		DNSNames:              domains,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(crand.Reader, tpl, tpl, privKey.Public(), privKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+
+	return cert, privKey
+}
+
 func doPost(name string, req interface{}) {
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
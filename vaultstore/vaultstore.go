@@ -0,0 +1,197 @@
+// Package vaultstore provides an acme.Store backed by a HashiCorp Vault KV version 2 secrets engine.
+//
+// Requests are made directly to the Vault http api, so no Vault client library is required.
+// See https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2
+package vaultstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+// Store is an acme.Store which keeps each key as a secret in a Vault KV version 2 secrets engine.
+// Data is stored base64 encoded in the "data" field of the secret.
+type Store struct {
+	// Address of the Vault server, eg "https://vault.example.com:8200".
+	Address string
+
+	// Token used to authenticate with Vault.
+	Token string
+
+	// Path the KV secrets engine is mounted at. Default "secret".
+	Mount string
+
+	// Path prefix of all secrets, optional, eg "acme".
+	Prefix string
+
+	// Client used to make requests. Default http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+var _ acme.AtomicStore = Store{}
+
+// Get implements acme.Store.Get
+func (s Store) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, "data", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, acme.ErrStoreNotFound
+	}
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("vaultstore: error parsing secret %q: %v", key, err)
+	}
+
+	// a deleted version of a secret has no data
+	encoded, ok := secret.Data.Data["data"]
+	if !ok {
+		return nil, acme.ErrStoreNotFound
+	}
+
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("vaultstore: error decoding secret %q: %v", key, err)
+	}
+
+	return b, nil
+}
+
+// Put implements acme.Store.Put
+func (s Store) Put(key string, data []byte) error {
+	resp, err := s.write(key, data, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp, http.StatusOK, http.StatusNoContent)
+}
+
+// Create implements acme.AtomicStore.Create
+// The secret is written with a check-and-set version of 0, which vault rejects if the secret already exists.
+func (s Store) Create(key string, data []byte) error {
+	resp, err := s.write(key, data, map[string]interface{}{"cas": 0})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		err := checkResponse(resp)
+		if strings.Contains(err.Error(), "check-and-set") {
+			return acme.ErrStoreExists
+		}
+		return err
+	}
+
+	return checkResponse(resp, http.StatusOK, http.StatusNoContent)
+}
+
+// Delete implements acme.Store.Delete
+// All versions of the secret are removed.
+func (s Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, "metadata", key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
+
+// Helper function to write a new version of a secret with optional write options.
+func (s Store) write(key string, data []byte, options map[string]interface{}) (*http.Response, error) {
+	secret := map[string]interface{}{
+		"data": map[string]string{
+			"data": base64.StdEncoding.EncodeToString(data),
+		},
+	}
+	if options != nil {
+		secret["options"] = options
+	}
+	body, err := json.Marshal(secret)
+	if err != nil {
+		return nil, fmt.Errorf("vaultstore: error encoding secret %q: %v", key, err)
+	}
+
+	return s.do(http.MethodPost, "data", key, bytes.NewReader(body))
+}
+
+// Helper function to make a request to the kv api for a key.
+func (s Store) do(method, api, key string, body io.Reader) (*http.Response, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "..") {
+		return nil, fmt.Errorf("vaultstore: invalid key %q", key)
+	}
+	if s.Address == "" {
+		return nil, errors.New("vaultstore: no address")
+	}
+
+	mount := s.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	path := key
+	if s.Prefix != "" {
+		path = strings.Trim(s.Prefix, "/") + "/" + key
+	}
+	u := strings.TrimSuffix(s.Address, "/") + "/v1/" + strings.Trim(mount, "/") + "/" + api + "/" + path
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("vaultstore: error creating request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vaultstore: error sending request: %v", err)
+	}
+
+	return resp, nil
+}
+
+// Helper function to check a response has an expected status code, otherwise returning the vault errors.
+func checkResponse(resp *http.Response, expectedStatus ...int) error {
+	for _, status := range expectedStatus {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+
+	var vaultErr struct {
+		Errors []string `json:"errors"`
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = json.Unmarshal(body, &vaultErr)
+
+	return fmt.Errorf("vaultstore: unexpected status code %d: %s", resp.StatusCode, strings.Join(vaultErr.Errors, ", "))
+}
@@ -0,0 +1,147 @@
+package vaultstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eggsampler/acme/v3"
+)
+
+// Fake kv version 2 engine mounted at /v1/secret
+func fakeVault(t *testing.T, token string) *httptest.Server {
+	var lock sync.Mutex
+	secrets := map[string]json.RawMessage{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+			path := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+			switch r.Method {
+			case http.MethodGet:
+				data, ok := secrets[path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"errors":[]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"data":` + string(data) + `}`))
+			case http.MethodPost:
+				var body json.RawMessage
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("error decoding body: %v", err)
+				}
+				var options struct {
+					Options struct {
+						CAS *int `json:"cas"`
+					} `json:"options"`
+				}
+				_ = json.Unmarshal(body, &options)
+				if _, ok := secrets[path]; ok && options.Options.CAS != nil && *options.Options.CAS == 0 {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+					return
+				}
+				secrets[path] = body
+				_, _ = w.Write([]byte(`{"data":{"version":1}}`))
+			}
+		case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/") && r.Method == http.MethodDelete:
+			delete(secrets, strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestStore(t *testing.T) {
+	srv := fakeVault(t, "token")
+	defer srv.Close()
+
+	s := Store{Address: srv.URL, Token: "token", Prefix: "acme"}
+
+	if _, err := s.Get("accounts/example"); err != acme.ErrStoreNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+
+	data := []byte{0, 1, 2, 'a', 'b', 'c'}
+	if err := s.Put("accounts/example", data); err != nil {
+		t.Fatalf("unexpected error putting: %v", err)
+	}
+
+	got, err := s.Get("accounts/example")
+	if err != nil {
+		t.Fatalf("unexpected error getting: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("data mismatch, expected: %v, got: %v", data, got)
+	}
+
+	if err := s.Delete("accounts/example"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	if err := s.Delete("accounts/example"); err != nil {
+		t.Fatalf("unexpected error deleting missing key: %v", err)
+	}
+	if _, err := s.Get("accounts/example"); err != acme.ErrStoreNotFound {
+		t.Fatalf("expected not found after delete, got: %v", err)
+	}
+}
+
+func TestStore_Create(t *testing.T) {
+	srv := fakeVault(t, "token")
+	defer srv.Close()
+
+	s := Store{Address: srv.URL, Token: "token"}
+
+	if err := s.Create("accounts/example/key", []byte("first")); err != nil {
+		t.Fatalf("unexpected error creating: %v", err)
+	}
+	if err := s.Create("accounts/example/key", []byte("second")); err != acme.ErrStoreExists {
+		t.Fatalf("expected exists error, got: %v", err)
+	}
+	got, err := s.Get("accounts/example/key")
+	if err != nil {
+		t.Fatalf("unexpected error getting: %v", err)
+	}
+	if string(got) != "first" {
+		t.Fatalf("expected first data to be kept, got: %s", got)
+	}
+
+	if err := (Store{Address: srv.URL, Token: "wrong"}).Create("accounts/other", nil); err == nil || err == acme.ErrStoreExists {
+		t.Fatalf("expected permission error, got: %v", err)
+	}
+}
+
+func TestStore_errors(t *testing.T) {
+	srv := fakeVault(t, "token")
+	defer srv.Close()
+
+	s := Store{Address: srv.URL, Token: "wrong"}
+	if err := s.Put("key", []byte("data")); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected permission error, got: %v", err)
+	}
+
+	for _, key := range []string{"", "/abs", "a/../b"} {
+		if _, err := s.Get(key); err == nil {
+			t.Errorf("expected error for key %q, got none", key)
+		}
+	}
+
+	if _, err := (Store{}).Get("key"); err == nil {
+		t.Error("expected error for no address, got none")
+	}
+}
@@ -0,0 +1,234 @@
+package acme
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Wire representations of the resources returned by an acme server.
+// Responses are decoded into these and validated before being mapped on to the exported types, so that malformed or
+// unexpected values from a server are reported as errors rather than leaking in to the public api.
+
+// Valid statuses of each resource type.
+// See https://tools.ietf.org/html/rfc8555#section-7.1.6
+var (
+	accountStatuses       = []string{"valid", "deactivated", "revoked"}
+	orderStatuses         = []string{"pending", "ready", "processing", "valid", "invalid"}
+	authorizationStatuses = []string{"pending", "valid", "invalid", "deactivated", "expired", "revoked"}
+	challengeStatuses     = []string{"pending", "processing", "valid", "invalid"}
+)
+
+type wireAccount struct {
+	Status    string   `json:"status"`
+	Contact   []string `json:"contact"`
+	Orders    string   `json:"orders"`
+	CreatedAt string   `json:"createdAt"`
+	InitialIP string   `json:"initialIp"`
+}
+
+// Helper function to validate a wire account and update the fields of an account provided by the server.
+func (w wireAccount) apply(account *Account) error {
+	if err := checkStatus("account", w.Status, accountStatuses); err != nil {
+		return err
+	}
+	if err := checkURL("account orders", w.Orders); err != nil {
+		return err
+	}
+	createdAt, err := parseTime("account createdAt", w.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if account.Status != "" && account.Status != w.Status {
+		account.StatusHistory = append(account.StatusHistory, ObservedStatus{Status: w.Status, Observed: time.Now()})
+	}
+	account.Status = w.Status
+	account.Contact = w.Contact
+	account.Orders = w.Orders
+	account.CreatedAt = createdAt
+	account.InitialIP = w.InitialIP
+
+	return nil
+}
+
+type wireOrder struct {
+	Status         string       `json:"status"`
+	Expires        string       `json:"expires"`
+	Identifiers    []Identifier `json:"identifiers"`
+	NotBefore      string       `json:"notBefore"`
+	NotAfter       string       `json:"notAfter"`
+	Error          Problem      `json:"error"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate"`
+	Replaces       string       `json:"replaces"`
+	Profile        string       `json:"profile"`
+}
+
+// Helper function to validate a wire order and update the fields of an order provided by the server.
+func (w wireOrder) apply(order *Order) error {
+	if err := checkStatus("order", w.Status, orderStatuses); err != nil {
+		return err
+	}
+
+	expires, err := parseTime("order expires", w.Expires)
+	if err != nil {
+		return err
+	}
+	notBefore, err := parseTime("order notBefore", w.NotBefore)
+	if err != nil {
+		return err
+	}
+	notAfter, err := parseTime("order notAfter", w.NotAfter)
+	if err != nil {
+		return err
+	}
+
+	if w.Finalize == "" {
+		return fmt.Errorf("acme: order has no finalize url")
+	}
+	if err := checkURL("order finalize", w.Finalize); err != nil {
+		return err
+	}
+	if w.Status == "valid" && w.Certificate == "" {
+		return fmt.Errorf("acme: valid order has no certificate url")
+	}
+	if err := checkURL("order certificate", w.Certificate); err != nil {
+		return err
+	}
+	for _, authURL := range w.Authorizations {
+		if err := checkURL("order authorization", authURL); err != nil {
+			return err
+		}
+	}
+
+	order.Status = w.Status
+	order.Expires = expires
+	order.Identifiers = w.Identifiers
+	order.NotBefore = notBefore
+	order.NotAfter = notAfter
+	order.Error = w.Error
+	order.Authorizations = w.Authorizations
+	order.Finalize = w.Finalize
+	order.Certificate = w.Certificate
+	order.Replaces = w.Replaces
+	order.Profile = w.Profile
+
+	return nil
+}
+
+type wireAuthorization struct {
+	Identifier Identifier      `json:"identifier"`
+	Status     string          `json:"status"`
+	Expires    string          `json:"expires"`
+	Challenges []wireChallenge `json:"challenges"`
+	Wildcard   bool            `json:"wildcard"`
+}
+
+// Helper function to validate a wire authorization and update the fields of an authorization provided by the server.
+func (w wireAuthorization) apply(auth *Authorization) error {
+	if err := checkStatus("authorization", w.Status, authorizationStatuses); err != nil {
+		return err
+	}
+
+	expires, err := parseTime("authorization expires", w.Expires)
+	if err != nil {
+		return err
+	}
+
+	challenges := make([]Challenge, len(w.Challenges))
+	for i, wc := range w.Challenges {
+		if err := wc.apply(&challenges[i]); err != nil {
+			return err
+		}
+	}
+
+	auth.Identifier = w.Identifier
+	auth.Status = w.Status
+	auth.Expires = expires
+	auth.Challenges = challenges
+	auth.Wildcard = w.Wildcard
+
+	return nil
+}
+
+type wireChallenge struct {
+	Type             string  `json:"type"`
+	URL              string  `json:"url"`
+	Status           string  `json:"status"`
+	Validated        string  `json:"validated"`
+	Error            Problem `json:"error"`
+	Token            string  `json:"token"`
+	KeyAuthorization string  `json:"keyAuthorization"`
+
+	ValidationRecord []ValidationRecord `json:"validationRecord"`
+}
+
+// Helper function to validate a wire challenge and update the fields of a challenge provided by the server.
+// The url and key authorization are only updated if provided, as servers may omit them.
+func (w wireChallenge) apply(chal *Challenge) error {
+	if err := checkStatus("challenge", w.Status, challengeStatuses); err != nil {
+		return err
+	}
+	if err := checkURL("challenge", w.URL); err != nil {
+		return err
+	}
+	validated, err := parseTime("challenge validated", w.Validated)
+	if err != nil {
+		return err
+	}
+
+	chal.Type = w.Type
+	chal.Status = w.Status
+	chal.Validated = w.Validated
+	chal.ValidatedTime = validated
+	chal.Error = w.Error
+	chal.Token = w.Token
+	chal.ValidationRecord = w.ValidationRecord
+	if w.URL != "" {
+		chal.URL = w.URL
+	}
+	if w.KeyAuthorization != "" {
+		chal.KeyAuthorization = w.KeyAuthorization
+	}
+
+	return nil
+}
+
+// Helper function to check a status is one of the valid statuses of a resource.
+func checkStatus(resource, status string, valid []string) error {
+	for _, s := range valid {
+		if status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("acme: unknown %s status: %q", resource, status)
+}
+
+// Helper function to check an optional url provided by the server is an absolute http(s) url.
+func checkURL(field, rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("acme: invalid %s url %q: %v", field, rawURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("acme: invalid %s url %q: not an absolute http url", field, rawURL)
+	}
+	return nil
+}
+
+// Helper function to parse an optional RFC3339 timestamp provided by the server.
+func parseTime(field, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("acme: invalid %s time %q: %v", field, value, err)
+	}
+	return t, nil
+}
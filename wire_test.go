@@ -0,0 +1,170 @@
+package acme
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWireOrder_apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		errorStr string
+	}{
+		{
+			name: "valid",
+			json: `{"status":"valid","expires":"2020-01-02T03:04:05Z","finalize":"https://example.com/finalize",
+				"certificate":"https://example.com/cert","authorizations":["https://example.com/authz"]}`,
+		},
+		{
+			name:     "unknown status",
+			json:     `{"status":"done","finalize":"https://example.com/finalize"}`,
+			errorStr: "unknown order status",
+		},
+		{
+			name:     "bad time",
+			json:     `{"status":"pending","expires":"tomorrow","finalize":"https://example.com/finalize"}`,
+			errorStr: "invalid order expires time",
+		},
+		{
+			name:     "no finalize",
+			json:     `{"status":"pending"}`,
+			errorStr: "no finalize url",
+		},
+		{
+			name:     "relative authorization",
+			json:     `{"status":"pending","finalize":"https://example.com/finalize","authorizations":["/authz"]}`,
+			errorStr: "invalid order authorization url",
+		},
+		{
+			name:     "valid without certificate",
+			json:     `{"status":"valid","finalize":"https://example.com/finalize"}`,
+			errorStr: "no certificate url",
+		},
+	}
+
+	for i, ct := range tests {
+		var w wireOrder
+		if err := json.Unmarshal([]byte(ct.json), &w); err != nil {
+			t.Fatalf("wire order test %d %q error parsing json: %v", i, ct.name, err)
+		}
+		order := Order{URL: "https://example.com/order"}
+		err := w.apply(&order)
+		if ct.errorStr == "" && err != nil {
+			t.Errorf("wire order test %d %q expected no error, got: %v", i, ct.name, err)
+		}
+		if ct.errorStr != "" && (err == nil || !strings.Contains(err.Error(), ct.errorStr)) {
+			t.Errorf("wire order test %d %q expected error containing %q, got: %v", i, ct.name, ct.errorStr, err)
+		}
+		if err == nil && order.URL != "https://example.com/order" {
+			t.Errorf("wire order test %d %q expected url to be kept, got: %s", i, ct.name, order.URL)
+		}
+	}
+}
+
+func TestWireOrder_apply_fields(t *testing.T) {
+	w := wireOrder{
+		Status:   "pending",
+		Expires:  "2020-01-02T03:04:05Z",
+		Finalize: "https://example.com/finalize",
+	}
+	order := Order{}
+	if err := w.apply(&order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !order.Expires.Equal(expected) {
+		t.Errorf("expected expires %v, got: %v", expected, order.Expires)
+	}
+	if order.Status != "pending" || order.Finalize != w.Finalize {
+		t.Errorf("unexpected order: %+v", order)
+	}
+}
+
+func TestWireAuthorization_apply(t *testing.T) {
+	w := wireAuthorization{
+		Status: "pending",
+		Challenges: []wireChallenge{
+			{Type: ChallengeTypeDNS01, Status: "pending", URL: "https://example.com/chal", Token: "token"},
+		},
+	}
+	auth := Authorization{}
+	if err := w.apply(&auth); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(auth.Challenges) != 1 || auth.Challenges[0].URL != "https://example.com/chal" {
+		t.Fatalf("unexpected challenges: %+v", auth.Challenges)
+	}
+
+	w.Challenges[0].Status = "unknown"
+	if err := w.apply(&auth); err == nil {
+		t.Fatal("expected error for bad challenge, got none")
+	}
+
+	w.Status = "unknown"
+	if err := w.apply(&auth); err == nil {
+		t.Fatal("expected error for bad status, got none")
+	}
+}
+
+func TestWireChallenge_apply(t *testing.T) {
+	chal := Challenge{URL: "https://example.com/chal", KeyAuthorization: "token.thumbprint"}
+	if err := (wireChallenge{Type: ChallengeTypeHTTP01, Status: "valid"}).apply(&chal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chal.URL != "https://example.com/chal" || chal.KeyAuthorization != "token.thumbprint" {
+		t.Fatalf("expected omitted fields to be kept, got: %+v", chal)
+	}
+
+	if err := (wireChallenge{Status: "valid", URL: "ftp://example.com"}).apply(&chal); err == nil {
+		t.Fatal("expected error for bad url, got none")
+	}
+	if err := (wireChallenge{Status: "valid", Validated: "yesterday"}).apply(&chal); err == nil {
+		t.Fatal("expected error for bad validated time, got none")
+	}
+
+	if err := (wireChallenge{Status: "valid", Validated: "2020-01-02T03:04:05Z"}).apply(&chal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !chal.ValidatedTime.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected validated time: %v", chal.ValidatedTime)
+	}
+}
+
+func TestWireAccount_apply(t *testing.T) {
+	account := Account{URL: "https://example.com/acct"}
+	if err := (wireAccount{Status: "valid", Orders: "https://example.com/orders"}).apply(&account); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if account.URL != "https://example.com/acct" || account.Orders != "https://example.com/orders" {
+		t.Fatalf("unexpected account: %+v", account)
+	}
+	if err := (wireAccount{Status: "pending"}).apply(&account); err == nil {
+		t.Fatal("expected error for bad status, got none")
+	}
+	if err := (wireAccount{Status: "valid", CreatedAt: "last week"}).apply(&account); err == nil {
+		t.Fatal("expected error for bad createdAt time, got none")
+	}
+}
+
+func TestWireAccount_apply_metadata(t *testing.T) {
+	account := Account{}
+	w := wireAccount{Status: "valid", CreatedAt: "2020-01-02T03:04:05Z", InitialIP: "192.0.2.1"}
+	if err := w.apply(&account); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !account.CreatedAt.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) || account.InitialIP != "192.0.2.1" {
+		t.Fatalf("unexpected account metadata: %+v", account)
+	}
+	if len(account.StatusHistory) != 0 {
+		t.Fatalf("expected no status history for new account, got: %+v", account.StatusHistory)
+	}
+
+	if err := (wireAccount{Status: "deactivated"}).apply(&account); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(account.StatusHistory) != 1 || account.StatusHistory[0].Status != "deactivated" {
+		t.Fatalf("expected deactivated status change, got: %+v", account.StatusHistory)
+	}
+}
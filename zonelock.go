@@ -0,0 +1,160 @@
+package acme
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// ZoneLockSolver wraps a Solver, typically a dns-01 solver, so that calls to Present and CleanUp for identifiers in
+// the same dns zone are serialized, and waits for records to propagate are coalesced in to a single check per zone.
+// This avoids hitting dns provider api rate limits when many orders are issued concurrently.
+// The zero value is not usable, Solver must be set. A ZoneLockSolver must not be copied after first use.
+type ZoneLockSolver struct {
+	// The solver to wrap.
+	Solver Solver
+
+	// Zone returns the dns zone of a domain, used to group calls to the solver.
+	// Default uses the last two labels of the domain, eg "example.com" for "www.example.com".
+	// This should be set when issuing for names under public suffixes with more than one label, eg "co.uk".
+	Zone func(domain string) string
+
+	// WaitPropagation waits for all records presented in a zone to be visible, optional.
+	// It is called after Present, outside of the zone lock. Callers which presented records before a wait started
+	// share its result, so each zone has at most one wait in progress.
+	WaitPropagation func(ctx context.Context, zone string) error
+
+	lock  sync.Mutex
+	zones map[string]*zoneState
+}
+
+// State of a single zone, guarded by the ZoneLockSolver lock except for sem.
+type zoneState struct {
+	// Semaphore serializing calls to the solver for this zone.
+	sem chan struct{}
+
+	// Incremented each time a record is presented in the zone.
+	written uint64
+
+	// The propagation wait in progress, if any.
+	check *propagationCheck
+}
+
+// A single wait for records in a zone to propagate, covering all records presented up to gen.
+type propagationCheck struct {
+	gen  uint64
+	done chan struct{}
+	err  error
+}
+
+// Present implements Solver.Present, serializing calls to the wrapped solver per zone.
+func (s *ZoneLockSolver) Present(ctx context.Context, auth Authorization, chal Challenge) error {
+	zone := s.zone(auth.Identifier.Value)
+	st := s.state(zone)
+
+	if err := s.acquire(ctx, st); err != nil {
+		return err
+	}
+	err := s.Solver.Present(ctx, auth, chal)
+	s.lock.Lock()
+	st.written++
+	gen := st.written
+	s.lock.Unlock()
+	<-st.sem
+
+	if err != nil || s.WaitPropagation == nil {
+		return err
+	}
+
+	return s.waitPropagation(ctx, zone, st, gen)
+}
+
+// CleanUp implements Solver.CleanUp, serializing calls to the wrapped solver per zone.
+func (s *ZoneLockSolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error {
+	st := s.state(s.zone(auth.Identifier.Value))
+
+	if err := s.acquire(ctx, st); err != nil {
+		return err
+	}
+	defer func() { <-st.sem }()
+
+	return s.Solver.CleanUp(ctx, auth, chal)
+}
+
+// Helper function to get the zone of a domain.
+func (s *ZoneLockSolver) zone(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(domain), "*."), ".")
+	if s.Zone != nil {
+		return s.Zone(domain)
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) <= 2 {
+		return domain
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// Helper function to get the state of a zone, creating it if required.
+func (s *ZoneLockSolver) state(zone string) *zoneState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.zones == nil {
+		s.zones = map[string]*zoneState{}
+	}
+	st, ok := s.zones[zone]
+	if !ok {
+		st = &zoneState{sem: make(chan struct{}, 1)}
+		s.zones[zone] = st
+	}
+	return st
+}
+
+// Helper function to take the lock of a zone, or return early if the context is done.
+func (s *ZoneLockSolver) acquire(ctx context.Context, st *zoneState) error {
+	select {
+	case st.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Helper function to wait for the record presented as generation gen of a zone to propagate.
+// Joins a wait already in progress if it covers the record, otherwise waits for it to finish and starts a new one. A
+// new wait is also started if the joined wait was cancelled by the context of the caller which started it.
+func (s *ZoneLockSolver) waitPropagation(ctx context.Context, zone string, st *zoneState, gen uint64) error {
+	for {
+		s.lock.Lock()
+		check := st.check
+		if check == nil {
+			check = &propagationCheck{gen: st.written, done: make(chan struct{})}
+			st.check = check
+			s.lock.Unlock()
+
+			check.err = s.WaitPropagation(ctx, zone)
+
+			s.lock.Lock()
+			st.check = nil
+			s.lock.Unlock()
+			close(check.done)
+
+			return check.err
+		}
+		s.lock.Unlock()
+
+		select {
+		case <-check.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if check.gen < gen {
+			continue
+		}
+		// the wait was stopped by the context of the caller which started it, so wait again if this one is still live
+		if (check.err == context.Canceled || check.err == context.DeadlineExceeded) && ctx.Err() == nil {
+			continue
+		}
+		return check.err
+	}
+}
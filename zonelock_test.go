@@ -0,0 +1,148 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Solver which records the maximum number of concurrent calls
+type concurrencySolver struct {
+	active, max int32
+}
+
+func (cs *concurrencySolver) call() error {
+	n := atomic.AddInt32(&cs.active, 1)
+	for {
+		m := atomic.LoadInt32(&cs.max)
+		if n <= m || atomic.CompareAndSwapInt32(&cs.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(&cs.active, -1)
+	return nil
+}
+
+func (cs *concurrencySolver) Present(ctx context.Context, auth Authorization, chal Challenge) error {
+	return cs.call()
+}
+
+func (cs *concurrencySolver) CleanUp(ctx context.Context, auth Authorization, chal Challenge) error {
+	return cs.call()
+}
+
+func TestZoneLockSolver(t *testing.T) {
+	cs := &concurrencySolver{}
+	var waits int32
+	s := &ZoneLockSolver{
+		Solver: cs,
+		WaitPropagation: func(ctx context.Context, zone string) error {
+			atomic.AddInt32(&waits, 1)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			auth := Authorization{Identifier: Identifier{Type: "dns", Value: randString() + ".example.com"}}
+			if err := s.Present(context.Background(), auth, Challenge{}); err != nil {
+				t.Errorf("unexpected error presenting: %v", err)
+			}
+			if err := s.CleanUp(context.Background(), auth, Challenge{}); err != nil {
+				t.Errorf("unexpected error cleaning up: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if cs.max != 1 {
+		t.Errorf("expected solver calls to be serialized, got %d concurrent calls", cs.max)
+	}
+	if waits >= 10 {
+		t.Errorf("expected propagation waits to be coalesced, got %d waits", waits)
+	}
+}
+
+func TestZoneLockSolver_error(t *testing.T) {
+	s := &ZoneLockSolver{
+		Solver: errSolver{},
+		WaitPropagation: func(ctx context.Context, zone string) error {
+			return errors.New("should not wait")
+		},
+	}
+	if err := s.Present(context.Background(), Authorization{}, Challenge{}); err == nil || err.Error() != "present failed" {
+		t.Fatalf("expected present error, got: %v", err)
+	}
+}
+
+func TestZoneLockSolver_zone(t *testing.T) {
+	tests := map[string]string{
+		"example.com":       "example.com",
+		"*.www.example.com": "example.com",
+		"a.b.Example.com.":  "example.com",
+		"localhost":         "localhost",
+		"www.example.co.uk": "co.uk",
+	}
+	s := &ZoneLockSolver{}
+	for domain, expected := range tests {
+		if zone := s.zone(domain); zone != expected {
+			t.Errorf("zone of %s expected %s, got %s", domain, expected, zone)
+		}
+	}
+
+	s.Zone = func(domain string) string { return "custom" }
+	if zone := s.zone("example.com"); zone != "custom" {
+		t.Errorf("expected custom zone, got %s", zone)
+	}
+}
+
+func TestZoneLockSolver_waitCancelled(t *testing.T) {
+	started := make(chan struct{})
+	var waits int32
+	s := &ZoneLockSolver{
+		Solver: &concurrencySolver{},
+		WaitPropagation: func(ctx context.Context, zone string) error {
+			if atomic.AddInt32(&waits, 1) > 1 {
+				return nil
+			}
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	st := s.state("example.com")
+	st.written = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		first <- s.waitPropagation(ctx, "example.com", st, 1)
+	}()
+	<-started
+
+	// the second caller joins the wait started by the first, which is then cancelled
+	second := make(chan error, 1)
+	go func() {
+		second <- s.waitPropagation(context.Background(), "example.com", st, 2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expected first caller to be cancelled, got: %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Fatalf("expected second caller to wait again, got: %v", err)
+	}
+	if n := atomic.LoadInt32(&waits); n != 2 {
+		t.Fatalf("expected 2 waits, got: %d", n)
+	}
+}